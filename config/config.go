@@ -0,0 +1,582 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var validPluginName = regexp.MustCompile(`^[a-z0-9_\-]+$`)
+
+// The names plugins can't use, the ids of their media would clash.
+var builtinProviders = map[string]bool{
+	"udisks": true,
+	"ios":    true,
+	"mtp":    true,
+	"smb":    true,
+	"nfs":    true,
+	"sshfs":  true,
+	"webdav": true,
+	"image":  true,
+	"local":  true,
+	"fake":   true,
+	"muxer":  true,
+}
+
+// Config The configuration of the automounter daemon
+type Config struct {
+	// The address the web API listens on, "host:port"
+	Listen string `yaml:"listen"`
+	// Clients sending this as a bearer token can retrieve secrets,
+	// like smb passwords, and add disk images. If empty, neither
+	// is possible.
+	AdminToken string `yaml:"adminToken"`
+	// The directory that the network and ios mounts are made under
+	MountRoot string          `yaml:"mountRoot"`
+	LogLevel  string          `yaml:"logLevel"`
+	Leases    LeasesConfig    `yaml:"leases"`
+	Rules     RulesConfig     `yaml:"rules"`
+	Providers ProvidersConfig `yaml:"providers"`
+}
+
+// LeasesConfig How leases are managed
+type LeasesConfig struct {
+	// Where the leases are persisted between restarts
+	StorePath string `yaml:"storePath"`
+	// How long a mount is kept around after its last lease is released
+	UnmountDelay time.Duration `yaml:"unmountDelay"`
+	// How long we wait for media to come back after a restart
+	RestoreTimeout time.Duration `yaml:"restoreTimeout"`
+}
+
+// RulesConfig Which media is allowed to be leased. Media matching a deny
+// rule is refused. If there are allow rules, media must match one of them.
+type RulesConfig struct {
+	Allow []RuleConfig `yaml:"allow"`
+	Deny  []RuleConfig `yaml:"deny"`
+}
+
+// RuleConfig Matches media by provider and properties ("fsType: vfat").
+// Property values can be shell patterns.
+type RuleConfig struct {
+	Provider   string            `yaml:"provider"`
+	Properties map[string]string `yaml:"properties"`
+}
+
+// ProvidersConfig The media providers that are enabled, and their settings
+type ProvidersConfig struct {
+	Udisks UdisksConfig `yaml:"udisks"`
+	IOS    IOSConfig    `yaml:"ios"`
+	MTP    MTPConfig    `yaml:"mtp"`
+	SMB    SMBConfig    `yaml:"smb"`
+	NFS    NFSConfig    `yaml:"nfs"`
+	SSHFS  SSHFSConfig  `yaml:"sshfs"`
+	WebDAV WebDAVConfig `yaml:"webdav"`
+	Image  ImageConfig  `yaml:"image"`
+	Local  LocalConfig  `yaml:"local"`
+	Exec   ExecConfig   `yaml:"exec"`
+}
+
+// UdisksConfig Settings for USB block devices
+type UdisksConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Used for every mount, leases can add to them or replace
+	// them ("ro" replaces "rw"). They must be allowed by udisks.
+	MountOptions []string `yaml:"mountOptions"`
+	// Used for the filesystems of the given type, like
+	// "vfat: [utf8]", after the ones above.
+	FSMountOptions map[string][]string `yaml:"fsMountOptions"`
+}
+
+// IOSConfig Settings for iOS devices
+type IOSConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// The bundle id of the app whose documents are mounted.
+	// Devices without this app installed are ignored.
+	AppID string `yaml:"appId"`
+}
+
+// MTPConfig Settings for Android phones and other MTP devices.
+// While a device is plugged in, no other program can talk to it.
+type MTPConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// How often we look for devices that were plugged in
+	PollInterval time.Duration `yaml:"pollInterval"`
+}
+
+// SMBConfig Settings for SMB shares
+type SMBConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Where the shares added through the web API are persisted,
+	// and where their passwords are kept. If registryPath is
+	// empty, those shares are forgotten when restarting.
+	RegistryPath string `yaml:"registryPath"`
+	SecretsPath  string `yaml:"secretsPath"`
+	// How often the mounts are checked, zero to never check them,
+	// and how long they have to respond before they are degraded.
+	HealthInterval time.Duration `yaml:"healthInterval"`
+	HealthTimeout  time.Duration `yaml:"healthTimeout"`
+	// Remount shares that stopped responding at the same path,
+	// so that the leases on them stay valid.
+	Remount bool `yaml:"remount"`
+	// Where the kerberos tickets of the shares using a principal are
+	// kept, and the lifetime requested for them. The tickets of mounted
+	// shares are renewed once half of it has passed, so it shouldn't
+	// exceed what the KDC allows.
+	TicketCacheDir string        `yaml:"ticketCacheDir"`
+	TicketLifetime time.Duration `yaml:"ticketLifetime"`
+	// The only directory that keytabs of shares added through the web
+	// API can come from. If empty, those shares can't use a principal.
+	KeytabDir string `yaml:"keytabDir"`
+	// Shares that are always available, in addition
+	// to the ones added through the web API.
+	Shares []SMBShareConfig `yaml:"shares"`
+}
+
+// NFSConfig Settings for NFS exports
+type NFSConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Where the exports added through the web API are persisted.
+	// If empty, those exports are forgotten when restarting.
+	RegistryPath string `yaml:"registryPath"`
+}
+
+// SSHFSConfig Settings for directories mounted over ssh
+type SSHFSConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Where the directories added through the web API are persisted,
+	// and where their passwords and private keys are kept. If
+	// registryPath is empty, they are forgotten when restarting.
+	RegistryPath string `yaml:"registryPath"`
+	SecretsPath  string `yaml:"secretsPath"`
+	// Where the private keys and known hosts of the mounts are written.
+	StateDir string `yaml:"stateDir"`
+}
+
+// WebDAVConfig Settings for WebDAV collections
+type WebDAVConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Where the collections added through the web API are persisted,
+	// and where their passwords are kept. If registryPath is empty,
+	// they are forgotten when restarting.
+	RegistryPath string `yaml:"registryPath"`
+	SecretsPath  string `yaml:"secretsPath"`
+	// Where the davfs2 configuration of the mounts is written.
+	StateDir string `yaml:"stateDir"`
+}
+
+// ImageConfig Settings for disk images
+type ImageConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Where the images added through the web API are persisted.
+	// If empty, they are forgotten when restarting.
+	RegistryPath string `yaml:"registryPath"`
+	// Only images in these directories can be added. At
+	// least one is required when the provider is enabled.
+	Directories []string `yaml:"directories"`
+}
+
+// LocalConfig Settings for directories on this machine, like
+// internal volumes. They are bind mounted into the mount root,
+// or symlinked there when not running as root.
+type LocalConfig struct {
+	Enabled     bool                   `yaml:"enabled"`
+	Directories []LocalDirectoryConfig `yaml:"directories"`
+}
+
+// LocalDirectoryConfig A directory that is exposed as media,
+// with the id "local-<name>"
+type LocalDirectoryConfig struct {
+	Name     string `yaml:"name"`
+	Path     string `yaml:"path"`
+	ReadOnly bool   `yaml:"readOnly"`
+}
+
+// ExecConfig Media providers implemented by other programs,
+// see the providers/exec package for what they have to do.
+type ExecConfig struct {
+	Plugins []ExecPluginConfig `yaml:"plugins"`
+}
+
+// ExecPluginConfig A program that provides media
+type ExecPluginConfig struct {
+	// Used as the provider name, and in the ids of the media
+	Name string   `yaml:"name"`
+	Path string   `yaml:"path"`
+	Args []string `yaml:"args"`
+	// Added to the environment of the plugin, "KEY=value"
+	Env []string `yaml:"env"`
+	// How long the plugin has to answer a request, 1m if zero
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// SMBShareConfig A share that is always available
+type SMBShareConfig struct {
+	Server   string            `yaml:"server"`
+	Share    string            `yaml:"share"`
+	Security string            `yaml:"security"`
+	Secure   bool              `yaml:"secure"`
+	Domain   string            `yaml:"domain"`
+	Username string            `yaml:"username"`
+	Password string            `yaml:"password"`
+	Mount    SMBMountConfig    `yaml:"mount"`
+	Kerberos SMBKerberosConfig `yaml:"kerberos"`
+}
+
+// SMBKerberosConfig The principal used with the krb5 and krb5i
+// security values, see smb.KerberosOptions
+type SMBKerberosConfig struct {
+	Principal string `yaml:"principal"`
+	Keytab    string `yaml:"keytab"`
+}
+
+// SMBMountConfig How a share is mounted, see smb.MountOptions
+type SMBMountConfig struct {
+	Version   string `yaml:"version"`
+	UID       string `yaml:"uid"`
+	GID       string `yaml:"gid"`
+	FileMode  string `yaml:"fileMode"`
+	DirMode   string `yaml:"dirMode"`
+	ReadOnly  bool   `yaml:"readOnly"`
+	Cache     string `yaml:"cache"`
+	Seal      bool   `yaml:"seal"`
+	Port      int    `yaml:"port"`
+	IOCharset string `yaml:"iocharset"`
+}
+
+// Default The configuration used when no config file is given
+func Default() Config {
+	var result Config
+	result.Listen = ":3000"
+	result.MountRoot = "/run/automounter"
+	result.LogLevel = "info"
+	result.Leases.StorePath = "/var/lib/automounter/leases.json"
+	result.Leases.UnmountDelay = time.Second * 5
+	result.Leases.RestoreTimeout = time.Second * 30
+	result.Providers.Udisks.Enabled = true
+	result.Providers.IOS.Enabled = true
+	result.Providers.IOS.AppID = "com.medxchange.ackbar"
+	result.Providers.MTP.PollInterval = time.Second * 2
+	result.Providers.SMB.Enabled = true
+	result.Providers.SMB.RegistryPath = "/var/lib/automounter/smb-shares.json"
+	result.Providers.SMB.SecretsPath = "/var/lib/automounter/smb-secrets.json"
+	result.Providers.SMB.HealthInterval = time.Second * 10
+	result.Providers.SMB.HealthTimeout = time.Second * 5
+	result.Providers.SMB.Remount = true
+	result.Providers.SMB.TicketCacheDir = "/run/automounter-krb5"
+	result.Providers.SMB.TicketLifetime = time.Hour * 10
+	result.Providers.NFS.Enabled = false
+	result.Providers.NFS.RegistryPath = "/var/lib/automounter/nfs-exports.json"
+	result.Providers.SSHFS.Enabled = false
+	result.Providers.SSHFS.RegistryPath = "/var/lib/automounter/sshfs-directories.json"
+	result.Providers.SSHFS.SecretsPath = "/var/lib/automounter/sshfs-secrets.json"
+	result.Providers.SSHFS.StateDir = "/run/automounter-sshfs"
+	result.Providers.WebDAV.Enabled = false
+	result.Providers.WebDAV.RegistryPath = "/var/lib/automounter/webdav-collections.json"
+	result.Providers.WebDAV.SecretsPath = "/var/lib/automounter/webdav-secrets.json"
+	result.Providers.WebDAV.StateDir = "/run/automounter-webdav"
+	result.Providers.Image.Enabled = false
+	result.Providers.Image.RegistryPath = "/var/lib/automounter/images.json"
+	return result
+}
+
+// Load Read the config file at the given path. Anything not
+// specified in the file keeps its default value. If path is
+// empty, the defaults are used.
+func Load(path string) (Config, error) {
+	result := Default()
+
+	if len(path) > 0 {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return result, fmt.Errorf("couldn't read config file: %v", err)
+		}
+		err = yaml.UnmarshalStrict(data, &result)
+		if err != nil {
+			return result, fmt.Errorf("couldn't parse config file %s: %v", path, err)
+		}
+	}
+
+	err := result.Validate()
+	if err != nil {
+		if len(path) > 0 {
+			return result, fmt.Errorf("invalid config file %s: %v", path, err)
+		}
+		return result, err
+	}
+
+	return result, nil
+}
+
+// Validate Make sure the configuration is usable
+func (s Config) Validate() error {
+	if len(s.Listen) == 0 {
+		return fmt.Errorf("listen is required")
+	}
+	if _, _, err := net.SplitHostPort(s.Listen); err != nil {
+		return fmt.Errorf("listen must be in the form host:port: %v", err)
+	}
+
+	if !filepath.IsAbs(s.MountRoot) {
+		return fmt.Errorf("mountRoot must be an absolute path")
+	}
+	if filepath.Clean(s.MountRoot) == "/" {
+		return fmt.Errorf("mountRoot can't be the root directory")
+	}
+
+	if _, err := logrus.ParseLevel(s.LogLevel); err != nil {
+		return fmt.Errorf("invalid logLevel: %v", err)
+	}
+
+	if len(s.Leases.StorePath) > 0 && !filepath.IsAbs(s.Leases.StorePath) {
+		return fmt.Errorf("leases.storePath must be an absolute path")
+	}
+	if s.Leases.UnmountDelay < 0 {
+		return fmt.Errorf("leases.unmountDelay can't be negative")
+	}
+	if s.Leases.RestoreTimeout < 0 {
+		return fmt.Errorf("leases.restoreTimeout can't be negative")
+	}
+
+	if !s.Providers.Udisks.Enabled && !s.Providers.IOS.Enabled && !s.Providers.MTP.Enabled && !s.Providers.SMB.Enabled && !s.Providers.NFS.Enabled && !s.Providers.SSHFS.Enabled && !s.Providers.WebDAV.Enabled && !s.Providers.Image.Enabled && !s.Providers.Local.Enabled && len(s.Providers.Exec.Plugins) == 0 {
+		return fmt.Errorf("at least one provider must be enabled")
+	}
+	if s.Providers.IOS.Enabled && len(s.Providers.IOS.AppID) == 0 {
+		return fmt.Errorf("providers.ios.appId is required when the ios provider is enabled")
+	}
+	if s.Providers.MTP.Enabled && s.Providers.MTP.PollInterval <= 0 {
+		return fmt.Errorf("providers.mtp.pollInterval must be positive")
+	}
+	if len(s.Providers.SMB.RegistryPath) > 0 {
+		if !filepath.IsAbs(s.Providers.SMB.RegistryPath) {
+			return fmt.Errorf("providers.smb.registryPath must be an absolute path")
+		}
+		if !filepath.IsAbs(s.Providers.SMB.SecretsPath) {
+			return fmt.Errorf("providers.smb.secretsPath must be an absolute path")
+		}
+		if filepath.Clean(s.Providers.SMB.RegistryPath) == filepath.Clean(s.Providers.SMB.SecretsPath) {
+			return fmt.Errorf("providers.smb.secretsPath must be different from the registryPath")
+		}
+	}
+	if s.Providers.SMB.HealthInterval < 0 {
+		return fmt.Errorf("providers.smb.healthInterval can't be negative")
+	}
+	if s.Providers.SMB.HealthInterval > 0 && s.Providers.SMB.HealthTimeout <= 0 {
+		return fmt.Errorf("providers.smb.healthTimeout must be positive")
+	}
+	if !filepath.IsAbs(s.Providers.SMB.TicketCacheDir) {
+		return fmt.Errorf("providers.smb.ticketCacheDir must be an absolute path")
+	}
+	if s.Providers.SMB.TicketLifetime < time.Minute*5 {
+		return fmt.Errorf("providers.smb.ticketLifetime must be at least 5m")
+	}
+	if len(s.Providers.SMB.KeytabDir) > 0 && !filepath.IsAbs(s.Providers.SMB.KeytabDir) {
+		return fmt.Errorf("providers.smb.keytabDir must be an absolute path")
+	}
+	if len(s.Providers.NFS.RegistryPath) > 0 && !filepath.IsAbs(s.Providers.NFS.RegistryPath) {
+		return fmt.Errorf("providers.nfs.registryPath must be an absolute path")
+	}
+	if len(s.Providers.SSHFS.RegistryPath) > 0 {
+		if !filepath.IsAbs(s.Providers.SSHFS.RegistryPath) {
+			return fmt.Errorf("providers.sshfs.registryPath must be an absolute path")
+		}
+		if !filepath.IsAbs(s.Providers.SSHFS.SecretsPath) {
+			return fmt.Errorf("providers.sshfs.secretsPath must be an absolute path")
+		}
+		if filepath.Clean(s.Providers.SSHFS.RegistryPath) == filepath.Clean(s.Providers.SSHFS.SecretsPath) {
+			return fmt.Errorf("providers.sshfs.secretsPath must be different from the registryPath")
+		}
+	}
+	if !filepath.IsAbs(s.Providers.SSHFS.StateDir) {
+		return fmt.Errorf("providers.sshfs.stateDir must be an absolute path")
+	}
+	if len(s.Providers.WebDAV.RegistryPath) > 0 {
+		if !filepath.IsAbs(s.Providers.WebDAV.RegistryPath) {
+			return fmt.Errorf("providers.webdav.registryPath must be an absolute path")
+		}
+		if !filepath.IsAbs(s.Providers.WebDAV.SecretsPath) {
+			return fmt.Errorf("providers.webdav.secretsPath must be an absolute path")
+		}
+		if filepath.Clean(s.Providers.WebDAV.RegistryPath) == filepath.Clean(s.Providers.WebDAV.SecretsPath) {
+			return fmt.Errorf("providers.webdav.secretsPath must be different from the registryPath")
+		}
+	}
+	if !filepath.IsAbs(s.Providers.WebDAV.StateDir) {
+		return fmt.Errorf("providers.webdav.stateDir must be an absolute path")
+	}
+	if len(s.Providers.Image.RegistryPath) > 0 && !filepath.IsAbs(s.Providers.Image.RegistryPath) {
+		return fmt.Errorf("providers.image.registryPath must be an absolute path")
+	}
+	if s.Providers.Image.Enabled && len(s.Providers.Image.Directories) == 0 {
+		return fmt.Errorf("providers.image.directories needs at least one directory when the image provider is enabled")
+	}
+	for index, directory := range s.Providers.Image.Directories {
+		if !filepath.IsAbs(directory) {
+			return fmt.Errorf("providers.image.directories[%d] must be an absolute path", index)
+		}
+	}
+	localNames := make(map[string]bool)
+	for index, directory := range s.Providers.Local.Directories {
+		if len(directory.Name) == 0 {
+			return fmt.Errorf("providers.local.directories[%d] needs a name", index)
+		}
+		if localNames[directory.Name] {
+			return fmt.Errorf("providers.local.directories[%d] has the same name as another directory", index)
+		}
+		localNames[directory.Name] = true
+		if !filepath.IsAbs(directory.Path) {
+			return fmt.Errorf("providers.local.directories[%d] must have an absolute path", index)
+		}
+	}
+	pluginNames := make(map[string]bool)
+	for index, plugin := range s.Providers.Exec.Plugins {
+		if !validPluginName.MatchString(plugin.Name) {
+			return fmt.Errorf("providers.exec.plugins[%d] needs a name made of lowercase letters, numbers, - and _", index)
+		}
+		if builtinProviders[plugin.Name] || pluginNames[plugin.Name] {
+			return fmt.Errorf("providers.exec.plugins[%d] has the same name as another provider", index)
+		}
+		pluginNames[plugin.Name] = true
+		if !filepath.IsAbs(plugin.Path) {
+			return fmt.Errorf("providers.exec.plugins[%d] must have an absolute path", index)
+		}
+		for _, env := range plugin.Env {
+			if !strings.Contains(env, "=") {
+				return fmt.Errorf("providers.exec.plugins[%d].env must be in the form KEY=value", index)
+			}
+		}
+		if plugin.Timeout < 0 {
+			return fmt.Errorf("providers.exec.plugins[%d].timeout can't be negative", index)
+		}
+	}
+	for index, share := range s.Providers.SMB.Shares {
+		if len(share.Server) == 0 || len(share.Share) == 0 {
+			return fmt.Errorf("providers.smb.shares[%d] needs a server and a share", index)
+		}
+	}
+
+	return nil
+}
+
+// RestartRequired Returns the settings that changed between the two
+// configurations, but can only be applied by restarting the daemon.
+func RestartRequired(previous Config, current Config) []string {
+	result := make([]string, 0)
+	if previous.Listen != current.Listen {
+		result = append(result, "listen")
+	}
+	if previous.AdminToken != current.AdminToken {
+		result = append(result, "adminToken")
+	}
+	if previous.MountRoot != current.MountRoot {
+		result = append(result, "mountRoot")
+	}
+	if previous.Leases.StorePath != current.Leases.StorePath {
+		result = append(result, "leases.storePath")
+	}
+	if previous.Leases.RestoreTimeout != current.Leases.RestoreTimeout {
+		result = append(result, "leases.restoreTimeout")
+	}
+	if previous.Providers.Udisks.Enabled != current.Providers.Udisks.Enabled {
+		result = append(result, "providers.udisks.enabled")
+	}
+	if !reflect.DeepEqual(previous.Providers.Udisks.MountOptions, current.Providers.Udisks.MountOptions) {
+		result = append(result, "providers.udisks.mountOptions")
+	}
+	if !reflect.DeepEqual(previous.Providers.Udisks.FSMountOptions, current.Providers.Udisks.FSMountOptions) {
+		result = append(result, "providers.udisks.fsMountOptions")
+	}
+	if previous.Providers.IOS.Enabled != current.Providers.IOS.Enabled {
+		result = append(result, "providers.ios.enabled")
+	}
+	if previous.Providers.IOS.AppID != current.Providers.IOS.AppID {
+		result = append(result, "providers.ios.appId")
+	}
+	if previous.Providers.MTP.Enabled != current.Providers.MTP.Enabled {
+		result = append(result, "providers.mtp.enabled")
+	}
+	if previous.Providers.MTP.PollInterval != current.Providers.MTP.PollInterval {
+		result = append(result, "providers.mtp.pollInterval")
+	}
+	if previous.Providers.SMB.Enabled != current.Providers.SMB.Enabled {
+		result = append(result, "providers.smb.enabled")
+	}
+	if previous.Providers.SMB.RegistryPath != current.Providers.SMB.RegistryPath {
+		result = append(result, "providers.smb.registryPath")
+	}
+	if previous.Providers.SMB.SecretsPath != current.Providers.SMB.SecretsPath {
+		result = append(result, "providers.smb.secretsPath")
+	}
+	if previous.Providers.SMB.HealthInterval != current.Providers.SMB.HealthInterval {
+		result = append(result, "providers.smb.healthInterval")
+	}
+	if previous.Providers.SMB.HealthTimeout != current.Providers.SMB.HealthTimeout {
+		result = append(result, "providers.smb.healthTimeout")
+	}
+	if previous.Providers.SMB.Remount != current.Providers.SMB.Remount {
+		result = append(result, "providers.smb.remount")
+	}
+	if previous.Providers.SMB.TicketCacheDir != current.Providers.SMB.TicketCacheDir {
+		result = append(result, "providers.smb.ticketCacheDir")
+	}
+	if previous.Providers.SMB.TicketLifetime != current.Providers.SMB.TicketLifetime {
+		result = append(result, "providers.smb.ticketLifetime")
+	}
+	if previous.Providers.SMB.KeytabDir != current.Providers.SMB.KeytabDir {
+		result = append(result, "providers.smb.keytabDir")
+	}
+	if previous.Providers.NFS.Enabled != current.Providers.NFS.Enabled {
+		result = append(result, "providers.nfs.enabled")
+	}
+	if previous.Providers.NFS.RegistryPath != current.Providers.NFS.RegistryPath {
+		result = append(result, "providers.nfs.registryPath")
+	}
+	if previous.Providers.SSHFS.Enabled != current.Providers.SSHFS.Enabled {
+		result = append(result, "providers.sshfs.enabled")
+	}
+	if previous.Providers.SSHFS.RegistryPath != current.Providers.SSHFS.RegistryPath {
+		result = append(result, "providers.sshfs.registryPath")
+	}
+	if previous.Providers.SSHFS.SecretsPath != current.Providers.SSHFS.SecretsPath {
+		result = append(result, "providers.sshfs.secretsPath")
+	}
+	if previous.Providers.SSHFS.StateDir != current.Providers.SSHFS.StateDir {
+		result = append(result, "providers.sshfs.stateDir")
+	}
+	if previous.Providers.WebDAV.Enabled != current.Providers.WebDAV.Enabled {
+		result = append(result, "providers.webdav.enabled")
+	}
+	if previous.Providers.WebDAV.RegistryPath != current.Providers.WebDAV.RegistryPath {
+		result = append(result, "providers.webdav.registryPath")
+	}
+	if previous.Providers.WebDAV.SecretsPath != current.Providers.WebDAV.SecretsPath {
+		result = append(result, "providers.webdav.secretsPath")
+	}
+	if previous.Providers.WebDAV.StateDir != current.Providers.WebDAV.StateDir {
+		result = append(result, "providers.webdav.stateDir")
+	}
+	if previous.Providers.Image.Enabled != current.Providers.Image.Enabled {
+		result = append(result, "providers.image.enabled")
+	}
+	if previous.Providers.Image.RegistryPath != current.Providers.Image.RegistryPath {
+		result = append(result, "providers.image.registryPath")
+	}
+	if strings.Join(previous.Providers.Image.Directories, ":") != strings.Join(current.Providers.Image.Directories, ":") {
+		result = append(result, "providers.image.directories")
+	}
+	if previous.Providers.Local.Enabled != current.Providers.Local.Enabled {
+		result = append(result, "providers.local.enabled")
+	}
+	if !reflect.DeepEqual(previous.Providers.Exec.Plugins, current.Providers.Exec.Plugins) {
+		result = append(result, "providers.exec.plugins")
+	}
+	return result
+}
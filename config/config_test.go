@@ -0,0 +1,156 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		err    string
+	}{
+		{"defaults", func(c *Config) {}, ""},
+		{"no listen", func(c *Config) { c.Listen = "" }, "listen is required"},
+		{"listen without port", func(c *Config) { c.Listen = "localhost" }, "listen must be in the form host:port"},
+		{"relative mount root", func(c *Config) { c.MountRoot = "run/automounter" }, "mountRoot must be an absolute path"},
+		{"root mount root", func(c *Config) { c.MountRoot = "/" }, "mountRoot can't be the root directory"},
+		{"bad log level", func(c *Config) { c.LogLevel = "loud" }, "invalid logLevel"},
+		{"relative store path", func(c *Config) { c.Leases.StorePath = "leases.json" }, "leases.storePath must be an absolute path"},
+		{"negative unmount delay", func(c *Config) { c.Leases.UnmountDelay = -time.Second }, "leases.unmountDelay can't be negative"},
+		{"no providers", func(c *Config) {
+			c.Providers.Udisks.Enabled = false
+			c.Providers.IOS.Enabled = false
+			c.Providers.SMB.Enabled = false
+			c.Providers.NFS.Enabled = false
+			c.Providers.SSHFS.Enabled = false
+			c.Providers.WebDAV.Enabled = false
+		}, "at least one provider must be enabled"},
+		{"ios without app id", func(c *Config) { c.Providers.IOS.AppID = "" }, "providers.ios.appId is required"},
+		{"same smb registry and secrets", func(c *Config) { c.Providers.SMB.SecretsPath = c.Providers.SMB.RegistryPath }, "providers.smb.secretsPath must be different"},
+		{"short ticket lifetime", func(c *Config) { c.Providers.SMB.TicketLifetime = time.Minute }, "providers.smb.ticketLifetime must be at least 5m"},
+		{"relative keytab dir", func(c *Config) { c.Providers.SMB.KeytabDir = "keytabs" }, "providers.smb.keytabDir must be an absolute path"},
+		{"image without directories", func(c *Config) { c.Providers.Image.Enabled = true }, "providers.image.directories needs at least one directory"},
+		{"image with directories", func(c *Config) {
+			c.Providers.Image.Enabled = true
+			c.Providers.Image.Directories = []string{"/srv/images"}
+		}, ""},
+		{"local without name", func(c *Config) {
+			c.Providers.Local.Directories = []LocalDirectoryConfig{{Path: "/srv"}}
+		}, "providers.local.directories[0] needs a name"},
+		{"local with same names", func(c *Config) {
+			c.Providers.Local.Directories = []LocalDirectoryConfig{{Name: "srv", Path: "/srv"}, {Name: "srv", Path: "/mnt"}}
+		}, "providers.local.directories[1] has the same name"},
+		{"plugin with builtin name", func(c *Config) {
+			c.Providers.Exec.Plugins = []ExecPluginConfig{{Name: "smb", Path: "/usr/bin/plugin"}}
+		}, "providers.exec.plugins[0] has the same name as another provider"},
+		{"plugin with bad env", func(c *Config) {
+			c.Providers.Exec.Plugins = []ExecPluginConfig{{Name: "plugin", Path: "/usr/bin/plugin", Env: []string{"KEY"}}}
+		}, "providers.exec.plugins[0].env must be in the form KEY=value"},
+		{"share without server", func(c *Config) {
+			c.Providers.SMB.Shares = []SMBShareConfig{{Share: "files"}}
+		}, "providers.smb.shares[0] needs a server and a share"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := Default()
+			test.change(&c)
+			err := c.Validate()
+			if len(test.err) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected an error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"empty", "", ""},
+		{"override", "listen: \":4000\"\n", ""},
+		{"unknown field", "listne: \":4000\"\n", "couldn't parse config file"},
+		{"invalid", "mountRoot: relative\n", "invalid config file"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, "config.yml")
+			err := ioutil.WriteFile(path, []byte(test.content), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = Load(path)
+			if len(test.err) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected an error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	previous := Default()
+
+	current := Default()
+	current.Leases.UnmountDelay = time.Minute
+	current.Rules.Deny = []RuleConfig{{Provider: "udisks"}}
+	if changed := RestartRequired(previous, current); len(changed) != 0 {
+		t.Fatalf("expected the live settings to not require a restart, got %v", changed)
+	}
+
+	current = Default()
+	current.Listen = ":4000"
+	current.Providers.SMB.KeytabDir = "/etc/keytabs"
+	changed := RestartRequired(previous, current)
+	if strings.Join(changed, ",") != "listen,providers.smb.keytabDir" {
+		t.Fatalf("unexpected settings requiring a restart: %v", changed)
+	}
+}
+
+func TestDefaultProviders(t *testing.T) {
+	c := Default()
+
+	// Providers that make the daemon reach out to other
+	// machines, or read local files, must be turned on.
+	tests := []struct {
+		name    string
+		enabled bool
+	}{
+		{"nfs", c.Providers.NFS.Enabled},
+		{"sshfs", c.Providers.SSHFS.Enabled},
+		{"webdav", c.Providers.WebDAV.Enabled},
+		{"image", c.Providers.Image.Enabled},
+	}
+
+	for _, test := range tests {
+		if test.enabled {
+			t.Errorf("expected %s to be disabled by default", test.name)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+
+	"github.com/pauldotknopf/automounter/config"
+	"github.com/pauldotknopf/automounter/providers/fake"
+)
+
+var fakeMode = flag.Bool("fake", false, "serve fake media instead of using the real providers, for demos and tests")
+
+// fakeConfig replaces the providers with the fake one, and keeps
+// everything out of the system directories so that it runs as
+// any user.
+func fakeConfig(cfg config.Config) config.Config {
+	cfg.MountRoot = filepath.Join(os.TempDir(), "automounter-fake")
+	cfg.Leases.StorePath = ""
+	cfg.Providers = config.ProvidersConfig{}
+	return cfg
+}
+
+// addDemoMedia plugs in a couple of sticks, more can
+// be added through /fake/add.
+func addDemoMedia(fakeProvider fake.Provider) error {
+	var demo []fake.Options
+	demo = append(demo, fake.Options{
+		ID:          "fake-usb-stick",
+		DisplayName: "USB stick",
+		Properties: map[string]string{
+			"fsType": "vfat",
+			"label":  "STICK",
+			"uuid":   "1234-ABCD",
+			"vendor": "SanDisk",
+			"model":  "Cruzer Blade",
+			"serial": "4C530001230815109142",
+			"size":   "8004304896",
+		},
+		Files: map[string]string{
+			"README.txt":         "This is a fake USB stick.\n",
+			"documents/todo.txt": "- plug in a real stick\n",
+		},
+	})
+	demo = append(demo, fake.Options{
+		ID:          "fake-sd-card",
+		DisplayName: "SD card",
+		Properties: map[string]string{
+			"fsType": "exfat",
+			"label":  "CAMERA",
+			"uuid":   "5F2E-19C0",
+			"vendor": "Generic",
+			"model":  "SD/MMC",
+			"serial": "0x1f3c52a8",
+			"size":   "63864569856",
+		},
+		Files: map[string]string{
+			"DCIM/100CANON/IMG_0001.JPG": "not really a photo\n",
+		},
+	})
+	for _, options := range demo {
+		_, err := fakeProvider.AddMedia(options)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
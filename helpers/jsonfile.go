@@ -0,0 +1,46 @@
+package helpers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ReadJSONFile Decodes the file into v. Returns false if the file doesn't exist.
+func ReadJSONFile(path string, v interface{}) (bool, error) {
+	exists, err := PathExists(path)
+	if err != nil || !exists {
+		return false, err
+	}
+	j, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(j, v)
+}
+
+// WriteJSONFile Encodes v into the file. It is written to a temporary
+// file first, so that we never leave a half written file behind if
+// we crash. The file gets the given permissions, even if it exists.
+func WriteJSONFile(path string, v interface{}, perm os.FileMode) error {
+	j, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	err = ioutil.WriteFile(tmpPath, j, perm)
+	if err != nil {
+		return err
+	}
+	// WriteFile doesn't change the permissions of an existing file.
+	err = os.Chmod(tmpPath, perm)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,65 @@
+package helpers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJSONFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "helpers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state", "values.json")
+
+	var values map[string]string
+	found, err := ReadJSONFile(path, &values)
+	if err != nil || found {
+		t.Fatalf("expected a missing file to not be found, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		values map[string]string
+		perm   os.FileMode
+	}{
+		{"created", map[string]string{"a": "1"}, 0644},
+		{"replaced", map[string]string{"b": "2"}, 0600},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := WriteJSONFile(path, test.values, test.perm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != test.perm {
+				t.Fatalf("expected the permissions %v, got %v", test.perm, info.Mode().Perm())
+			}
+			if exists, _ := PathExists(path + ".tmp"); exists {
+				t.Fatal("expected the temporary file to be gone")
+			}
+
+			var values map[string]string
+			found, err := ReadJSONFile(path, &values)
+			if err != nil || !found {
+				t.Fatalf("expected the file to be found, got %v", err)
+			}
+			if len(values) != len(test.values) {
+				t.Fatalf("expected %v, got %v", test.values, values)
+			}
+			for key, value := range test.values {
+				if values[key] != value {
+					t.Fatalf("expected %v, got %v", test.values, values)
+				}
+			}
+		})
+	}
+}
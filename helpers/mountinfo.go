@@ -0,0 +1,117 @@
+package helpers
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// MountInfo describes a single entry in /proc/self/mountinfo
+type MountInfo struct {
+	MountPoint string
+	FSType     string
+	Source     string
+	Options    string
+}
+
+// GetMounts returns all the mounts visible to the current process
+func GetMounts() ([]MountInfo, error) {
+	file, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	result := make([]MountInfo, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+		fields := strings.Fields(scanner.Text())
+		separator := -1
+		for index, field := range fields {
+			if field == "-" {
+				separator = index
+				break
+			}
+		}
+		if separator < 5 || len(fields) < separator+3 {
+			return nil, fmt.Errorf("invalid mountinfo line: %s", scanner.Text())
+		}
+		var mount MountInfo
+		mount.MountPoint = unescapeMountInfo(fields[4])
+		mount.Options = fields[5]
+		mount.FSType = fields[separator+1]
+		mount.Source = unescapeMountInfo(fields[separator+2])
+		result = append(result, mount)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// IsMountPoint returns whether something is mounted at the given path
+func IsMountPoint(path string) (bool, error) {
+	mounts, err := GetMounts()
+	if err != nil {
+		return false, err
+	}
+	path = filepath.Clean(path)
+	for _, mount := range mounts {
+		if mount.MountPoint == path {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// IsReadOnlyMount returns whether the mount at the given path is read-only
+func IsReadOnlyMount(path string) (bool, error) {
+	mounts, err := GetMounts()
+	if err != nil {
+		return false, err
+	}
+	path = filepath.Clean(path)
+	// The last mount at the path is the one that is visible.
+	readOnly := false
+	found := false
+	for _, mount := range mounts {
+		if mount.MountPoint == path {
+			readOnly = false
+			for _, option := range strings.Split(mount.Options, ",") {
+				if option == "ro" {
+					readOnly = true
+				}
+			}
+			found = true
+		}
+	}
+	if !found {
+		return false, fmt.Errorf("nothing is mounted at %s", path)
+	}
+	return readOnly, nil
+}
+
+// The kernel escapes spaces, tabs, newlines and backslashes as octal.
+func unescapeMountInfo(value string) string {
+	if !strings.Contains(value, "\\") {
+		return value
+	}
+	var result bytes.Buffer
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+3 < len(value) {
+			if octal, err := strconv.ParseUint(value[i+1:i+4], 8, 8); err == nil {
+				result.WriteByte(byte(octal))
+				i += 3
+				continue
+			}
+		}
+		result.WriteByte(value[i])
+	}
+	return result.String()
+}
@@ -0,0 +1,47 @@
+package helpers
+
+import "testing"
+
+func TestUnescapeMountInfo(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"/run/automounter/abcde", "/run/automounter/abcde"},
+		{"/mnt/my\\040stick", "/mnt/my stick"},
+		{"/mnt/tab\\011and\\012newline", "/mnt/tab\tand\nnewline"},
+		{"//server/back\\134slash", "//server/back\\slash"},
+		{"/mnt/trailing\\04", "/mnt/trailing\\04"},
+		{"/mnt/not\\octal", "/mnt/not\\octal"},
+		{"/mnt/\\999", "/mnt/\\999"},
+	}
+
+	for _, test := range tests {
+		if actual := unescapeMountInfo(test.value); actual != test.expected {
+			t.Errorf("unescapeMountInfo(%q) = %q, expected %q", test.value, actual, test.expected)
+		}
+	}
+}
+
+func TestIsUnderMountRoot(t *testing.T) {
+	previous := MountRoot()
+	defer SetMountRoot(previous)
+	SetMountRoot("/run/automounter/")
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"/run/automounter/abcde", true},
+		{"/run/automounter/abcde/", true},
+		{"/run/automounter", false},
+		{"/run/automounter-sshfs/abcde", false},
+		{"/run/automounter/../abcde", false},
+	}
+
+	for _, test := range tests {
+		if actual := IsUnderMountRoot(test.path); actual != test.expected {
+			t.Errorf("IsUnderMountRoot(%q) = %v, expected %v", test.path, actual, test.expected)
+		}
+	}
+}
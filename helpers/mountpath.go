@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -11,27 +14,39 @@ func init() {
 	rand.Seed(time.Now().UnixNano())
 }
 
+var mountRoot = "/run/automounter"
+
+// MountRoot returns the directory that all of our mounts are made under
+func MountRoot() string {
+	return mountRoot
+}
+
+// SetMountRoot changes the directory that mounts are made under
+func SetMountRoot(path string) {
+	mountRoot = filepath.Clean(path)
+}
+
 // GetTmpMountPath returns a tmp path, suitable for mounting
 func GetTmpMountPath() (string, error) {
-	exists, err := PathExists("/run/automounter")
+	exists, err := PathExists(mountRoot)
 	if err != nil {
 		return "", err
 	}
 	if !exists {
-		err = os.Mkdir("/run/automounter", 0755)
+		err = os.MkdirAll(mountRoot, 0755)
 		if err != nil {
 			return "", err
 		}
 	}
 
 	// Make our tmp directory
-	path := fmt.Sprintf("/run/automounter/%s", RandString(5))
+	path := filepath.Join(mountRoot, RandString(5))
 	exists, err = PathExists(path)
 	if err != nil {
 		return "", err
 	}
 	for exists {
-		path = fmt.Sprintf("/run/automounter/%s", RandString(5))
+		path = filepath.Join(mountRoot, RandString(5))
 		exists, err = PathExists(path)
 		if err != nil {
 			return "", err
@@ -43,3 +58,16 @@ func GetTmpMountPath() (string, error) {
 	}
 	return path, nil
 }
+
+// IsUnderMountRoot returns whether the given path is inside our mount root
+func IsUnderMountRoot(path string) bool {
+	return strings.HasPrefix(filepath.Clean(path), mountRoot+string(filepath.Separator))
+}
+
+// LazyUnmount detaches the mount at the given path, even if it is busy
+func LazyUnmount(path string) error {
+	if output, err := exec.Command("umount", "-l", path).CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, output)
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+package helpers
+
+// HasControlCharacters Returns true if the value has newlines, tabs or other
+// control characters, which could break the files and arguments it ends up in.
+func HasControlCharacters(value string) bool {
+	for _, c := range value {
+		if c < 0x20 || c == 0x7f {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+package helpers
+
+import "testing"
+
+func TestHasControlCharacters(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected bool
+	}{
+		{"", false},
+		{"backup@EXAMPLE.COM", false},
+		{"späce and ünicode", false},
+		{"line\nbreak", true},
+		{"tab\tbed", true},
+		{"nul\x00", true},
+		{"delete\x7f", true},
+	}
+
+	for _, test := range tests {
+		if actual := HasControlCharacters(test.value); actual != test.expected {
+			t.Errorf("expected %v for %q, got %v", test.expected, test.value, actual)
+		}
+	}
+}
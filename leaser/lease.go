@@ -10,16 +10,40 @@ type mediaLease struct {
 	mediaID string
 	providers.MountSession
 	leases []*mediaLeaseItem
+	// nil if the provider doesn't know them
+	mountOptions []string
 	// When the last lease is closed,
 	// we want to clean up this mount session
 	// after a period of time
 	lastClosedTime time.Time
 }
 
+func (s *mediaLease) readOnly() bool {
+	return hasMountOptions(s.mountOptions, []string{"ro"})
+}
+
+// allows Returns true if a lease with the given access can use the mount.
+func (s *mediaLease) allows(access Access) bool {
+	switch access {
+	case AccessReadOnly:
+		return s.readOnly()
+	case AccessReadWrite:
+		return !s.readOnly()
+	}
+	return true
+}
+
 type mediaLeaseItem struct {
 	leaseID     string
 	mediaItemID string
 	media       *mediaLease
+	// If set, the lease must be renewed
+	// within this period or it is reclaimed.
+	ttl         time.Duration
+	lastRenewed time.Time
+	exclusive   bool
+	// When it was removed without being released
+	invalidated time.Time
 }
 
 func (s *mediaLeaseItem) ID() string {
@@ -37,3 +61,97 @@ func (s *mediaLeaseItem) MountPath() string {
 func (s *mediaLeaseItem) IsValid() bool {
 	return s.media != nil
 }
+
+func (s *mediaLeaseItem) ExpiresAt() time.Time {
+	if s.ttl == 0 {
+		return time.Time{}
+	}
+	return s.lastRenewed.Add(s.ttl)
+}
+
+func (s *mediaLeaseItem) MountOptions() []string {
+	if s.media == nil {
+		return nil
+	}
+	return s.media.mountOptions
+}
+
+func (s *mediaLeaseItem) ReadOnly() bool {
+	if s.media == nil {
+		return false
+	}
+	return s.media.readOnly()
+}
+
+func (s *mediaLeaseItem) Exclusive() bool {
+	return s.exclusive
+}
+
+// leaseSnapshot A lease frozen in time
+type leaseSnapshot struct {
+	leaseID      string
+	mediaID      string
+	mountPath    string
+	valid        bool
+	expiresAt    time.Time
+	mountOptions []string
+	readOnly     bool
+	exclusive    bool
+}
+
+func (s leaseSnapshot) ID() string {
+	return s.leaseID
+}
+
+func (s leaseSnapshot) MediaID() string {
+	return s.mediaID
+}
+
+func (s leaseSnapshot) MountPath() string {
+	return s.mountPath
+}
+
+func (s leaseSnapshot) IsValid() bool {
+	return s.valid
+}
+
+func (s leaseSnapshot) ExpiresAt() time.Time {
+	return s.expiresAt
+}
+
+func (s leaseSnapshot) MountOptions() []string {
+	return s.mountOptions
+}
+
+func (s leaseSnapshot) ReadOnly() bool {
+	return s.readOnly
+}
+
+func (s leaseSnapshot) Exclusive() bool {
+	return s.exclusive
+}
+
+func (s *mediaLeaseItem) isExpired(now time.Time) bool {
+	if s.ttl == 0 {
+		return false
+	}
+	return now.After(s.ExpiresAt())
+}
+
+// hasMountOptions Returns true if the mount has all the
+// requested options, so that it can be shared.
+func hasMountOptions(mounted []string, requested []string) bool {
+	for _, option := range requested {
+		found := false
+		for _, mountedOption := range mounted {
+			if mountedOption == option {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
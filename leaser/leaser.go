@@ -2,45 +2,223 @@ package leaser
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/olebedev/emitter"
+
 	"github.com/pauldotknopf/automounter/helpers"
 	"github.com/pauldotknopf/automounter/providers"
 )
 
+// The reasons a lease can be removed without being released
+const (
+	// ReasonExpired The client didn't renew the lease in time
+	ReasonExpired = "expired"
+	// ReasonMediaRemoved The leased media went away
+	ReasonMediaRemoved = "mediaRemoved"
+	// ReasonRestoreFailed The mount couldn't be restored after a restart
+	ReasonRestoreFailed = "restoreFailed"
+)
+
+var (
+	// ErrLeasedExclusively The media is held by an exclusive lease
+	ErrLeasedExclusively = errors.New("the media is leased exclusively by another client")
+	// ErrAlreadyLeased An exclusive lease was requested on media that is already leased
+	ErrAlreadyLeased = errors.New("the media is already leased, it can't be leased exclusively")
+	// ErrWaitCanceled The caller stopped waiting for the conflicting leases
+	ErrWaitCanceled = errors.New("stopped waiting for the other leases to be released")
+)
+
+// The most invalidated leases we remember, the oldest are forgotten first
+const maxInvalidatedLeases = 1024
+
+// MaxWait The longest a lease can wait for conflicting leases
+const MaxWait = time.Minute * 5
+
 // Lease represents a leased media item
 type Lease interface {
 	ID() string
 	MediaID() string
 	MountPath() string
 	IsValid() bool
+	// When the lease will be reclaimed if it isn't renewed.
+	// The zero time if the lease never expires.
+	ExpiresAt() time.Time
+	// The options the media was mounted with, including the
+	// defaults of the provider. nil if they aren't known.
+	MountOptions() []string
+	// If the media is mounted read-only
+	ReadOnly() bool
+	// If no other lease can be held on the media
+	Exclusive() bool
+}
+
+// Access How a lease uses the media
+type Access string
+
+const (
+	// AccessAny The lease shares the mount whichever way it is
+	// mounted. New mounts are read-write, unless the provider
+	// can only mount the media read-only.
+	AccessAny Access = ""
+	// AccessReadOnly The media is mounted read-only, and
+	// stays that way while the lease is held.
+	AccessReadOnly Access = "ro"
+	// AccessReadWrite The media is mounted read-write
+	AccessReadWrite Access = "rw"
+)
+
+// Mode If a lease can share the media with other leases
+type Mode string
+
+const (
+	// ModeShared The lease shares the mount with other shared leases
+	ModeShared Mode = ""
+	// ModeExclusive The lease is the only one held on the media
+	ModeExclusive Mode = "exclusive"
+)
+
+// LeaseOptions Options for creating a lease
+type LeaseOptions struct {
+	// If non-zero, the lease must be renewed within
+	// this period, or it will be reclaimed.
+	TTL time.Duration
+	// Options for mounting the media, like "noexec". If the media
+	// is already mounted, it must have been with these options.
+	MountOptions []string
+	Access       Access
+	Mode         Mode
+	// How long to wait for conflicting leases to be released, up
+	// to MaxWait. If zero, a conflict fails the lease right away.
+	Wait time.Duration
+	// If closed, stop waiting, like when the client went away.
+	Cancel <-chan struct{}
+}
+
+// Options Timings used by the leaser
+type Options struct {
+	// How long a mount is kept around after its last lease
+	// is released, so that a new lease can pick it up again.
+	UnmountDelay time.Duration
+	// How long we wait for media from a previous run to show
+	// up again before we invalidate the leases held on it.
+	RestoreTimeout time.Duration
+	// How long we remember leases that were removed without being
+	// released, so their clients find out why renewing them fails.
+	InvalidatedRetention time.Duration
+}
+
+// DefaultOptions The default timings
+func DefaultOptions() Options {
+	return Options{
+		UnmountDelay:         time.Second * 5,
+		RestoreTimeout:       time.Second * 30,
+		InvalidatedRetention: time.Hour * 24,
+	}
+}
+
+// LeaseEvent Describes a lease that was removed without being released
+type LeaseEvent struct {
+	LeaseID string
+	MediaID string
+	Reason  string
 }
 
 // Leaser The type that manages leases for media items
 type Leaser interface {
 	MediaProvider() providers.MediaProvider
 	Leases() []Lease
-	Lease(mediaID string) (Lease, error)
-	LeaseDynamic(mediaID string, buildSession func() (providers.MountSession, error)) (Lease, error)
+	Lease(mediaID string, options LeaseOptions) (Lease, error)
+	LeaseDynamic(mediaItem providers.Media, options LeaseOptions, buildSession func() (providers.MountSession, error)) (Lease, error)
+	// Lease the first media that matches the selector, once it shows up.
+	// If the timeout is zero, it waits until it is canceled.
+	LeaseWhenAvailable(selector Selector, options LeaseOptions, timeout time.Duration) (PendingLease, error)
+	PendingLeases() []PendingLease
+	// Stop waiting for media, or release the lease if it was already made.
+	CancelPending(pendingID string) error
+	Renew(leaseID string) error
 	Release(leaseID string) error
+	LeaseRemoved() (<-chan LeaseEvent, func())
+	// Clean up the mounts left behind by a previous run
+	// that aren't held by any persisted lease.
+	RecoverStaleMounts() error
+	// Change the timings and rules without affecting existing leases.
+	SetOptions(options Options)
+	SetRules(rules Rules)
 	Process(ctx context.Context) error
 }
 
 type leaser struct {
 	mediaProvider     providers.MediaProvider
+	store             Store
+	options           Options
+	rules             Rules
 	media             []*mediaLease
 	invalidatedLeases []*mediaLeaseItem
-	lock              sync.Mutex
+	// Mounts from a previous run that are waiting
+	// for their media to show up again.
+	restoring []StoredMedia
+	lock      sync.Mutex
+	emit      *emitter.Emitter
+	// Closed and replaced whenever a lease goes away,
+	// to wake up the leases waiting on a conflict.
+	released chan struct{}
+	// The leases waiting for media to show up. Never
+	// take this lock while holding the main one.
+	pending     []*pendingLease
+	pendingLock sync.Mutex
+	// The removed leases observers are told about once the lock is released
+	events []LeaseEvent
 }
 
-// Create a leaser object
-func Create(mediaProvider providers.MediaProvider) Leaser {
+// Create a leaser object, loading any leases that were
+// persisted in the given store. If store is nil, leases
+// are only kept in memory.
+func Create(mediaProvider providers.MediaProvider, store Store, options Options) (Leaser, error) {
 	l := &leaser{}
 	l.mediaProvider = mediaProvider
+	l.store = store
+	l.options = options
 	l.media = make([]*mediaLease, 0)
-	return l
+	l.emit = &emitter.Emitter{}
+	l.emit.Use("*", emitter.Void)
+	l.released = make(chan struct{})
+
+	if store != nil {
+		state, err := store.Load()
+		if err != nil {
+			return nil, err
+		}
+		l.restoring = state.Media
+		for _, storedLease := range state.InvalidatedLeases {
+			lease := &mediaLeaseItem{}
+			lease.leaseID = storedLease.LeaseID
+			lease.mediaItemID = storedLease.MediaID
+			lease.invalidated = time.Now()
+			if storedLease.Invalidated != nil {
+				lease.invalidated = *storedLease.Invalidated
+			}
+			l.invalidatedLeases = append(l.invalidatedLeases, lease)
+		}
+	}
+
+	return l, nil
+}
+
+// unlock Releases the lock, then emits the events that were queued while
+// it was held. Emitting waits for every observer, like a slow /events
+// client, which mustn't hold up everyone else.
+func (s *leaser) unlock() {
+	events := s.events
+	s.events = nil
+	s.lock.Unlock()
+	for _, event := range events {
+		s.emit.Emit("leaseRemoved", event)
+	}
 }
 
 func (s *leaser) MediaProvider() providers.MediaProvider {
@@ -49,7 +227,7 @@ func (s *leaser) MediaProvider() providers.MediaProvider {
 
 func (s *leaser) Leases() []Lease {
 	s.lock.Lock()
-	defer s.lock.Unlock()
+	defer s.unlock()
 
 	result := make([]Lease, 0)
 	for _, media := range s.media {
@@ -60,25 +238,137 @@ func (s *leaser) Leases() []Lease {
 	return result
 }
 
-func (s *leaser) Lease(mediaID string) (Lease, error) {
-	return s.LeaseDynamic(mediaID, func() (providers.MountSession, error) {
+// snapshot Copies the lease under the lock, its media
+// is taken away when the lease is invalidated.
+func (s *leaser) snapshot(lease *mediaLeaseItem) leaseSnapshot {
+	s.lock.Lock()
+	defer s.unlock()
+
+	snapshot := leaseSnapshot{
+		leaseID:   lease.leaseID,
+		mediaID:   lease.mediaItemID,
+		valid:     lease.media != nil,
+		expiresAt: lease.ExpiresAt(),
+		exclusive: lease.exclusive,
+	}
+	if lease.media != nil {
+		snapshot.mountPath = lease.media.Location()
+		snapshot.mountOptions = lease.media.mountOptions
+		snapshot.readOnly = lease.media.readOnly()
+	}
+	return snapshot
+}
+
+func (s *leaser) SetOptions(options Options) {
+	s.lock.Lock()
+	defer s.unlock()
+
+	s.options = options
+}
+
+func (s *leaser) SetRules(rules Rules) {
+	s.lock.Lock()
+	defer s.unlock()
+
+	s.rules = rules
+}
+
+func (s *leaser) Lease(mediaID string, options LeaseOptions) (Lease, error) {
+	media := s.mediaProvider.GetMediaByID(mediaID)
+	if media == nil {
+		return nil, providers.ErrIDNotFound
+	}
+	return s.LeaseDynamic(media, options, func() (providers.MountSession, error) {
+		mountOptions := options.MountOptions
+		if options.Access == AccessReadOnly {
+			mountOptions = append(append([]string{}, mountOptions...), "ro")
+		}
+		if mounter, ok := s.mediaProvider.(providers.OptionsMounter); ok {
+			session, err := mounter.MountWithOptions(mediaID, mountOptions)
+			if err == providers.ErrMountOptionsUnsupported && len(options.MountOptions) == 0 {
+				return nil, fmt.Errorf("the media can't be mounted read-only")
+			}
+			return session, err
+		}
+		if len(mountOptions) > 0 {
+			if len(options.MountOptions) == 0 {
+				return nil, fmt.Errorf("the media can't be mounted read-only")
+			}
+			return nil, providers.ErrMountOptionsUnsupported
+		}
 		return s.mediaProvider.Mount(mediaID)
 	})
 }
 
-func (s *leaser) LeaseDynamic(mediaID string, buildSession func() (providers.MountSession, error)) (Lease, error) {
+func validateLeaseOptions(options LeaseOptions) error {
+	if options.TTL < 0 {
+		return fmt.Errorf("the ttl can't be negative")
+	}
+	if options.Access != AccessAny && options.Access != AccessReadOnly && options.Access != AccessReadWrite {
+		return fmt.Errorf("invalid access %s, it must be ro or rw", options.Access)
+	}
+	if options.Mode != ModeShared && options.Mode != ModeExclusive {
+		return fmt.Errorf("invalid mode %s, it must be exclusive or empty", options.Mode)
+	}
+	if options.Wait < 0 {
+		return fmt.Errorf("the wait can't be negative")
+	}
+	if options.Wait > MaxWait {
+		return fmt.Errorf("the wait can't be longer than %s", MaxWait)
+	}
+	return nil
+}
+
+func (s *leaser) LeaseDynamic(mediaItem providers.Media, options LeaseOptions, buildSession func() (providers.MountSession, error)) (Lease, error) {
+	if err := validateLeaseOptions(options); err != nil {
+		return nil, err
+	}
+
 	s.lock.Lock()
-	defer s.lock.Unlock()
+	defer s.unlock()
+
+	if !s.rules.IsAllowed(mediaItem) {
+		return nil, fmt.Errorf("leasing this media isn't allowed")
+	}
+
+	mediaID := mediaItem.ID()
+
+	// If this media was mounted before we restarted,
+	// try to pick up the existing mount first.
+	s.restore(mediaID)
+
+	if err := s.waitForConflicts(mediaID, options); err != nil {
+		return nil, err
+	}
 
 	// Look for an existing mount for this media item.
+	for mediaIndex, media := range s.media {
+		if media.mediaID == mediaID && !media.allows(options.Access) {
+			if len(media.leases) > 0 {
+				if media.readOnly() {
+					return nil, fmt.Errorf("the media is mounted read-only for another lease")
+				}
+				return nil, fmt.Errorf("the media is mounted read-write for another lease")
+			}
+			// Nobody is using the mount anymore, so
+			// mount it again the way this lease needs.
+			err := media.MountSession.Release()
+			s.media = append(s.media[:mediaIndex], s.media[mediaIndex+1:]...)
+			s.save()
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
 	for _, media := range s.media {
 		if media.mediaID == mediaID {
+			if !hasMountOptions(media.mountOptions, options.MountOptions) {
+				return nil, fmt.Errorf("the media is already mounted with other options (%s)", strings.Join(media.mountOptions, ","))
+			}
 			// This item currently is mounted, just add a lease.
-			lease := &mediaLeaseItem{}
-			lease.media = media
-			lease.mediaItemID = mediaID
-			lease.leaseID = helpers.RandString(10)
-			media.leases = append(media.leases, lease)
+			lease := s.addLease(media, options)
+			s.save()
 			return lease, nil
 		}
 	}
@@ -92,21 +382,141 @@ func (s *leaser) LeaseDynamic(mediaID string, buildSession func() (providers.Mou
 	media := &mediaLease{}
 	media.mediaID = mediaID
 	media.MountSession = mountSession
+	if optionsSession, ok := mountSession.(providers.OptionsSession); ok {
+		media.mountOptions = optionsSession.MountOptions()
+	}
+	if !media.allows(options.Access) {
+		// The provider ignored the access, or can only mount read-only.
+		mountSession.Release()
+		if media.readOnly() {
+			return nil, fmt.Errorf("the media can only be mounted read-only")
+		}
+		return nil, fmt.Errorf("the media couldn't be mounted read-only")
+	}
 	s.media = append(s.media, media)
 
 	// Add one lease to the media item.
+	lease := s.addLease(media, options)
+	s.save()
+
+	return lease, nil
+}
+
+func (s *leaser) addLease(media *mediaLease, options LeaseOptions) *mediaLeaseItem {
 	lease := &mediaLeaseItem{}
 	lease.media = media
-	lease.mediaItemID = mediaID
+	lease.mediaItemID = media.mediaID
 	lease.leaseID = helpers.RandString(10)
+	lease.ttl = options.TTL
+	lease.exclusive = options.Mode == ModeExclusive
+	lease.lastRenewed = time.Now()
 	media.leases = append(media.leases, lease)
+	return lease
+}
 
-	return lease, nil
+// conflict Returns an error if a lease with the given
+// mode can't be held on the media right now. The lock must be held.
+func (s *leaser) conflict(mediaID string, mode Mode) error {
+	leased := false
+	exclusive := false
+	for _, media := range s.media {
+		if media.mediaID != mediaID {
+			continue
+		}
+		for _, lease := range media.leases {
+			leased = true
+			exclusive = exclusive || lease.exclusive
+		}
+	}
+	// The leases on mounts we haven't restored yet count too.
+	for _, stored := range s.restoring {
+		if stored.MediaID != mediaID {
+			continue
+		}
+		for _, lease := range stored.Leases {
+			leased = true
+			exclusive = exclusive || lease.Exclusive
+		}
+	}
+	if exclusive {
+		return ErrLeasedExclusively
+	}
+	if leased && mode == ModeExclusive {
+		return ErrAlreadyLeased
+	}
+	return nil
+}
+
+// waitForConflicts Waits up to options.Wait for the conflicting leases
+// to go away. The lock must be held, and is released while waiting.
+func (s *leaser) waitForConflicts(mediaID string, options LeaseOptions) error {
+	err := s.conflict(mediaID, options.Mode)
+	if err == nil || options.Wait == 0 {
+		return err
+	}
+
+	timeout := time.NewTimer(options.Wait)
+	defer timeout.Stop()
+	for err != nil {
+		released := s.released
+		s.unlock()
+		select {
+		case <-released:
+			s.lock.Lock()
+		case <-timeout.C:
+			s.lock.Lock()
+			return s.conflict(mediaID, options.Mode)
+		case <-options.Cancel:
+			s.lock.Lock()
+			return ErrWaitCanceled
+		}
+		err = s.conflict(mediaID, options.Mode)
+	}
+	return nil
+}
+
+// leaseReleased wakes up the leases waiting on a conflict. The lock must be held.
+func (s *leaser) leaseReleased() {
+	close(s.released)
+	s.released = make(chan struct{})
+	go s.retryPending()
+}
+
+func (s *leaser) Renew(leaseID string) error {
+	s.lock.Lock()
+	defer s.unlock()
+
+	for _, media := range s.media {
+		for _, lease := range media.leases {
+			if lease.ID() == leaseID {
+				lease.lastRenewed = time.Now()
+				return nil
+			}
+		}
+	}
+
+	// Leases waiting to be restored get a fresh
+	// ttl once they are, so there is nothing to do.
+	for _, stored := range s.restoring {
+		for _, lease := range stored.Leases {
+			if lease.LeaseID == leaseID {
+				return nil
+			}
+		}
+	}
+
+	for _, invalidatedLease := range s.invalidatedLeases {
+		if invalidatedLease.leaseID == leaseID {
+			return fmt.Errorf("the lease is no longer valid")
+		}
+	}
+
+	return fmt.Errorf("no lease with the given id")
 }
 
 func (s *leaser) Release(leaseID string) error {
 	s.lock.Lock()
-	defer s.lock.Unlock()
+	defer s.unlock()
 
 	// Look for an existing mount for this media item.
 	for _, media := range s.media {
@@ -114,6 +524,21 @@ func (s *leaser) Release(leaseID string) error {
 			if lease.ID() == leaseID {
 				media.leases = append(media.leases[:leaseIndex], media.leases[leaseIndex+1:]...)
 				media.lastClosedTime = time.Now()
+				s.leaseReleased()
+				s.save()
+				return nil
+			}
+		}
+	}
+
+	// The lease may be held on a mount that we haven't restored yet.
+	for storedIndex := range s.restoring {
+		stored := &s.restoring[storedIndex]
+		for leaseIndex, lease := range stored.Leases {
+			if lease.LeaseID == leaseID {
+				stored.Leases = append(stored.Leases[:leaseIndex], stored.Leases[leaseIndex+1:]...)
+				s.leaseReleased()
+				s.save()
 				return nil
 			}
 		}
@@ -125,6 +550,7 @@ func (s *leaser) Release(leaseID string) error {
 	for invalidatedLeaseIndex, invalidatedLease := range s.invalidatedLeases {
 		if invalidatedLease.leaseID == leaseID {
 			s.invalidatedLeases = append(s.invalidatedLeases[:invalidatedLeaseIndex], s.invalidatedLeases[invalidatedLeaseIndex+1:]...)
+			s.save()
 			return nil
 		}
 	}
@@ -138,6 +564,7 @@ func (s *leaser) Process(ctx context.Context) error {
 
 	// Every so often, clean up the leases.
 	ticker := helpers.Every(time.Millisecond*50, func(t time.Time) {
+		s.expireLeases()
 		s.cleanLeases()
 	})
 
@@ -151,18 +578,94 @@ func (s *leaser) Process(ctx context.Context) error {
 		}
 	}()
 
+	// Restore the mounts from a previous run as their media shows up.
+	addedIn, addedCancel := s.MediaProvider().MediaAddded()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for m := range addedIn {
+			// Restoring calls back into the provider, which may
+			// be blocked emitting another event to us.
+			go func(m providers.Media) {
+				s.mediaAdded(m.ID())
+				s.matchPending(m)
+			}(m)
+		}
+	}()
+	s.restoreAvailable()
+	restoreTimer := time.AfterFunc(s.options.RestoreTimeout, s.abandonRestore)
+
 	// Wait until the caller wants us to return.
 	<-ctx.Done()
 
 	close(ticker)
+	restoreTimer.Stop()
 	chCancel()
+	addedCancel()
+	wg.Wait()
 
 	return nil
 }
 
+func (s *leaser) LeaseRemoved() (<-chan LeaseEvent, func()) {
+	out := make(chan LeaseEvent)
+	in := s.emit.On("leaseRemoved", func(event *emitter.Event) {
+		out <- event.Args[0].(LeaseEvent)
+	})
+	cancel := func() {
+		s.emit.Off("leaseRemoved", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+// Reclaim the leases whose clients stopped renewing them,
+// and forget the invalidated leases that are old enough.
+func (s *leaser) expireLeases() {
+	s.lock.Lock()
+	defer s.unlock()
+
+	now := time.Now()
+	changed := false
+	for _, media := range s.media {
+		for leaseIndex := 0; leaseIndex < len(media.leases); leaseIndex++ {
+			lease := media.leases[leaseIndex]
+			if !lease.isExpired(now) {
+				continue
+			}
+			media.leases = append(media.leases[:leaseIndex], media.leases[leaseIndex+1:]...)
+			leaseIndex--
+			media.lastClosedTime = now
+			s.invalidateLease(lease, ReasonExpired)
+			changed = true
+		}
+	}
+	for len(s.invalidatedLeases) > 0 && now.Sub(s.invalidatedLeases[0].invalidated) > s.options.InvalidatedRetention {
+		s.invalidatedLeases = s.invalidatedLeases[1:]
+		changed = true
+	}
+	if changed {
+		s.save()
+	}
+}
+
+// invalidateLease keeps track of a lease that was removed without the
+// client releasing it, and lets observers know why once the lock is
+// released. The lock must be held.
+func (s *leaser) invalidateLease(lease *mediaLeaseItem, reason string) {
+	lease.media = nil
+	lease.invalidated = time.Now()
+	s.invalidatedLeases = append(s.invalidatedLeases, lease)
+	if len(s.invalidatedLeases) > maxInvalidatedLeases {
+		s.invalidatedLeases = s.invalidatedLeases[len(s.invalidatedLeases)-maxInvalidatedLeases:]
+	}
+	s.leaseReleased()
+	s.events = append(s.events, LeaseEvent{lease.leaseID, lease.mediaItemID, reason})
+}
+
 func (s *leaser) cleanLeases() error {
 	s.lock.Lock()
-	defer s.lock.Unlock()
+	defer s.unlock()
 
 	for mediaIndex := 0; mediaIndex < len(s.media); mediaIndex++ {
 		media := s.media[mediaIndex]
@@ -171,12 +674,13 @@ func (s *leaser) cleanLeases() error {
 			// Let's see if it has been closed for enough
 			// time to auto close it.
 			elapsed := time.Now().Sub(media.lastClosedTime)
-			if elapsed > time.Second*5 {
+			if elapsed > s.options.UnmountDelay {
 				// This mount has been stale, let's unmount
 				// and remove it.
 				err := media.MountSession.Release()
 				// Regardless of if it error'd or not, let's remove it.
 				s.media = append(s.media[:mediaIndex], s.media[mediaIndex+1:]...)
+				s.save()
 				// we deleted the current entry, so the "next" entry is actually at this same
 				// index, meaning we need the next iteration of the for loop to look at the same
 				// index... so we have to decrement mediaIndex by one
@@ -192,17 +696,17 @@ func (s *leaser) cleanLeases() error {
 
 func (s *leaser) deviceRemoved(mediaID string) {
 	s.lock.Lock()
-	defer s.lock.Unlock()
+	defer s.unlock()
 
 	// If there are any leases associated with this
 	// media item, we need to invalidate them.
 	for mediaIndex, media := range s.media {
 		if media.mediaID == mediaID {
 			for _, lease := range media.leases {
-				lease.media = nil
-				s.invalidatedLeases = append(s.invalidatedLeases, lease)
+				s.invalidateLease(lease, ReasonMediaRemoved)
 			}
 			s.media = append(s.media[:mediaIndex], s.media[mediaIndex+1:]...)
+			s.save()
 			return
 		}
 	}
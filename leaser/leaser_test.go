@@ -0,0 +1,566 @@
+package leaser
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pauldotknopf/automounter/helpers"
+	"github.com/pauldotknopf/automounter/providers"
+	"github.com/pauldotknopf/automounter/providers/fake"
+)
+
+// useTestMountRoot Points the mount root at a temporary
+// directory, and returns a function that removes it again.
+func useTestMountRoot(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "leaser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := helpers.MountRoot()
+	helpers.SetMountRoot(filepath.Join(dir, "mounts"))
+	return func() {
+		helpers.SetMountRoot(previous)
+		os.RemoveAll(dir)
+	}
+}
+
+func testOptions() Options {
+	return Options{
+		UnmountDelay:         time.Millisecond * 50,
+		RestoreTimeout:       time.Millisecond * 200,
+		InvalidatedRetention: time.Minute,
+	}
+}
+
+// startLeaser Creates a leaser and processes its leases
+// until the returned function is called.
+func startLeaser(t *testing.T, provider providers.MediaProvider, store Store, options Options) (Leaser, func()) {
+	l, err := Create(provider, store, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		l.Process(ctx)
+		close(done)
+	}()
+	// Give it a moment to start listening to the provider,
+	// the events sent before then are lost.
+	time.Sleep(time.Millisecond * 50)
+	return l, func() {
+		cancel()
+		<-done
+	}
+}
+
+func createTestLeaser(t *testing.T) (Leaser, fake.Provider, func()) {
+	cleanMountRoot := useTestMountRoot(t)
+	provider, err := fake.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, stop := startLeaser(t, provider, nil, testOptions())
+	return l, provider, func() {
+		stop()
+		cleanMountRoot()
+	}
+}
+
+func addTestMedia(t *testing.T, provider fake.Provider, options fake.Options) providers.Media {
+	media, err := provider.AddMedia(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return media
+}
+
+func waitFor(t *testing.T, description string, condition func() bool) {
+	deadline := time.Now().Add(time.Second * 3)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", description)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+// subscribeLeaseRemoved Like LeaseRemoved, but canceling doesn't
+// block on an event that nobody is reading anymore.
+func subscribeLeaseRemoved(l Leaser) (<-chan LeaseEvent, func()) {
+	events, cancel := l.LeaseRemoved()
+	return events, func() {
+		go func() {
+			for range events {
+			}
+		}()
+		cancel()
+	}
+}
+
+// waitForLeaseEvent Expiry is checked every second or so.
+func waitForLeaseEvent(t *testing.T, events <-chan LeaseEvent) LeaseEvent {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(time.Second * 3):
+		t.Fatal("timed out waiting for a removed lease")
+	}
+	return LeaseEvent{}
+}
+
+func TestLeaseAndRelease(t *testing.T) {
+	l, provider, cleanup := createTestLeaser(t)
+	defer cleanup()
+
+	media := addTestMedia(t, provider, fake.Options{Files: map[string]string{"hello.txt": "hello"}})
+
+	first, err := l.Lease(media.ID(), LeaseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(first.MountPath(), "hello.txt"))
+	if err != nil || string(content) != "hello" {
+		t.Fatalf("expected the media to be mounted, got %q, %v", content, err)
+	}
+
+	second, err := l.Lease(media.ID(), LeaseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.MountPath() != first.MountPath() {
+		t.Fatal("expected the leases to share the mount")
+	}
+	if len(l.Leases()) != 2 {
+		t.Fatalf("expected 2 leases, got %d", len(l.Leases()))
+	}
+
+	err = l.Release(first.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = l.Release(first.ID())
+	if err == nil {
+		t.Fatal("expected releasing twice to fail")
+	}
+
+	// Still held by the second lease.
+	time.Sleep(testOptions().UnmountDelay * 2)
+	if exists, _ := helpers.PathExists(first.MountPath()); !exists {
+		t.Fatal("expected the media to stay mounted")
+	}
+
+	err = l.Release(second.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the unmount", func() bool {
+		exists, _ := helpers.PathExists(first.MountPath())
+		return !exists
+	})
+}
+
+func TestLeaseErrors(t *testing.T) {
+	l, provider, cleanup := createTestLeaser(t)
+	defer cleanup()
+
+	media := addTestMedia(t, provider, fake.Options{})
+	failing := addTestMedia(t, provider, fake.Options{})
+	mountErr := errors.New("the stick is broken")
+	err := provider.SetFailures(failing.ID(), fake.Failures{Mount: mountErr})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		mediaID string
+		options LeaseOptions
+		err     string
+	}{
+		{"unknown media", "missing", LeaseOptions{}, providers.ErrIDNotFound.Error()},
+		{"mount failure", failing.ID(), LeaseOptions{}, mountErr.Error()},
+		{"negative ttl", media.ID(), LeaseOptions{TTL: -time.Second}, "the ttl can't be negative"},
+		{"bad access", media.ID(), LeaseOptions{Access: "rx"}, "invalid access rx"},
+		{"bad mode", media.ID(), LeaseOptions{Mode: "shared"}, "invalid mode shared"},
+		{"negative wait", media.ID(), LeaseOptions{Wait: -time.Second}, "the wait can't be negative"},
+		{"long wait", media.ID(), LeaseOptions{Wait: MaxWait + time.Second}, "the wait can't be longer than"},
+		{"read-only unsupported", media.ID(), LeaseOptions{Access: AccessReadOnly}, "the media can't be mounted read-only"},
+		{"options unsupported", media.ID(), LeaseOptions{MountOptions: []string{"noexec"}}, providers.ErrMountOptionsUnsupported.Error()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := l.Lease(test.mediaID, test.options)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected an error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+
+	if len(l.Leases()) != 0 {
+		t.Fatal("expected no leases")
+	}
+}
+
+func TestLeaseRules(t *testing.T) {
+	l, provider, cleanup := createTestLeaser(t)
+	defer cleanup()
+
+	media := addTestMedia(t, provider, fake.Options{Properties: map[string]string{"label": "SECRET"}})
+
+	l.SetRules(Rules{Deny: []Rule{{Properties: map[string]string{"label": "SECRET"}}}})
+	_, err := l.Lease(media.ID(), LeaseOptions{})
+	if err == nil {
+		t.Fatal("expected denied media to not be leased")
+	}
+
+	l.SetRules(Rules{})
+	_, err = l.Lease(media.ID(), LeaseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLeaseTTL(t *testing.T) {
+	l, provider, cleanup := createTestLeaser(t)
+	defer cleanup()
+
+	events, cancelEvents := subscribeLeaseRemoved(l)
+	defer cancelEvents()
+
+	media := addTestMedia(t, provider, fake.Options{})
+
+	renewed, err := l.Lease(media.ID(), LeaseOptions{TTL: time.Millisecond * 300})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewed.ExpiresAt().IsZero() {
+		t.Fatal("expected the lease to expire")
+	}
+	expiring, err := l.Lease(media.ID(), LeaseOptions{TTL: time.Millisecond * 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forever, err := l.Lease(media.ID(), LeaseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !forever.ExpiresAt().IsZero() {
+		t.Fatal("expected the lease without a ttl to never expire")
+	}
+
+	stopRenewing := make(chan struct{})
+	renewing := make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case <-stopRenewing:
+				renewing <- nil
+				return
+			case <-time.After(time.Millisecond * 50):
+				if err := l.Renew(renewed.ID()); err != nil {
+					renewing <- err
+					return
+				}
+			}
+		}
+	}()
+
+	event := waitForLeaseEvent(t, events)
+	close(stopRenewing)
+	if err := <-renewing; err != nil {
+		t.Fatalf("expected the renewed lease to be kept, got %v", err)
+	}
+	if event.LeaseID != expiring.ID() || event.Reason != ReasonExpired {
+		t.Fatalf("expected the lease to expire, got %+v", event)
+	}
+	if expiring.IsValid() {
+		t.Fatal("expected the expired lease to be invalid")
+	}
+	if err := l.Renew(expiring.ID()); err == nil || !strings.Contains(err.Error(), "no longer valid") {
+		t.Fatalf("expected renewing the expired lease to fail, got %v", err)
+	}
+	if !renewed.IsValid() || !forever.IsValid() {
+		t.Fatal("expected the other leases to still be valid")
+	}
+}
+
+func TestInvalidatedRetention(t *testing.T) {
+	cleanMountRoot := useTestMountRoot(t)
+	defer cleanMountRoot()
+
+	storeDir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(storeDir)
+	store := CreateFileStore(filepath.Join(storeDir, "leases.json"))
+
+	provider, err := fake.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := testOptions()
+	options.InvalidatedRetention = time.Millisecond * 500
+	l, stop := startLeaser(t, provider, store, options)
+	defer stop()
+
+	events, cancelEvents := subscribeLeaseRemoved(l)
+	defer cancelEvents()
+
+	media := addTestMedia(t, provider, fake.Options{})
+	lease, err := l.Lease(media.ID(), LeaseOptions{TTL: time.Millisecond * 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForLeaseEvent(t, events)
+
+	if err := l.Renew(lease.ID()); err == nil || !strings.Contains(err.Error(), "no longer valid") {
+		t.Fatalf("expected the lease to be remembered, got %v", err)
+	}
+	state, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.InvalidatedLeases) != 1 || state.InvalidatedLeases[0].Invalidated == nil {
+		t.Fatalf("expected the invalidated lease to be stored, got %+v", state.InvalidatedLeases)
+	}
+
+	waitFor(t, "the lease to be forgotten", func() bool {
+		err := l.Renew(lease.ID())
+		return err != nil && strings.Contains(err.Error(), "no lease with the given id")
+	})
+	state, err = store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.InvalidatedLeases) != 0 {
+		t.Fatalf("expected the forgotten lease to not be stored, got %+v", state.InvalidatedLeases)
+	}
+}
+
+func TestInvalidatedLimit(t *testing.T) {
+	l, provider, cleanup := createTestLeaser(t)
+	defer cleanup()
+
+	events, cancelEvents := subscribeLeaseRemoved(l)
+	defer cancelEvents()
+
+	media := addTestMedia(t, provider, fake.Options{})
+	leases := make([]Lease, 0)
+	for i := 0; i < maxInvalidatedLeases+10; i++ {
+		lease, err := l.Lease(media.ID(), LeaseOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		leases = append(leases, lease)
+	}
+
+	err := provider.RemoveMedia(media.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range leases {
+		waitForLeaseEvent(t, events)
+	}
+
+	// The oldest are forgotten first.
+	if err := l.Renew(leases[9].ID()); err == nil || !strings.Contains(err.Error(), "no lease with the given id") {
+		t.Fatalf("expected the oldest lease to be forgotten, got %v", err)
+	}
+	if err := l.Renew(leases[10].ID()); err == nil || !strings.Contains(err.Error(), "no longer valid") {
+		t.Fatalf("expected the newer lease to be remembered, got %v", err)
+	}
+}
+
+func TestLeaseMediaRemoved(t *testing.T) {
+	l, provider, cleanup := createTestLeaser(t)
+	defer cleanup()
+
+	events, cancelEvents := subscribeLeaseRemoved(l)
+	defer cancelEvents()
+
+	media := addTestMedia(t, provider, fake.Options{})
+	lease, err := l.Lease(media.ID(), LeaseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = provider.RemoveMedia(media.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := waitForLeaseEvent(t, events)
+	if event.LeaseID != lease.ID() || event.Reason != ReasonMediaRemoved {
+		t.Fatalf("expected the lease to be removed with the media, got %+v", event)
+	}
+	if lease.IsValid() {
+		t.Fatal("expected the lease to be invalid")
+	}
+	// The client can still let go of it.
+	if err := l.Release(lease.ID()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLeaseRestore(t *testing.T) {
+	cleanMountRoot := useTestMountRoot(t)
+	defer cleanMountRoot()
+
+	storeDir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(storeDir)
+	store := CreateFileStore(filepath.Join(storeDir, "leases.json"))
+
+	provider, err := fake.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := addTestMedia(t, provider, fake.Options{})
+	unplugged := addTestMedia(t, provider, fake.Options{})
+
+	l, stop := startLeaser(t, provider, store, testOptions())
+	keptLease, err := l.Lease(kept.ID(), LeaseOptions{TTL: time.Minute, Mode: ModeExclusive})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unpluggedLease, err := l.Lease(unplugged.ID(), LeaseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Like the daemon being killed, the mounts stay.
+	stop()
+
+	err = provider.RemoveMedia(unplugged.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, stop = startLeaser(t, provider, store, testOptions())
+	defer stop()
+
+	events, cancelEvents := subscribeLeaseRemoved(l)
+	defer cancelEvents()
+
+	waitFor(t, "the restored lease", func() bool {
+		for _, lease := range l.Leases() {
+			if lease.ID() == keptLease.ID() {
+				return lease.MountPath() == keptLease.MountPath() && lease.Exclusive()
+			}
+		}
+		return false
+	})
+	if err := l.Renew(keptLease.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Lease(kept.ID(), LeaseOptions{}); err != ErrLeasedExclusively {
+		t.Fatalf("expected the restored lease to still be exclusive, got %v", err)
+	}
+
+	event := waitForLeaseEvent(t, events)
+	if event.LeaseID != unpluggedLease.ID() || event.Reason != ReasonRestoreFailed {
+		t.Fatalf("expected the lease on the unplugged media to fail to restore, got %+v", event)
+	}
+}
+
+func TestExclusiveLeases(t *testing.T) {
+	tests := []struct {
+		name   string
+		first  Mode
+		second Mode
+		err    error
+	}{
+		{"shared after shared", ModeShared, ModeShared, nil},
+		{"exclusive after shared", ModeShared, ModeExclusive, ErrAlreadyLeased},
+		{"shared after exclusive", ModeExclusive, ModeShared, ErrLeasedExclusively},
+		{"exclusive after exclusive", ModeExclusive, ModeExclusive, ErrLeasedExclusively},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l, provider, cleanup := createTestLeaser(t)
+			defer cleanup()
+
+			media := addTestMedia(t, provider, fake.Options{})
+			first, err := l.Lease(media.ID(), LeaseOptions{Mode: test.first})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first.Exclusive() != (test.first == ModeExclusive) {
+				t.Fatal("unexpected exclusive")
+			}
+			_, err = l.Lease(media.ID(), LeaseOptions{Mode: test.second})
+			if err != test.err {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+
+			// Once it is released, anything goes.
+			err = l.Release(first.ID())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.err != nil {
+				_, err = l.Lease(media.ID(), LeaseOptions{Mode: test.second})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestLeaseWait(t *testing.T) {
+	tests := []struct {
+		name    string
+		wait    time.Duration
+		release bool
+		cancel  bool
+		err     error
+	}{
+		{"released", time.Second * 2, true, false, nil},
+		{"timed out", time.Millisecond * 100, false, false, ErrLeasedExclusively},
+		{"canceled", time.Second * 2, false, true, ErrWaitCanceled},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l, provider, cleanup := createTestLeaser(t)
+			defer cleanup()
+
+			media := addTestMedia(t, provider, fake.Options{})
+			held, err := l.Lease(media.ID(), LeaseOptions{Mode: ModeExclusive})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cancel := make(chan struct{})
+			go func() {
+				time.Sleep(time.Millisecond * 50)
+				if test.release {
+					l.Release(held.ID())
+				}
+				if test.cancel {
+					close(cancel)
+				}
+			}()
+
+			lease, err := l.Lease(media.ID(), LeaseOptions{Mode: ModeExclusive, Wait: test.wait, Cancel: cancel})
+			if err != test.err {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+			if err == nil && !lease.Exclusive() {
+				t.Fatal("expected the lease to be exclusive")
+			}
+		})
+	}
+}
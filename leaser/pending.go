@@ -0,0 +1,299 @@
+package leaser
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/pauldotknopf/automounter/helpers"
+	"github.com/pauldotknopf/automounter/providers"
+)
+
+var (
+	// ErrMediaTimeout No matching media showed up before the timeout
+	ErrMediaTimeout = errors.New("no matching media showed up in time")
+	// ErrPendingCanceled The pending lease was canceled before media showed up
+	ErrPendingCanceled = errors.New("the pending lease was canceled")
+	// ErrTooManyPending There are already MaxPendingLeases waiting for media
+	ErrTooManyPending = errors.New("too many leases are already waiting for media")
+)
+
+// MaxPendingLeases How many leases can wait for media at once
+const MaxPendingLeases = 64
+
+// How long a finished pending lease is kept around,
+// so that clients polling for it can pick up the result.
+const pendingRetention = time.Minute * 5
+
+// PendingLease A lease waiting for media that matches a selector
+type PendingLease interface {
+	ID() string
+	Selector() Selector
+	// Closed once the lease was made, or it failed
+	Done() <-chan struct{}
+	// The lease, nil until it was made
+	Lease() Lease
+	// A copy of the lease as it is now, that stays safe to read
+	// once the lease is invalidated. nil until it was made
+	Snapshot() Lease
+	// Why no lease was made, nil until it failed
+	Err() error
+}
+
+type pendingLease struct {
+	leaser   *leaser
+	id       string
+	selector Selector
+	options  LeaseOptions
+	// Set while we are mounting media for it,
+	// so nobody else picks it up.
+	claimed  bool
+	canceled bool
+	expired  bool
+	timer    *time.Timer
+	done     chan struct{}
+	// Only set before done is closed
+	lease Lease
+	err   error
+}
+
+func (s *pendingLease) ID() string {
+	return s.id
+}
+
+func (s *pendingLease) Selector() Selector {
+	return s.selector
+}
+
+func (s *pendingLease) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *pendingLease) Lease() Lease {
+	select {
+	case <-s.done:
+		return s.lease
+	default:
+		return nil
+	}
+}
+
+func (s *pendingLease) Snapshot() Lease {
+	lease, ok := s.Lease().(*mediaLeaseItem)
+	if !ok {
+		return nil
+	}
+	return s.leaser.snapshot(lease)
+}
+
+func (s *pendingLease) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+func (s *leaser) LeaseWhenAvailable(selector Selector, options LeaseOptions, timeout time.Duration) (PendingLease, error) {
+	if err := selector.Validate(); err != nil {
+		return nil, err
+	}
+	if err := validateLeaseOptions(options); err != nil {
+		return nil, err
+	}
+	if timeout < 0 {
+		return nil, fmt.Errorf("the timeout can't be negative")
+	}
+
+	pending := &pendingLease{}
+	pending.leaser = s
+	pending.id = helpers.RandString(10)
+	pending.selector = selector
+	pending.options = options
+	pending.done = make(chan struct{})
+
+	s.pendingLock.Lock()
+	waiting := 0
+	for _, item := range s.pending {
+		select {
+		case <-item.done:
+		default:
+			waiting++
+		}
+	}
+	if waiting >= MaxPendingLeases {
+		s.pendingLock.Unlock()
+		return nil, ErrTooManyPending
+	}
+	s.pending = append(s.pending, pending)
+	if timeout > 0 {
+		pending.timer = time.AfterFunc(timeout, func() {
+			s.pendingLock.Lock()
+			defer s.pendingLock.Unlock()
+			if pending.claimed {
+				// Decided once the lease is made.
+				pending.expired = true
+				return
+			}
+			s.finishPending(pending, nil, ErrMediaTimeout)
+		})
+	}
+	s.pendingLock.Unlock()
+
+	// The media may already be here. It was registered
+	// first, so we won't miss media that shows up now.
+	for _, media := range s.mediaProvider.GetMedia() {
+		s.matchPending(media)
+		select {
+		case <-pending.done:
+			return pending, nil
+		default:
+		}
+	}
+
+	return pending, nil
+}
+
+func (s *leaser) PendingLeases() []PendingLease {
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+
+	result := make([]PendingLease, 0)
+	for _, pending := range s.pending {
+		result = append(result, pending)
+	}
+	return result
+}
+
+func (s *leaser) CancelPending(pendingID string) error {
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+
+	for _, pending := range s.pending {
+		if pending.id != pendingID {
+			continue
+		}
+		select {
+		case <-pending.done:
+			// Too late, give the lease back.
+			if pending.lease != nil {
+				return s.Release(pending.lease.ID())
+			}
+			return nil
+		default:
+		}
+		if pending.claimed {
+			// The lease is released once it is made.
+			pending.canceled = true
+			return nil
+		}
+		s.finishPending(pending, nil, ErrPendingCanceled)
+		return nil
+	}
+
+	return fmt.Errorf("no pending lease with the given id")
+}
+
+// retryPending Gives the pending leases that lost out on
+// media to another lease another try at it.
+func (s *leaser) retryPending() {
+	s.pendingLock.Lock()
+	waiting := false
+	for _, pending := range s.pending {
+		select {
+		case <-pending.done:
+		default:
+			waiting = waiting || !pending.claimed
+		}
+	}
+	s.pendingLock.Unlock()
+	if !waiting {
+		return
+	}
+
+	for _, media := range s.mediaProvider.GetMedia() {
+		s.matchPending(media)
+	}
+}
+
+// matchPending Leases the media for every pending lease waiting for it.
+func (s *leaser) matchPending(media providers.Media) {
+	s.lock.Lock()
+	allowed := s.rules.IsAllowed(media)
+	s.unlock()
+	if !allowed {
+		return
+	}
+
+	s.pendingLock.Lock()
+	claimed := make([]*pendingLease, 0)
+	for _, pending := range s.pending {
+		if pending.claimed || !pending.selector.Matches(media) {
+			continue
+		}
+		select {
+		case <-pending.done:
+			continue
+		default:
+		}
+		pending.claimed = true
+		claimed = append(claimed, pending)
+	}
+	s.pendingLock.Unlock()
+
+	for _, pending := range claimed {
+		s.leasePending(pending, media)
+	}
+}
+
+func (s *leaser) leasePending(pending *pendingLease, media providers.Media) {
+	lease, err := s.Lease(media.ID(), pending.options)
+
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+	if pending.canceled {
+		if err == nil {
+			s.Release(lease.ID())
+		}
+		s.finishPending(pending, nil, ErrPendingCanceled)
+		return
+	}
+	if err == ErrLeasedExclusively || err == ErrAlreadyLeased {
+		if pending.expired {
+			s.finishPending(pending, nil, ErrMediaTimeout)
+			return
+		}
+		// Someone else got to it first, wait for other media.
+		pending.claimed = false
+		return
+	}
+	if err != nil {
+		logrus.Warnf("couldn't lease media %s for pending lease %s: %+v", media.ID(), pending.id, err)
+	}
+	s.finishPending(pending, lease, err)
+}
+
+// finishPending Hands out the result, and forgets the pending lease
+// after a while. The pending lock must be held.
+func (s *leaser) finishPending(pending *pendingLease, lease Lease, err error) {
+	if pending.timer != nil {
+		pending.timer.Stop()
+	}
+	pending.lease = lease
+	pending.err = err
+	close(pending.done)
+
+	time.AfterFunc(pendingRetention, func() {
+		s.pendingLock.Lock()
+		defer s.pendingLock.Unlock()
+		for pendingIndex, item := range s.pending {
+			if item == pending {
+				s.pending = append(s.pending[:pendingIndex], s.pending[pendingIndex+1:]...)
+				return
+			}
+		}
+	})
+}
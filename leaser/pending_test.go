@@ -0,0 +1,264 @@
+package leaser
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pauldotknopf/automounter/providers/fake"
+)
+
+func waitForPending(t *testing.T, pending PendingLease) {
+	select {
+	case <-pending.Done():
+	case <-time.After(time.Second * 3):
+		t.Fatal("timed out waiting for the pending lease")
+	}
+}
+
+func isDone(pending PendingLease) bool {
+	select {
+	case <-pending.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestLeaseWhenAvailable(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing map[string]string
+		added    map[string]string
+		selector Selector
+		timeout  time.Duration
+		err      error
+	}{
+		{"already there", map[string]string{"label": "BACKUP"}, nil, Selector{Label: "BACKUP"}, 0, nil},
+		{"shows up", nil, map[string]string{"label": "BACKUP"}, Selector{Label: "BACK*"}, 0, nil},
+		{"other media shows up", map[string]string{"label": "DATA"}, map[string]string{"label": "BACKUP"}, Selector{Label: "BACKUP"}, 0, nil},
+		{"never shows up", map[string]string{"label": "DATA"}, nil, Selector{Label: "BACKUP"}, time.Millisecond * 100, ErrMediaTimeout},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l, provider, cleanup := createTestLeaser(t)
+			defer cleanup()
+
+			if test.existing != nil {
+				addTestMedia(t, provider, fake.Options{ID: "existing", Properties: test.existing})
+			}
+			pending, err := l.LeaseWhenAvailable(test.selector, LeaseOptions{}, test.timeout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.added != nil {
+				if test.existing != nil && isDone(pending) {
+					t.Fatal("expected the pending lease to not match the existing media")
+				}
+				addTestMedia(t, provider, fake.Options{ID: "added", Properties: test.added})
+			}
+
+			waitForPending(t, pending)
+			if pending.Err() != test.err {
+				t.Fatalf("expected %v, got %v", test.err, pending.Err())
+			}
+			if test.err != nil {
+				if pending.Lease() != nil {
+					t.Fatal("expected no lease")
+				}
+				return
+			}
+			lease := pending.Lease()
+			expected := "existing"
+			if test.added != nil {
+				expected = "added"
+			}
+			if lease == nil || lease.MediaID() != expected || !lease.IsValid() {
+				t.Fatalf("expected a lease on the %s media", expected)
+			}
+		})
+	}
+}
+
+func TestLeaseWhenAvailableErrors(t *testing.T) {
+	l, _, cleanup := createTestLeaser(t)
+	defer cleanup()
+
+	tests := []struct {
+		name     string
+		selector Selector
+		options  LeaseOptions
+		timeout  time.Duration
+	}{
+		{"bad selector", Selector{Label: "["}, LeaseOptions{}, 0},
+		{"bad options", Selector{}, LeaseOptions{Mode: "shared"}, 0},
+		{"negative timeout", Selector{}, LeaseOptions{}, -time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := l.LeaseWhenAvailable(test.selector, test.options, test.timeout)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+
+	if len(l.PendingLeases()) != 0 {
+		t.Fatal("expected nothing to be waiting")
+	}
+}
+
+func TestCancelPending(t *testing.T) {
+	l, provider, cleanup := createTestLeaser(t)
+	defer cleanup()
+
+	pending, err := l.LeaseWhenAvailable(Selector{Label: "BACKUP"}, LeaseOptions{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.PendingLeases()) != 1 {
+		t.Fatal("expected the lease to be pending")
+	}
+
+	err = l.CancelPending(pending.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForPending(t, pending)
+	if pending.Err() != ErrPendingCanceled {
+		t.Fatalf("expected %v, got %v", ErrPendingCanceled, pending.Err())
+	}
+
+	// Canceled leases don't pick up media.
+	addTestMedia(t, provider, fake.Options{Properties: map[string]string{"label": "BACKUP"}})
+	time.Sleep(time.Millisecond * 50)
+	if len(l.Leases()) != 0 {
+		t.Fatal("expected no leases")
+	}
+
+	if err := l.CancelPending("missing"); err == nil {
+		t.Fatal("expected canceling an unknown pending lease to fail")
+	}
+}
+
+func TestCancelPendingAfterLease(t *testing.T) {
+	l, provider, cleanup := createTestLeaser(t)
+	defer cleanup()
+
+	addTestMedia(t, provider, fake.Options{})
+	pending, err := l.LeaseWhenAvailable(Selector{}, LeaseOptions{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForPending(t, pending)
+	if pending.Lease() == nil {
+		t.Fatalf("expected a lease, got %v", pending.Err())
+	}
+
+	// Too late to stop waiting, so the lease is given back.
+	err = l.CancelPending(pending.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Leases()) != 0 {
+		t.Fatal("expected the lease to be released")
+	}
+}
+
+func TestPendingLeaseLimit(t *testing.T) {
+	l, _, cleanup := createTestLeaser(t)
+	defer cleanup()
+
+	var first PendingLease
+	for i := 0; i < MaxPendingLeases; i++ {
+		pending, err := l.LeaseWhenAvailable(Selector{Label: "BACKUP"}, LeaseOptions{}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first == nil {
+			first = pending
+		}
+	}
+
+	_, err := l.LeaseWhenAvailable(Selector{Label: "BACKUP"}, LeaseOptions{}, 0)
+	if err != ErrTooManyPending {
+		t.Fatalf("expected %v, got %v", ErrTooManyPending, err)
+	}
+
+	// Finished leases don't count.
+	err = l.CancelPending(first.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = l.LeaseWhenAvailable(Selector{Label: "BACKUP"}, LeaseOptions{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPendingExclusiveLease(t *testing.T) {
+	l, provider, cleanup := createTestLeaser(t)
+	defer cleanup()
+
+	media := addTestMedia(t, provider, fake.Options{})
+	held, err := l.Lease(media.ID(), LeaseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := l.LeaseWhenAvailable(Selector{}, LeaseOptions{Mode: ModeExclusive}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 50)
+	if isDone(pending) {
+		t.Fatalf("expected the pending lease to wait for the other lease, got %v", pending.Err())
+	}
+
+	err = l.Release(held.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForPending(t, pending)
+	if pending.Err() != nil {
+		t.Fatal(pending.Err())
+	}
+	if !pending.Lease().Exclusive() {
+		t.Fatal("expected the lease to be exclusive")
+	}
+}
+
+func TestPendingLeaseExpired(t *testing.T) {
+	l, provider, cleanup := createTestLeaser(t)
+	defer cleanup()
+
+	events, cancelEvents := subscribeLeaseRemoved(l)
+	defer cancelEvents()
+
+	media := addTestMedia(t, provider, fake.Options{})
+	pending, err := l.LeaseWhenAvailable(Selector{}, LeaseOptions{TTL: time.Millisecond * 100}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForPending(t, pending)
+	snapshot := pending.Snapshot()
+	if snapshot == nil || !snapshot.IsValid() || len(snapshot.MountPath()) == 0 {
+		t.Fatalf("expected a lease, got %v", pending.Err())
+	}
+
+	event := waitForLeaseEvent(t, events)
+	if event.Reason != ReasonExpired {
+		t.Fatalf("expected the lease to expire, got %+v", event)
+	}
+
+	// The finished pending lease is still listed.
+	pendingLeases := l.PendingLeases()
+	if len(pendingLeases) != 1 {
+		t.Fatalf("expected the pending lease to be kept, got %d", len(pendingLeases))
+	}
+	snapshot = pendingLeases[0].Snapshot()
+	if snapshot.IsValid() || snapshot.ID() != event.LeaseID || snapshot.MediaID() != media.ID() || len(snapshot.MountPath()) != 0 {
+		t.Fatalf("expected an invalidated lease on %s, got %+v", media.ID(), snapshot)
+	}
+}
@@ -0,0 +1,142 @@
+package leaser
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/pauldotknopf/automounter/helpers"
+	"github.com/pauldotknopf/automounter/providers"
+)
+
+func (s *leaser) RecoverStaleMounts() error {
+	s.lock.Lock()
+	defer s.unlock()
+
+	exists, err := helpers.PathExists(helpers.MountRoot())
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+
+	mounts, err := helpers.GetMounts()
+	if err != nil {
+		return err
+	}
+
+	// The mounts we are still holding leases on are
+	// restored once their media shows up again.
+	keep := make(map[string]bool)
+	for _, media := range s.media {
+		keep[media.Location()] = true
+	}
+	for _, stored := range s.restoring {
+		keep[filepath.Clean(stored.MountPath)] = true
+	}
+	restoring := len(keep)
+
+	adopter, _ := s.mediaProvider.(providers.MountAdopter)
+
+	adopted := 0
+	unmounted := 0
+	failed := 0
+	for _, mount := range mounts {
+		if !helpers.IsUnderMountRoot(mount.MountPoint) || keep[mount.MountPoint] {
+			continue
+		}
+		if adopter != nil {
+			if mediaID, session := adopter.AdoptMount(mount); session != nil {
+				// Nobody holds a lease on it, so treat it like any
+				// other unused mount, it is unmounted after the
+				// delay unless a lease picks it up before then.
+				media := &mediaLease{}
+				media.mediaID = mediaID
+				media.MountSession = session
+				media.lastClosedTime = time.Now()
+				s.media = append(s.media, media)
+				logrus.Infof("adopted stale %s mount of %s at %s", mount.FSType, mount.Source, mount.MountPoint)
+				keep[mount.MountPoint] = true
+				adopted++
+				continue
+			}
+		}
+		err = helpers.LazyUnmount(mount.MountPoint)
+		if err != nil {
+			logrus.Errorf("couldn't unmount stale %s mount of %s at %s: %+v", mount.FSType, mount.Source, mount.MountPoint, err)
+			keep[mount.MountPoint] = true
+			failed++
+			continue
+		}
+		logrus.Infof("unmounted stale %s mount of %s at %s", mount.FSType, mount.Source, mount.MountPoint)
+		unmounted++
+	}
+	if adopted > 0 {
+		s.save()
+	}
+
+	// Clean up the directories that aren't used anymore.
+	removed := 0
+	entries, err := ioutil.ReadDir(helpers.MountRoot())
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(helpers.MountRoot(), entry.Name())
+		if keep[path] {
+			continue
+		}
+		if entry.Mode()&os.ModeSymlink != 0 {
+			// Unprivileged mounts of the local provider, removing
+			// the link doesn't touch what it points to.
+			err = os.Remove(path)
+			if err != nil {
+				logrus.Warnf("couldn't remove stale mount link %s: %+v", path, err)
+				continue
+			}
+			removed++
+			continue
+		}
+		if !entry.IsDir() {
+			continue
+		}
+		// This only removes empty directories, we never
+		// want to delete anything that may be user data.
+		err = os.Remove(path)
+		if err != nil {
+			logrus.Warnf("couldn't remove stale mount directory %s: %+v", path, err)
+			continue
+		}
+		removed++
+	}
+
+	logrus.Infof("stale mount recovery: %d kept for restoring, %d adopted, %d unmounted, %d failed, %d directories removed", restoring, adopted, unmounted, failed, removed)
+
+	return nil
+}
+
+// releaseStaleMount unmounts a mount that we couldn't
+// restore, so that it doesn't linger under the mount root.
+func (s *leaser) releaseStaleMount(mountPath string) {
+	if !helpers.IsUnderMountRoot(mountPath) {
+		// Not one of ours (udisks), the provider takes care of it.
+		return
+	}
+	isMounted, err := helpers.IsMountPoint(mountPath)
+	if err != nil {
+		logrus.Warnf("couldn't check stale mount %s: %+v", mountPath, err)
+		return
+	}
+	if isMounted {
+		err = helpers.LazyUnmount(mountPath)
+		if err != nil {
+			logrus.Warnf("couldn't unmount stale mount %s: %+v", mountPath, err)
+			return
+		}
+	}
+	os.Remove(mountPath)
+}
@@ -0,0 +1,71 @@
+package leaser
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pauldotknopf/automounter/helpers"
+	"github.com/pauldotknopf/automounter/providers/fake"
+)
+
+func TestRecoverStaleMounts(t *testing.T) {
+	cleanMountRoot := useTestMountRoot(t)
+	defer cleanMountRoot()
+
+	provider, err := fake.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := Create(provider, nil, testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing to do without a mount root.
+	err = l.RecoverStaleMounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := helpers.MountRoot()
+	empty := filepath.Join(root, "empty")
+	link := filepath.Join(root, "link")
+	data := filepath.Join(root, "data")
+	for _, dir := range []string{empty, data} {
+		err = os.MkdirAll(dir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = ioutil.WriteFile(filepath.Join(data, "file.txt"), []byte("keep me"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(data, link)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = l.RecoverStaleMounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path   string
+		exists bool
+	}{
+		{empty, false},
+		{link, false},
+		{data, true},
+		{filepath.Join(data, "file.txt"), true},
+	}
+	for _, test := range tests {
+		_, err := os.Lstat(test.path)
+		if exists := err == nil; exists != test.exists {
+			t.Errorf("expected %s to exist: %v", test.path, test.exists)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package leaser
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/pauldotknopf/automounter/providers"
+)
+
+func (s *leaser) mediaAdded(mediaID string) {
+	s.lock.Lock()
+	defer s.unlock()
+
+	s.restore(mediaID)
+}
+
+// Restore the mounts for any media that
+// was already present when we started.
+func (s *leaser) restoreAvailable() {
+	s.lock.Lock()
+	defer s.unlock()
+
+	mediaIDs := make([]string, 0)
+	for _, stored := range s.restoring {
+		mediaIDs = append(mediaIDs, stored.MediaID)
+	}
+	for _, mediaID := range mediaIDs {
+		if s.mediaProvider.GetMediaByID(mediaID) != nil {
+			s.restore(mediaID)
+		}
+	}
+}
+
+// Any mounts that weren't restored by now belong to
+// media that vanished while we were down.
+func (s *leaser) abandonRestore() {
+	s.lock.Lock()
+	defer s.unlock()
+
+	if len(s.restoring) == 0 {
+		return
+	}
+
+	for _, stored := range s.restoring {
+		logrus.Warnf("media %s didn't come back after restarting, invalidating %d lease(s)", stored.MediaID, len(stored.Leases))
+		s.invalidateStored(stored)
+		s.releaseStaleMount(stored.MountPath)
+	}
+	s.restoring = nil
+	s.save()
+}
+
+// restore re-attaches a mount from a previous run
+// to its media. The lock must be held.
+func (s *leaser) restore(mediaID string) {
+	for storedIndex, stored := range s.restoring {
+		if stored.MediaID != mediaID {
+			continue
+		}
+
+		s.restoring = append(s.restoring[:storedIndex], s.restoring[storedIndex+1:]...)
+
+		session, err := s.restoreSession(stored)
+		if err != nil {
+			logrus.Warnf("couldn't restore mount for media %s at %s: %+v", stored.MediaID, stored.MountPath, err)
+			s.invalidateStored(stored)
+			s.releaseStaleMount(stored.MountPath)
+			s.save()
+			return
+		}
+
+		media := &mediaLease{}
+		media.mediaID = stored.MediaID
+		media.MountSession = session
+		media.mountOptions = stored.MountOptions
+		for _, storedLease := range stored.Leases {
+			lease := &mediaLeaseItem{}
+			lease.media = media
+			lease.mediaItemID = storedLease.MediaID
+			lease.leaseID = storedLease.LeaseID
+			lease.ttl = storedLease.TTL
+			lease.exclusive = storedLease.Exclusive
+			// We can't hold it against the client that we
+			// were down, so start the ttl from scratch.
+			lease.lastRenewed = time.Now()
+			media.leases = append(media.leases, lease)
+		}
+		// If every lease was released while we were
+		// restoring, let the mount get cleaned up.
+		media.lastClosedTime = time.Now()
+		s.media = append(s.media, media)
+
+		logrus.Infof("restored mount for media %s at %s with %d lease(s)", stored.MediaID, session.Location(), len(media.leases))
+		s.save()
+		return
+	}
+}
+
+func (s *leaser) restoreSession(stored StoredMedia) (providers.MountSession, error) {
+	restorer, ok := s.mediaProvider.(providers.MountRestorer)
+	if !ok {
+		return nil, fmt.Errorf("the media provider can't restore mounts")
+	}
+	return restorer.RestoreMount(stored.MediaID, stored.MountPath)
+}
+
+func (s *leaser) invalidateStored(stored StoredMedia) {
+	for _, storedLease := range stored.Leases {
+		lease := &mediaLeaseItem{}
+		lease.leaseID = storedLease.LeaseID
+		lease.mediaItemID = storedLease.MediaID
+		s.invalidateLease(lease, ReasonRestoreFailed)
+	}
+}
+
+// save persists the current leases. The lock must be held.
+func (s *leaser) save() {
+	if s.store == nil {
+		return
+	}
+
+	var state StoreState
+	state.Media = make([]StoredMedia, 0)
+	state.InvalidatedLeases = make([]StoredLease, 0)
+
+	for _, media := range s.media {
+		stored := StoredMedia{}
+		stored.MediaID = media.mediaID
+		stored.MountPath = media.Location()
+		stored.MountOptions = media.mountOptions
+		stored.Leases = make([]StoredLease, 0)
+		for _, lease := range media.leases {
+			stored.Leases = append(stored.Leases, StoredLease{lease.leaseID, lease.mediaItemID, lease.ttl, lease.exclusive, nil})
+		}
+		state.Media = append(state.Media, stored)
+	}
+	// Keep the mounts we haven't restored yet, so
+	// we don't lose them if we restart again.
+	state.Media = append(state.Media, s.restoring...)
+	for _, lease := range s.invalidatedLeases {
+		invalidated := lease.invalidated
+		state.InvalidatedLeases = append(state.InvalidatedLeases, StoredLease{lease.leaseID, lease.mediaItemID, 0, false, &invalidated})
+	}
+
+	err := s.store.Save(state)
+	if err != nil {
+		logrus.Errorf("couldn't persist leases: %+v", err)
+	}
+}
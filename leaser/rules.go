@@ -0,0 +1,60 @@
+package leaser
+
+import (
+	"path"
+
+	"github.com/pauldotknopf/automounter/providers"
+)
+
+// Rule Matches media by its provider and properties. Empty fields
+// match anything, and values can use shell patterns ("sd*").
+type Rule struct {
+	Provider   string
+	Properties map[string]string
+}
+
+// Rules Decides which media is allowed to be leased
+type Rules struct {
+	Allow []Rule
+	Deny  []Rule
+}
+
+// IsAllowed Media is allowed if it isn't denied, and either
+// there are no allow rules, or one of them matches.
+func (s Rules) IsAllowed(media providers.Media) bool {
+	for _, rule := range s.Deny {
+		if rule.matches(media) {
+			return false
+		}
+	}
+	if len(s.Allow) == 0 {
+		return true
+	}
+	for _, rule := range s.Allow {
+		if rule.matches(media) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Rule) matches(media providers.Media) bool {
+	if len(s.Provider) > 0 && s.Provider != media.Provider() {
+		return false
+	}
+	if len(s.Properties) == 0 {
+		return true
+	}
+	properties := media.Properties()
+	for key, pattern := range s.Properties {
+		value, ok := properties[key]
+		if !ok {
+			return false
+		}
+		matched, err := path.Match(pattern, value)
+		if err != nil || !matched {
+			return false
+		}
+	}
+	return true
+}
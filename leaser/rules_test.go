@@ -0,0 +1,44 @@
+package leaser
+
+import (
+	"testing"
+
+	"github.com/pauldotknopf/automounter/providers/fake"
+)
+
+func TestRulesIsAllowed(t *testing.T) {
+	provider, err := fake.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	media, err := provider.AddMedia(fake.Options{Properties: map[string]string{"vendor": "SanDisk", "label": "BACKUP"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		rules   Rules
+		allowed bool
+	}{
+		{"no rules", Rules{}, true},
+		{"allowed provider", Rules{Allow: []Rule{{Provider: "fake"}}}, true},
+		{"other provider", Rules{Allow: []Rule{{Provider: "udisks"}}}, false},
+		{"allowed pattern", Rules{Allow: []Rule{{Properties: map[string]string{"vendor": "San*"}}}}, true},
+		{"every property must match", Rules{Allow: []Rule{{Properties: map[string]string{"vendor": "San*", "label": "DATA"}}}}, false},
+		{"missing property", Rules{Allow: []Rule{{Properties: map[string]string{"serial": "*"}}}}, false},
+		{"any allow rule", Rules{Allow: []Rule{{Provider: "udisks"}, {Provider: "fake"}}}, true},
+		{"denied", Rules{Deny: []Rule{{Properties: map[string]string{"label": "BACKUP"}}}}, false},
+		{"deny wins", Rules{Allow: []Rule{{Provider: "fake"}}, Deny: []Rule{{Provider: "fake"}}}, false},
+		{"other denied", Rules{Deny: []Rule{{Provider: "udisks"}}}, true},
+		{"bad pattern", Rules{Allow: []Rule{{Properties: map[string]string{"vendor": "["}}}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if allowed := test.rules.IsAllowed(media); allowed != test.allowed {
+				t.Fatalf("expected allowed to be %v", test.allowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package leaser
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+
+	"github.com/pauldotknopf/automounter/providers"
+)
+
+// Selector Picks out media that doesn't exist yet. Empty fields
+// match anything, and values can use shell patterns ("SanDisk*").
+type Selector struct {
+	Provider string
+	// The filesystem uuid
+	UUID   string
+	Label  string
+	Vendor string
+	Serial string
+	// In bytes, zero for no limit
+	MinSize uint64
+	MaxSize uint64
+}
+
+// Validate Returns an error if the selector can never match
+func (s Selector) Validate() error {
+	for _, pattern := range []string{s.Provider, s.UUID, s.Label, s.Vendor, s.Serial} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %s", pattern)
+		}
+	}
+	if s.MaxSize > 0 && s.MinSize > s.MaxSize {
+		return fmt.Errorf("the min size can't be larger than the max size")
+	}
+	return nil
+}
+
+// Matches Returns true if the media is what the selector is looking for
+func (s Selector) Matches(media providers.Media) bool {
+	if !matchPattern(s.Provider, media.Provider()) {
+		return false
+	}
+	properties := media.Properties()
+	if !matchPattern(s.UUID, properties["uuid"]) ||
+		!matchPattern(s.Label, properties["label"]) ||
+		!matchPattern(s.Vendor, properties["vendor"]) ||
+		!matchPattern(s.Serial, properties["serial"]) {
+		return false
+	}
+	if s.MinSize > 0 || s.MaxSize > 0 {
+		size, err := strconv.ParseUint(properties["size"], 10, 64)
+		if err != nil {
+			return false
+		}
+		if size < s.MinSize || (s.MaxSize > 0 && size > s.MaxSize) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchPattern(pattern string, value string) bool {
+	if len(pattern) == 0 {
+		return true
+	}
+	matched, err := path.Match(pattern, value)
+	return err == nil && matched
+}
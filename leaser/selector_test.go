@@ -0,0 +1,84 @@
+package leaser
+
+import (
+	"testing"
+
+	"github.com/pauldotknopf/automounter/providers/fake"
+)
+
+func TestSelectorMatches(t *testing.T) {
+	provider, err := fake.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	media, err := provider.AddMedia(fake.Options{Properties: map[string]string{
+		"uuid":   "1234-ABCD",
+		"label":  "BACKUP",
+		"vendor": "SanDisk",
+		"serial": "4C530001",
+		"size":   "16000000000",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsized, err := provider.AddMedia(fake.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		selector Selector
+		matches  bool
+	}{
+		{"empty", Selector{}, true},
+		{"provider", Selector{Provider: "fake"}, true},
+		{"other provider", Selector{Provider: "udisks"}, false},
+		{"label", Selector{Label: "BACKUP"}, true},
+		{"label pattern", Selector{Label: "BACK*"}, true},
+		{"other label", Selector{Label: "DATA"}, false},
+		{"uuid", Selector{UUID: "1234-ABCD"}, true},
+		{"vendor and serial", Selector{Vendor: "San*", Serial: "4C53*"}, true},
+		{"other serial", Selector{Vendor: "San*", Serial: "0000*"}, false},
+		{"min size", Selector{MinSize: 8000000000}, true},
+		{"too small", Selector{MinSize: 32000000000}, false},
+		{"max size", Selector{MaxSize: 32000000000}, true},
+		{"too large", Selector{MaxSize: 8000000000}, false},
+		{"size range", Selector{MinSize: 8000000000, MaxSize: 16000000000}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if matches := test.selector.Matches(media); matches != test.matches {
+				t.Fatalf("expected matches to be %v", test.matches)
+			}
+		})
+	}
+
+	if (Selector{MinSize: 1}).Matches(unsized) {
+		t.Fatal("expected media without a size to not match a size limit")
+	}
+}
+
+func TestSelectorValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector Selector
+		valid    bool
+	}{
+		{"empty", Selector{}, true},
+		{"patterns", Selector{Label: "BACK*", Vendor: "San?isk"}, true},
+		{"bad pattern", Selector{Serial: "["}, false},
+		{"sizes", Selector{MinSize: 1, MaxSize: 2}, true},
+		{"no max size", Selector{MinSize: 2}, true},
+		{"min size over max size", Selector{MinSize: 2, MaxSize: 1}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.selector.Validate(); (err == nil) != test.valid {
+				t.Fatalf("expected valid to be %v, got %v", test.valid, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package leaser
+
+import (
+	"time"
+
+	"github.com/pauldotknopf/automounter/helpers"
+)
+
+// Store Persists the leases so that they survive restarts
+type Store interface {
+	Load() (StoreState, error)
+	Save(state StoreState) error
+}
+
+// StoreState The persisted state of the leaser
+type StoreState struct {
+	Media             []StoredMedia `json:"media"`
+	InvalidatedLeases []StoredLease `json:"invalidatedLeases"`
+}
+
+// StoredMedia A mounted media item and the leases held on it
+type StoredMedia struct {
+	MediaID   string        `json:"mediaId"`
+	MountPath string        `json:"mountPath"`
+	Leases    []StoredLease `json:"leases"`
+	// The options it was mounted with, if known
+	MountOptions []string `json:"mountOptions,omitempty"`
+}
+
+// StoredLease A single persisted lease
+type StoredLease struct {
+	LeaseID string        `json:"leaseId"`
+	MediaID string        `json:"mediaId"`
+	TTL     time.Duration `json:"ttl"`
+	// No other lease may be held on the media
+	Exclusive bool `json:"exclusive,omitempty"`
+	// When an invalidated lease was removed
+	Invalidated *time.Time `json:"invalidated,omitempty"`
+}
+
+type fileStore struct {
+	path string
+}
+
+// CreateFileStore Create a store that persists leases as JSON in the given file
+func CreateFileStore(path string) Store {
+	return &fileStore{path}
+}
+
+func (s *fileStore) Load() (StoreState, error) {
+	var result StoreState
+	_, err := helpers.ReadJSONFile(s.path, &result)
+	return result, err
+}
+
+func (s *fileStore) Save(state StoreState) error {
+	return helpers.WriteJSONFile(s.path, state, 0600)
+}
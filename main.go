@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"os"
 
@@ -10,13 +11,24 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/wercker/journalhook"
 
+	"github.com/pauldotknopf/automounter/config"
+	"github.com/pauldotknopf/automounter/helpers"
 	"github.com/pauldotknopf/automounter/leaser"
 	"github.com/pauldotknopf/automounter/utils/appcontext"
 
+	"github.com/pauldotknopf/automounter/providers"
+	execprovider "github.com/pauldotknopf/automounter/providers/exec"
+	"github.com/pauldotknopf/automounter/providers/fake"
+	"github.com/pauldotknopf/automounter/providers/image"
 	"github.com/pauldotknopf/automounter/providers/ios"
+	"github.com/pauldotknopf/automounter/providers/local"
+	"github.com/pauldotknopf/automounter/providers/mtp"
 	"github.com/pauldotknopf/automounter/providers/muxer"
+	"github.com/pauldotknopf/automounter/providers/nfs"
 	"github.com/pauldotknopf/automounter/providers/smb"
+	"github.com/pauldotknopf/automounter/providers/sshfs"
 	"github.com/pauldotknopf/automounter/providers/udisks"
+	"github.com/pauldotknopf/automounter/providers/webdav"
 	"github.com/pauldotknopf/automounter/web"
 	"golang.org/x/sync/errgroup"
 )
@@ -25,29 +37,188 @@ var eg errgroup.Group
 
 func main() {
 
+	// Catch SIGHUP right away. Until it is caught, a reload
+	// kills us, like one sent while the providers are starting.
+	reloads := appcontext.Reloads()
+
+	configPath := flag.String("config", "", "the path to the config file")
+	flag.Parse()
+
 	if journal.Enabled() {
 		logrus.AddHook(&journalhook.JournalHook{})
 	}
 
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+	if *fakeMode {
+		cfg = fakeConfig(cfg)
+	}
+
+	helpers.SetMountRoot(cfg.MountRoot)
+
 	ctx, cancel := context.WithCancel(appcontext.Context())
 
-	udisksProvider, err := udisks.Create()
+	enabledProviders := make([]providers.MediaProvider, 0)
+	var udisksProvider udisks.Provider
+	if cfg.Providers.Udisks.Enabled {
+		var udisksOptions udisks.ProviderOptions
+		udisksOptions.MountOptions = cfg.Providers.Udisks.MountOptions
+		udisksOptions.FSMountOptions = cfg.Providers.Udisks.FSMountOptions
+		udisksProvider, err = udisks.Create(udisksOptions)
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		enabledProviders = append(enabledProviders, udisksProvider)
+	}
+	if cfg.Providers.IOS.Enabled {
+		iosProvider, err := ios.Create(cfg.Providers.IOS.AppID)
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		enabledProviders = append(enabledProviders, iosProvider)
+	}
+	if cfg.Providers.MTP.Enabled {
+		var mtpOptions mtp.ProviderOptions
+		mtpOptions.PollInterval = cfg.Providers.MTP.PollInterval
+		mtpProvider, err := mtp.Create(mtpOptions)
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		enabledProviders = append(enabledProviders, mtpProvider)
+	}
+	var smbProvider smb.Provider
+	if cfg.Providers.SMB.Enabled {
+		var smbOptions smb.ProviderOptions
+		smbOptions.RegistryPath = cfg.Providers.SMB.RegistryPath
+		smbOptions.SecretsPath = cfg.Providers.SMB.SecretsPath
+		smbOptions.HealthInterval = cfg.Providers.SMB.HealthInterval
+		smbOptions.HealthTimeout = cfg.Providers.SMB.HealthTimeout
+		smbOptions.Remount = cfg.Providers.SMB.Remount
+		smbOptions.TicketCacheDir = cfg.Providers.SMB.TicketCacheDir
+		smbOptions.TicketLifetime = cfg.Providers.SMB.TicketLifetime
+		smbOptions.KeytabDir = cfg.Providers.SMB.KeytabDir
+		smbProvider, err = smb.Create(smbOptions)
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		enabledProviders = append(enabledProviders, smbProvider)
+	}
+	var nfsProvider nfs.Provider
+	if cfg.Providers.NFS.Enabled {
+		var nfsOptions nfs.ProviderOptions
+		nfsOptions.RegistryPath = cfg.Providers.NFS.RegistryPath
+		nfsProvider, err = nfs.Create(nfsOptions)
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		enabledProviders = append(enabledProviders, nfsProvider)
+	}
+	var sshfsProvider sshfs.Provider
+	if cfg.Providers.SSHFS.Enabled {
+		var sshfsOptions sshfs.ProviderOptions
+		sshfsOptions.RegistryPath = cfg.Providers.SSHFS.RegistryPath
+		sshfsOptions.SecretsPath = cfg.Providers.SSHFS.SecretsPath
+		sshfsOptions.StateDir = cfg.Providers.SSHFS.StateDir
+		sshfsProvider, err = sshfs.Create(sshfsOptions)
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		enabledProviders = append(enabledProviders, sshfsProvider)
+	}
+	var webdavProvider webdav.Provider
+	if cfg.Providers.WebDAV.Enabled {
+		var webdavOptions webdav.ProviderOptions
+		webdavOptions.RegistryPath = cfg.Providers.WebDAV.RegistryPath
+		webdavOptions.SecretsPath = cfg.Providers.WebDAV.SecretsPath
+		webdavOptions.StateDir = cfg.Providers.WebDAV.StateDir
+		webdavProvider, err = webdav.Create(webdavOptions)
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		enabledProviders = append(enabledProviders, webdavProvider)
+	}
+	var imageProvider image.Provider
+	if cfg.Providers.Image.Enabled {
+		var imageOptions image.ProviderOptions
+		imageOptions.RegistryPath = cfg.Providers.Image.RegistryPath
+		imageOptions.Directories = cfg.Providers.Image.Directories
+		imageProvider, err = image.Create(imageOptions)
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		enabledProviders = append(enabledProviders, imageProvider)
+	}
+	var localProvider local.Provider
+	if cfg.Providers.Local.Enabled {
+		localProvider, err = local.Create()
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		enabledProviders = append(enabledProviders, localProvider)
+	}
+	for _, plugin := range cfg.Providers.Exec.Plugins {
+		var pluginOptions execprovider.ProviderOptions
+		pluginOptions.Name = plugin.Name
+		pluginOptions.Path = plugin.Path
+		pluginOptions.Args = plugin.Args
+		pluginOptions.Env = plugin.Env
+		pluginOptions.Timeout = plugin.Timeout
+		pluginProvider, err := execprovider.Create(pluginOptions)
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		enabledProviders = append(enabledProviders, pluginProvider)
+	}
+	var fakeProvider fake.Provider
+	if *fakeMode {
+		fakeProvider, err = fake.Create()
+		if err == nil {
+			err = addDemoMedia(fakeProvider)
+		}
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		enabledProviders = append(enabledProviders, fakeProvider)
+	}
+	mediaProvider := muxer.Create(enabledProviders...)
+
+	var leaseStore leaser.Store
+	if len(cfg.Leases.StorePath) > 0 {
+		leaseStore = leaser.CreateFileStore(cfg.Leases.StorePath)
+	}
+	leaser, err := leaser.Create(mediaProvider, leaseStore, buildLeaserOptions(cfg))
 	if err != nil {
 		log.Println(err)
 		os.Exit(1)
 	}
-	iosProvider, err := ios.Create()
+
+	err = applyConfig(cfg, leaser, smbProvider, localProvider)
 	if err != nil {
 		log.Println(err)
 		os.Exit(1)
 	}
-	smbProvider, err := smb.Create()
+
+	// Before we make any new mounts, deal with the
+	// ones we left behind if we crashed.
+	err = leaser.RecoverStaleMounts()
 	if err != nil {
 		log.Println(err)
 		os.Exit(1)
 	}
-	mediaProvider := muxer.Create(udisksProvider, iosProvider, smbProvider)
-	leaser := leaser.Create(mediaProvider)
 
 	// Start the processing of leases.
 	eg.Go(func() error {
@@ -69,10 +240,25 @@ func main() {
 		return nil
 	})
 
+	// Apply config changes when we are asked to.
+	running := cfg
+	eg.Go(func() error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-reloads:
+				daemon.SdNotify(false, "RELOADING=1")
+				running = reloadConfig(*configPath, running, leaser, smbProvider, localProvider)
+				daemon.SdNotify(false, "READY=1")
+			}
+		}
+	})
+
 	// Start the web API.
 	eg.Go(func() error {
-		server := web.Create(leaser, smbProvider)
-		serverErr := server.Listen(ctx, 3000, func() {
+		server := web.Create(leaser, web.Providers{Udisks: udisksProvider, SMB: smbProvider, NFS: nfsProvider, SSHFS: sshfsProvider, WebDAV: webdavProvider, Image: imageProvider, Fake: fakeProvider}, cfg.AdminToken)
+		serverErr := server.Listen(ctx, cfg.Listen, func() {
 			// We have started listening for requests.
 			daemon.SdNotify(false, "READY=1")
 		})
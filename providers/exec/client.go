@@ -0,0 +1,239 @@
+package exec
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	osexec "os/exec"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// How long a plugin has to exit after its stdin is closed.
+const exitTimeout = time.Second * 5
+
+// client A running plugin
+type client struct {
+	name       string
+	cmd        *osexec.Cmd
+	stdin      io.WriteCloser
+	timeout    time.Duration
+	writeMutex sync.Mutex
+	mutex      sync.Mutex
+	nextID     int
+	pending    map[int]chan rpcMessage
+	// The notifications that weren't handled yet. They are handled
+	// on their own goroutine, so that a slow handler doesn't hold
+	// up the responses.
+	notifications []rpcMessage
+	notified      chan struct{}
+	dispatched    chan struct{}
+	// Closed when the plugin exited.
+	done chan struct{}
+	err  error
+}
+
+// startClient Starts the plugin. Notifications are
+// handled one at a time, in the order they are received.
+func startClient(options ProviderOptions, notify func(rpcMessage)) (*client, error) {
+	cmd := osexec.Command(options.Path, options.Args...)
+	cmd.Env = append(os.Environ(), options.Env...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't start plugin %s: %v", options.Name, err)
+	}
+
+	c := &client{}
+	c.name = options.Name
+	c.cmd = cmd
+	c.stdin = stdin
+	c.timeout = options.Timeout
+	c.pending = make(map[int]chan rpcMessage)
+	c.done = make(chan struct{})
+	c.notified = make(chan struct{}, 1)
+	c.dispatched = make(chan struct{})
+
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(stderrDone)
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			logrus.Infof("plugin %s: %s", c.name, scanner.Text())
+		}
+	}()
+
+	go c.dispatch(notify)
+
+	go func() {
+		readErr := c.read(stdout)
+		if readErr != nil {
+			// Nobody reads its output anymore, so it would
+			// block writing to it, and never exit.
+			cmd.Process.Kill()
+		}
+		// Wait closes the pipes, all reads must be done by then.
+		<-stderrDone
+		waitErr := cmd.Wait()
+		c.mutex.Lock()
+		if readErr != nil {
+			c.err = readErr
+		} else if waitErr != nil {
+			c.err = waitErr
+		} else {
+			c.err = fmt.Errorf("plugin %s exited", c.name)
+		}
+		c.mutex.Unlock()
+		close(c.done)
+	}()
+
+	return c, nil
+}
+
+func (s *client) read(stdout io.Reader) error {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var message rpcMessage
+		err := json.Unmarshal(scanner.Bytes(), &message)
+		if err != nil {
+			logrus.Warnf("plugin %s sent an invalid message: %v", s.name, err)
+			continue
+		}
+
+		if message.ID == nil {
+			if len(message.Method) > 0 {
+				s.mutex.Lock()
+				s.notifications = append(s.notifications, message)
+				s.mutex.Unlock()
+				select {
+				case s.notified <- struct{}{}:
+				default:
+				}
+			}
+			continue
+		}
+
+		s.mutex.Lock()
+		response, ok := s.pending[*message.ID]
+		delete(s.pending, *message.ID)
+		s.mutex.Unlock()
+		if !ok {
+			logrus.Warnf("plugin %s answered unknown request %d", s.name, *message.ID)
+			continue
+		}
+		response <- message
+	}
+	return scanner.Err()
+}
+
+func (s *client) dispatch(notify func(rpcMessage)) {
+	defer close(s.dispatched)
+	for {
+		select {
+		case <-s.notified:
+		case <-s.done:
+			return
+		}
+		for {
+			s.mutex.Lock()
+			if len(s.notifications) == 0 {
+				s.mutex.Unlock()
+				break
+			}
+			message := s.notifications[0]
+			s.notifications = s.notifications[1:]
+			s.mutex.Unlock()
+			notify(message)
+		}
+	}
+}
+
+// call Sends a request and waits for its response. The result is
+// decoded into result, unless it is nil.
+func (s *client) call(method string, params interface{}, result interface{}) error {
+	response := make(chan rpcMessage, 1)
+
+	s.mutex.Lock()
+	s.nextID++
+	id := s.nextID
+	s.pending[id] = response
+	s.mutex.Unlock()
+
+	cancel := func() {
+		s.mutex.Lock()
+		delete(s.pending, id)
+		s.mutex.Unlock()
+	}
+
+	data, err := json.Marshal(rpcRequest{jsonRPCVersion, id, method, params})
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	s.writeMutex.Lock()
+	_, err = s.stdin.Write(append(data, '\n'))
+	s.writeMutex.Unlock()
+	if err != nil {
+		cancel()
+		return fmt.Errorf("couldn't send %s to plugin %s: %v", method, s.name, err)
+	}
+
+	select {
+	case message := <-response:
+		if message.Error != nil {
+			return message.Error
+		}
+		if result != nil && len(message.Result) > 0 {
+			err = json.Unmarshal(message.Result, result)
+			if err != nil {
+				return fmt.Errorf("plugin %s sent an invalid %s result: %v", s.name, method, err)
+			}
+		}
+		return nil
+	case <-s.done:
+		cancel()
+		return s.exitErr()
+	case <-time.After(s.timeout):
+		cancel()
+		return fmt.Errorf("plugin %s didn't answer %s within %v", s.name, method, s.timeout)
+	}
+}
+
+func (s *client) exitErr() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.err
+}
+
+// close Asks the plugin to exit by closing its stdin,
+// and kills it if it doesn't.
+func (s *client) close() {
+	s.stdin.Close()
+	select {
+	case <-s.done:
+	case <-time.After(exitTimeout):
+		logrus.Warnf("plugin %s didn't exit, killing it", s.name)
+		s.cmd.Process.Kill()
+		<-s.done
+	}
+	<-s.dispatched
+}
@@ -0,0 +1,153 @@
+package exec
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The shell functions of the test plugins, to answer the requests.
+const testPluginPrelude = `#!/bin/sh
+id() { echo "$1" | sed 's/^{"jsonrpc":"2.0","id":\([0-9]*\).*/\1/'; }
+method() { echo "$1" | sed 's/.*"method":"\([a-zA-Z]*\)".*/\1/'; }
+`
+
+// startTestClient Starts a plugin running the given shell script.
+func startTestClient(t *testing.T, script string, timeout time.Duration, notify func(rpcMessage)) *client {
+	dir, err := ioutil.TempDir("", "exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "plugin")
+	err = ioutil.WriteFile(path, []byte(testPluginPrelude+script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if notify == nil {
+		notify = func(rpcMessage) {}
+	}
+	c, err := startClient(ProviderOptions{Name: "test", Path: path, Timeout: timeout}, notify)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.close)
+	return c
+}
+
+func TestClientCall(t *testing.T) {
+	c := startTestClient(t, `
+while read -r line; do
+	case $(method "$line") in
+	list) echo '{"jsonrpc":"2.0","id":'$(id "$line")',"result":[{"id":"a","displayName":"A"}]}' ;;
+	*) echo '{"jsonrpc":"2.0","id":'$(id "$line")',"error":{"code":-32000,"message":"no such media"}}' ;;
+	esac
+done
+`, time.Second*5, nil)
+
+	var media []pluginMedia
+	err := c.call("list", nil, &media)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(media) != 1 || media[0].ID != "a" || media[0].DisplayName != "A" {
+		t.Fatalf("unexpected result %+v", media)
+	}
+
+	err = c.call("mount", mountParams{ID: "b", MountPath: "/mnt"}, nil)
+	rpcErr, ok := err.(*rpcError)
+	if !ok || rpcErr.Code != notFoundCode || rpcErr.Message != "no such media" {
+		t.Fatalf("expected the error of the plugin, got %v", err)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	// Reads the requests, but never answers them.
+	c := startTestClient(t, "cat > /dev/null\n", time.Millisecond*200, nil)
+
+	err := c.call("list", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "didn't answer list within 200ms") {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.pending) != 0 {
+		t.Fatal("expected the request to be forgotten")
+	}
+}
+
+func TestClientExit(t *testing.T) {
+	// Exits after reading the first request, without answering it.
+	c := startTestClient(t, "read -r line\nexit 3\n", time.Second*5, nil)
+
+	start := time.Now()
+	err := c.call("list", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Fatalf("expected the exit of the plugin, got %v", err)
+	}
+	if time.Since(start) > time.Second*2 {
+		t.Fatal("expected the call to fail when the plugin exits, not to time out")
+	}
+
+	// Calls after the exit fail right away too.
+	err = c.call("list", nil, nil)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestClientNotifications(t *testing.T) {
+	var mutex sync.Mutex
+	var received []string
+	release := make(chan struct{})
+	c := startTestClient(t, `
+while read -r line; do
+	if [ "$(method "$line")" = "watch" ]; then
+		for i in 1 2 3 4 5 6 7 8 9 10; do
+			echo '{"jsonrpc":"2.0","method":"mediaAdded","params":{"id":"'$i'"}}'
+		done
+	fi
+	echo '{"jsonrpc":"2.0","id":'$(id "$line")',"result":null}'
+done
+`, time.Second*5, func(message rpcMessage) {
+		// A slow handler doesn't hold up the responses.
+		<-release
+		mutex.Lock()
+		received = append(received, string(message.Params))
+		mutex.Unlock()
+	})
+
+	err := c.call("watch", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.call("list", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+
+	expected := make([]string, 0)
+	for i := 1; i <= 10; i++ {
+		expected = append(expected, fmt.Sprintf(`{"id":"%d"}`, i))
+	}
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		mutex.Lock()
+		actual := strings.Join(received, " ")
+		mutex.Unlock()
+		if actual == strings.Join(expected, " ") {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the notifications in order, got %s", actual)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
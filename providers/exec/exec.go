@@ -0,0 +1,488 @@
+package exec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/olebedev/emitter"
+	"github.com/sirupsen/logrus"
+
+	"github.com/pauldotknopf/automounter/helpers"
+	"github.com/pauldotknopf/automounter/providers"
+)
+
+const (
+	defaultTimeout = time.Minute
+	// How long we wait before starting a plugin that exited,
+	// doubled every time it exits quickly.
+	minRestartDelay = time.Second
+	maxRestartDelay = time.Second * 30
+)
+
+// ProviderOptions The plugin to run
+type ProviderOptions struct {
+	// Used as the provider name, and in the ids of the media
+	Name string
+	Path string
+	Args []string
+	// Added to the environment of the plugin, "KEY=value"
+	Env []string
+	// How long the plugin has to answer a request
+	Timeout time.Duration
+}
+
+type execProvider struct {
+	options ProviderOptions
+	// Guards the media and mounts. It is never held
+	// while waiting for the plugin.
+	mutex  sync.Mutex
+	media  []*execMedia
+	mounts []*execMount
+	client *client
+	// The media that changed since we asked for the list,
+	// so that the list doesn't overwrite them.
+	syncing bool
+	changed map[string]bool
+	// Serializes the mounting and unmounting.
+	mountMutex sync.Mutex
+	emit       *emitter.Emitter
+}
+
+// Create a media provider that runs the given plugin
+func Create(options ProviderOptions) (providers.MediaProvider, error) {
+	if len(options.Name) == 0 {
+		return nil, fmt.Errorf("the plugin needs a name")
+	}
+	if len(options.Path) == 0 {
+		return nil, fmt.Errorf("no path given for plugin %s", options.Name)
+	}
+	if options.Timeout == 0 {
+		options.Timeout = defaultTimeout
+	}
+
+	p := &execProvider{}
+	p.options = options
+	p.emit = &emitter.Emitter{}
+	p.emit.Use("*", emitter.Void)
+	return p, nil
+}
+
+func (s *execProvider) Name() string {
+	return s.options.Name
+}
+
+func (s *execProvider) Start(ctx context.Context) error {
+	delay := minRestartDelay
+	for {
+		started := time.Now()
+		err := s.run(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		s.dropAll()
+
+		if time.Since(started) > maxRestartDelay {
+			delay = minRestartDelay
+		}
+		logrus.Errorf("plugin %s stopped, restarting it in %v: %v", s.options.Name, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		delay = delay * 2
+		if delay > maxRestartDelay {
+			delay = maxRestartDelay
+		}
+	}
+}
+
+// run Runs the plugin until it exits or we are cancelled.
+func (s *execProvider) run(ctx context.Context) error {
+	client, err := startClient(s.options, s.notification)
+	if err != nil {
+		return err
+	}
+	defer client.close()
+
+	s.mutex.Lock()
+	s.client = client
+	s.syncing = true
+	s.changed = make(map[string]bool)
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		s.client = nil
+		s.mutex.Unlock()
+	}()
+
+	err = client.call("watch", nil, nil)
+	if err != nil {
+		return err
+	}
+
+	var list []pluginMedia
+	err = client.call("list", nil, &list)
+	if err != nil {
+		return err
+	}
+	s.sync(list)
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-client.done:
+		return client.exitErr()
+	}
+}
+
+func (s *execProvider) GetMedia() []providers.Media {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := make([]providers.Media, 0)
+	for _, media := range s.media {
+		result = append(result, media)
+	}
+	return result
+}
+
+func (s *execProvider) GetMediaByID(id string) providers.Media {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	media := s.getMedia(id)
+	if media == nil {
+		return nil
+	}
+	return media
+}
+
+func (s *execProvider) Mount(id string) (providers.MountSession, error) {
+	s.mountMutex.Lock()
+	defer s.mountMutex.Unlock()
+
+	s.mutex.Lock()
+	media := s.getMedia(id)
+	if media == nil {
+		s.mutex.Unlock()
+		return nil, providers.ErrIDNotFound
+	}
+	// Check to see if the media is already mounted
+	for _, mount := range s.mounts {
+		if mount.id == id {
+			s.mutex.Unlock()
+			return &execMount{id, mount.mountPath, s}, nil
+		}
+	}
+	client := s.client
+	s.mutex.Unlock()
+
+	if client == nil {
+		return nil, fmt.Errorf("plugin %s isn't running", s.options.Name)
+	}
+
+	mountPath, err := helpers.GetTmpMountPath()
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.call("mount", mountParams{media.pluginID, mountPath}, nil)
+	if err != nil {
+		os.Remove(mountPath)
+		return nil, s.convertError(err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.getMedia(id) == nil {
+		// Removed while we were mounting it,
+		// the plugin cleans up after itself.
+		os.Remove(mountPath)
+		return nil, providers.ErrIDNotFound
+	}
+
+	mount := &execMount{id, mountPath, s}
+	s.mounts = append(s.mounts, mount)
+	s.emit.Emit("mediaMounted", id)
+	return mount, nil
+}
+
+func (s *execProvider) Unmount(id string) error {
+	s.mountMutex.Lock()
+	defer s.mountMutex.Unlock()
+
+	s.mutex.Lock()
+	mount := s.getMount(id)
+	if mount == nil {
+		s.mutex.Unlock()
+		return providers.ErrIDNotFound
+	}
+	media := s.getMedia(id)
+	client := s.client
+	s.mutex.Unlock()
+
+	if media != nil {
+		if client == nil {
+			return fmt.Errorf("plugin %s isn't running", s.options.Name)
+		}
+		err := client.call("unmount", mountParams{media.pluginID, mount.mountPath}, nil)
+		if err != nil {
+			return s.convertError(err)
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.removeMount(id)
+	return nil
+}
+
+func (s *execProvider) RestoreMount(id string, location string) (providers.MountSession, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.getMedia(id) == nil {
+		return nil, providers.ErrIDNotFound
+	}
+
+	isMounted, err := helpers.IsMountPoint(location)
+	if err != nil {
+		return nil, err
+	}
+	if !isMounted {
+		return nil, fmt.Errorf("media is no longer mounted at %s", location)
+	}
+
+	mount := &execMount{id, location, s}
+	s.mounts = append(s.mounts, mount)
+	return mount, nil
+}
+
+func (s *execProvider) MediaAddded() (<-chan providers.Media, func()) {
+	out := make(chan providers.Media)
+	in := s.emit.On("mediaAdded", func(event *emitter.Event) {
+		out <- event.Args[0].(providers.Media)
+	})
+	cancel := func() {
+		s.emit.Off("mediaAdded", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+func (s *execProvider) MediaRemoved() (<-chan string, func()) {
+	out := make(chan string)
+	in := s.emit.On("mediaRemoved", func(event *emitter.Event) {
+		out <- event.String(0)
+	})
+	cancel := func() {
+		s.emit.Off("mediaRemoved", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+func (s *execProvider) MediaMounted() (<-chan string, func()) {
+	out := make(chan string)
+	in := s.emit.On("mediaMounted", func(event *emitter.Event) {
+		out <- event.String(0)
+	})
+	cancel := func() {
+		s.emit.Off("mediaMounted", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+func (s *execProvider) MediaUnmounted() (<-chan string, func()) {
+	out := make(chan string)
+	in := s.emit.On("mediaUnmounted", func(event *emitter.Event) {
+		out <- event.String(0)
+	})
+	cancel := func() {
+		s.emit.Off("mediaUnmounted", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+// notification Handles the notifications sent by the plugin.
+func (s *execProvider) notification(message rpcMessage) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch message.Method {
+	case "mediaAdded":
+		var params pluginMedia
+		err := json.Unmarshal(message.Params, &params)
+		if err != nil || len(params.ID) == 0 {
+			logrus.Warnf("plugin %s sent an invalid mediaAdded notification", s.options.Name)
+			return
+		}
+		s.markChanged(params.ID)
+		s.addMedia(params)
+	case "mediaRemoved", "mediaUnmounted":
+		var params idParams
+		err := json.Unmarshal(message.Params, &params)
+		if err != nil || len(params.ID) == 0 {
+			logrus.Warnf("plugin %s sent an invalid %s notification", s.options.Name, message.Method)
+			return
+		}
+		id := s.mediaID(params.ID)
+		if message.Method == "mediaRemoved" {
+			s.markChanged(params.ID)
+			s.removeMount(id)
+			s.removeMedia(id)
+		} else {
+			s.removeMount(id)
+		}
+	default:
+		logrus.Warnf("plugin %s sent an unknown notification %s", s.options.Name, message.Method)
+	}
+}
+
+// sync Applies the list of media sent by the plugin, except for
+// the media that changed since, the notifications are newer.
+func (s *execProvider) sync(list []pluginMedia) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	current := make(map[string]bool)
+	for _, media := range list {
+		if len(media.ID) == 0 {
+			continue
+		}
+		current[s.mediaID(media.ID)] = true
+		if !s.changed[media.ID] {
+			s.addMedia(media)
+		}
+	}
+
+	for mediaIndex := 0; mediaIndex < len(s.media); mediaIndex++ {
+		media := s.media[mediaIndex]
+		if !current[media.id] && !s.changed[media.pluginID] {
+			s.removeMount(media.id)
+			s.removeMedia(media.id)
+			mediaIndex--
+		}
+	}
+
+	s.syncing = false
+	s.changed = nil
+}
+
+// dropAll Removes everything after the plugin exited, the
+// mounts it made are unmounted, since nobody can unmount
+// them anymore.
+func (s *execProvider) dropAll() {
+	s.mountMutex.Lock()
+	defer s.mountMutex.Unlock()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for len(s.mounts) > 0 {
+		mount := s.mounts[0]
+		isMounted, err := helpers.IsMountPoint(mount.mountPath)
+		if err == nil && isMounted {
+			err = helpers.LazyUnmount(mount.mountPath)
+			if err != nil {
+				logrus.Warnf("couldn't unmount %s after plugin %s exited: %+v", mount.mountPath, s.options.Name, err)
+			}
+		}
+		s.removeMount(mount.id)
+	}
+	for len(s.media) > 0 {
+		s.removeMedia(s.media[0].id)
+	}
+}
+
+func (s *execProvider) convertError(err error) error {
+	if rpcErr, ok := err.(*rpcError); ok && rpcErr.Code == notFoundCode {
+		return providers.ErrIDNotFound
+	}
+	return err
+}
+
+func (s *execProvider) mediaID(pluginID string) string {
+	return fmt.Sprintf("%s-%s", s.options.Name, pluginID)
+}
+
+// The following require the mutex to be held.
+
+func (s *execProvider) markChanged(pluginID string) {
+	if s.syncing {
+		s.changed[pluginID] = true
+	}
+}
+
+func (s *execProvider) getMedia(id string) *execMedia {
+	for _, media := range s.media {
+		if media.id == id {
+			return media
+		}
+	}
+	return nil
+}
+
+func (s *execProvider) getMount(id string) *execMount {
+	for _, mount := range s.mounts {
+		if mount.id == id {
+			return mount
+		}
+	}
+	return nil
+}
+
+func (s *execProvider) addMedia(params pluginMedia) {
+	id := s.mediaID(params.ID)
+	displayName := strings.TrimSpace(params.DisplayName)
+	if len(displayName) == 0 {
+		displayName = params.ID
+	}
+
+	media := &execMedia{id, params.ID, s.options.Name, displayName, params.Properties}
+	for mediaIndex, existing := range s.media {
+		if existing.id == id {
+			// Replaced rather than changed, someone
+			// may be reading the old one.
+			s.media[mediaIndex] = media
+			return
+		}
+	}
+
+	s.media = append(s.media, media)
+	s.emit.Emit("mediaAdded", media)
+}
+
+func (s *execProvider) removeMedia(id string) {
+	for mediaIndex, media := range s.media {
+		if media.id == id {
+			s.media = append(s.media[:mediaIndex], s.media[mediaIndex+1:]...)
+			s.emit.Emit("mediaRemoved", id)
+			return
+		}
+	}
+}
+
+func (s *execProvider) removeMount(id string) {
+	for mountIndex, mount := range s.mounts {
+		if mount.id == id {
+			s.mounts = append(s.mounts[:mountIndex], s.mounts[mountIndex+1:]...)
+			// Only removes the directory if it is empty (unmounted).
+			err := os.Remove(mount.mountPath)
+			if err != nil && !os.IsNotExist(err) {
+				logrus.Warnf("couldn't remove mount path %s: %+v", mount.mountPath, err)
+			}
+			s.emit.Emit("mediaUnmounted", id)
+			return
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package exec
+
+type execMedia struct {
+	id string
+	// The id known to the plugin
+	pluginID    string
+	provider    string
+	displayName string
+	properties  map[string]string
+}
+
+func (s *execMedia) ID() string {
+	return s.id
+}
+
+func (s *execMedia) DisplayName() string {
+	return s.displayName
+}
+
+func (s *execMedia) Provider() string {
+	return s.provider
+}
+
+func (s *execMedia) Properties() map[string]string {
+	result := make(map[string]string, 0)
+	for key, value := range s.properties {
+		result[key] = value
+	}
+	return result
+}
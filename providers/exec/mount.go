@@ -0,0 +1,15 @@
+package exec
+
+type execMount struct {
+	id        string
+	mountPath string
+	provider  *execProvider
+}
+
+func (s *execMount) Release() error {
+	return s.provider.Unmount(s.id)
+}
+
+func (s *execMount) Location() string {
+	return s.mountPath
+}
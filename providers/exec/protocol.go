@@ -0,0 +1,83 @@
+// Package exec implements media providers with external programs
+// ("plugins"), so that new kinds of storage don't require changes
+// to the daemon.
+//
+// The daemon starts the plugin and speaks JSON-RPC 2.0 with it, one
+// JSON object per line, requests on the plugin's stdin and responses
+// and notifications on its stdout. Anything written to stderr is
+// logged. The plugin should exit when its stdin is closed, leaving
+// its mounts alone, they are restored when it is started again.
+//
+// Media is sent as {"id": "...", "displayName": "...", "properties":
+// {"key": "value"}}. The ids only have to be unique to the plugin,
+// the daemon exposes them as "<name>-<id>".
+//
+// Requests sent by the daemon:
+//
+//	watch    After answering it, the plugin sends notifications
+//	         when media is added or removed.
+//	list     The media currently available. The result must include
+//	         the changes sent as notifications before it.
+//	mount    {"id", "mountPath"} Mount the media at mountPath, an
+//	         empty directory created by the daemon.
+//	unmount  {"id", "mountPath"} Unmount the media, but leave
+//	         mountPath, the daemon removes it.
+//
+// Notifications sent by the plugin:
+//
+//	mediaAdded      The media, also used to update its properties.
+//	mediaRemoved    {"id"} The plugin cleans up the mount, if it was.
+//	mediaUnmounted  {"id"} The mount went away on its own.
+//
+// Errors are reported with a JSON-RPC error. Use the code -32000 when
+// the media doesn't exist (anymore).
+package exec
+
+import "encoding/json"
+
+const (
+	jsonRPCVersion = "2.0"
+	// The error code plugins use for unknown media.
+	notFoundCode = -32000
+)
+
+type rpcRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int         `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// rpcMessage A response or a notification from the plugin
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int            `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	Result  json.RawMessage `json:"result"`
+	Error   *rpcError       `json:"error"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (s *rpcError) Error() string {
+	return s.Message
+}
+
+type pluginMedia struct {
+	ID          string            `json:"id"`
+	DisplayName string            `json:"displayName"`
+	Properties  map[string]string `json:"properties"`
+}
+
+type mountParams struct {
+	ID        string `json:"id"`
+	MountPath string `json:"mountPath"`
+}
+
+type idParams struct {
+	ID string `json:"id"`
+}
@@ -0,0 +1,334 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/olebedev/emitter"
+
+	"github.com/pauldotknopf/automounter/helpers"
+	"github.com/pauldotknopf/automounter/providers"
+)
+
+// Options Describes media that is "plugged in" to the fake provider
+type Options struct {
+	// Generated when empty
+	ID          string
+	DisplayName string
+	Properties  map[string]string
+	// Written to the mount directory when the media is mounted,
+	// keyed by their path relative to it.
+	Files map[string]string
+}
+
+// Failures The errors returned by the next mounts and unmounts
+// of a media, instead of doing them. Nil to succeed.
+type Failures struct {
+	Mount   error
+	Unmount error
+}
+
+type fakeProvider struct {
+	mutex    sync.Mutex
+	media    []*fakeMedia
+	mounts   []*fakeMount
+	failures map[string]Failures
+	nextID   int
+	emit     *emitter.Emitter
+}
+
+// Provider A media provider that doesn't need any hardware. Mounts
+// are plain directories created under the mount root.
+type Provider interface {
+	providers.MediaProvider
+	AddMedia(options Options) (providers.Media, error)
+	// Unmounts the media (if it is) and removes it, like
+	// unplugging a stick.
+	RemoveMedia(id string) error
+	// Used until they are replaced, an empty Failures clears them.
+	SetFailures(id string, failures Failures) error
+}
+
+// Create a fake media provider without any media
+func Create() (Provider, error) {
+	p := &fakeProvider{}
+	p.failures = make(map[string]Failures)
+	p.emit = &emitter.Emitter{}
+	p.emit.Use("*", emitter.Void)
+	return p, nil
+}
+
+func (s *fakeProvider) Name() string {
+	return "fake"
+}
+
+func (s *fakeProvider) Start(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (s *fakeProvider) GetMedia() []providers.Media {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := make([]providers.Media, 0)
+	for _, media := range s.media {
+		result = append(result, media)
+	}
+	return result
+}
+
+func (s *fakeProvider) GetMediaByID(id string) providers.Media {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	media := s.getMedia(id)
+	if media == nil {
+		return nil
+	}
+	return media
+}
+
+func (s *fakeProvider) Mount(id string) (providers.MountSession, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	media := s.getMedia(id)
+	if media == nil {
+		return nil, providers.ErrIDNotFound
+	}
+
+	if err := s.failures[id].Mount; err != nil {
+		return nil, err
+	}
+
+	// Check to see if the media is already mounted
+	for _, mount := range s.mounts {
+		if mount.id == id {
+			return &fakeMount{id, mount.mountPath, s}, nil
+		}
+	}
+
+	mountPath, err := helpers.GetTmpMountPath()
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeFiles(mountPath, media.options.Files)
+	if err != nil {
+		os.RemoveAll(mountPath)
+		return nil, err
+	}
+
+	mount := &fakeMount{id, mountPath, s}
+	s.mounts = append(s.mounts, mount)
+	s.emit.Emit("mediaMounted", id)
+	return mount, nil
+}
+
+func (s *fakeProvider) Unmount(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.getMedia(id) != nil {
+		if err := s.failures[id].Unmount; err != nil {
+			return err
+		}
+	}
+
+	return s.unmount(id)
+}
+
+func (s *fakeProvider) RestoreMount(id string, location string) (providers.MountSession, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.getMedia(id) == nil {
+		return nil, providers.ErrIDNotFound
+	}
+
+	exists, err := helpers.PathExists(location)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("media is no longer mounted at %s", location)
+	}
+
+	mount := &fakeMount{id, location, s}
+	s.mounts = append(s.mounts, mount)
+	return mount, nil
+}
+
+func (s *fakeProvider) MediaAddded() (<-chan providers.Media, func()) {
+	out := make(chan providers.Media)
+	in := s.emit.On("mediaAdded", func(event *emitter.Event) {
+		out <- event.Args[0].(providers.Media)
+	})
+	cancel := func() {
+		s.emit.Off("mediaAdded", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+func (s *fakeProvider) MediaRemoved() (<-chan string, func()) {
+	out := make(chan string)
+	in := s.emit.On("mediaRemoved", func(event *emitter.Event) {
+		out <- event.String(0)
+	})
+	cancel := func() {
+		s.emit.Off("mediaRemoved", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+func (s *fakeProvider) MediaMounted() (<-chan string, func()) {
+	out := make(chan string)
+	in := s.emit.On("mediaMounted", func(event *emitter.Event) {
+		out <- event.String(0)
+	})
+	cancel := func() {
+		s.emit.Off("mediaMounted", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+func (s *fakeProvider) MediaUnmounted() (<-chan string, func()) {
+	out := make(chan string)
+	in := s.emit.On("mediaUnmounted", func(event *emitter.Event) {
+		out <- event.String(0)
+	})
+	cancel := func() {
+		s.emit.Off("mediaUnmounted", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+func (s *fakeProvider) AddMedia(options Options) (providers.Media, error) {
+	for path := range options.Files {
+		if !isRelative(path) {
+			return nil, fmt.Errorf("invalid file path %s, it must be relative to the mount", path)
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(options.ID) == 0 {
+		for {
+			s.nextID++
+			options.ID = fmt.Sprintf("fake-%d", s.nextID)
+			if s.getMedia(options.ID) == nil {
+				break
+			}
+		}
+	} else if s.getMedia(options.ID) != nil {
+		return nil, fmt.Errorf("there is already media with the id %s", options.ID)
+	}
+	if len(options.DisplayName) == 0 {
+		options.DisplayName = options.ID
+	}
+
+	media := &fakeMedia{options}
+	s.media = append(s.media, media)
+	s.emit.Emit("mediaAdded", media)
+	return media, nil
+}
+
+func (s *fakeProvider) RemoveMedia(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Unplugging doesn't care about scripted failures.
+	err := s.unmount(id)
+	if err == providers.ErrIDNotFound {
+		err = nil
+	}
+
+	for mediaIndex, media := range s.media {
+		if media.options.ID == id {
+			s.media = append(s.media[:mediaIndex], s.media[mediaIndex+1:]...)
+			delete(s.failures, id)
+			s.emit.Emit("mediaRemoved", id)
+			return err
+		}
+	}
+
+	return providers.ErrIDNotFound
+}
+
+func (s *fakeProvider) SetFailures(id string, failures Failures) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.getMedia(id) == nil {
+		return providers.ErrIDNotFound
+	}
+
+	if failures.Mount == nil && failures.Unmount == nil {
+		delete(s.failures, id)
+	} else {
+		s.failures[id] = failures
+	}
+	return nil
+}
+
+// getMedia The mutex must be held.
+func (s *fakeProvider) getMedia(id string) *fakeMedia {
+	for _, media := range s.media {
+		if media.options.ID == id {
+			return media
+		}
+	}
+	return nil
+}
+
+// unmount The mutex must be held.
+func (s *fakeProvider) unmount(id string) error {
+	for mountIndex, mount := range s.mounts {
+		if mount.id == id {
+			s.mounts = append(s.mounts[:mountIndex], s.mounts[mountIndex+1:]...)
+			defer func() {
+				s.emit.Emit("mediaUnmounted", id)
+			}()
+			// Everything in the directory was put there by the
+			// media, or by whoever leased it, so it goes with it.
+			if !helpers.IsUnderMountRoot(mount.mountPath) {
+				return fmt.Errorf("refusing to delete %s, it isn't under the mount root", mount.mountPath)
+			}
+			return os.RemoveAll(mount.mountPath)
+		}
+	}
+	return providers.ErrIDNotFound
+}
+
+func isRelative(path string) bool {
+	if filepath.IsAbs(path) {
+		return false
+	}
+	cleaned := filepath.Clean(path)
+	return cleaned != "." && cleaned != ".." && !strings.HasPrefix(cleaned, ".."+string(filepath.Separator))
+}
+
+func writeFiles(mountPath string, files map[string]string) error {
+	for path, content := range files {
+		fullPath := filepath.Join(mountPath, path)
+		err := os.MkdirAll(filepath.Dir(fullPath), 0755)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(fullPath, []byte(content), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
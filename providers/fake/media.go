@@ -0,0 +1,25 @@
+package fake
+
+type fakeMedia struct {
+	options Options
+}
+
+func (s *fakeMedia) ID() string {
+	return s.options.ID
+}
+
+func (s *fakeMedia) DisplayName() string {
+	return s.options.DisplayName
+}
+
+func (s *fakeMedia) Provider() string {
+	return "fake"
+}
+
+func (s *fakeMedia) Properties() map[string]string {
+	result := make(map[string]string, 0)
+	for key, value := range s.options.Properties {
+		result[key] = value
+	}
+	return result
+}
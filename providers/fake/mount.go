@@ -0,0 +1,15 @@
+package fake
+
+type fakeMount struct {
+	id        string
+	mountPath string
+	provider  *fakeProvider
+}
+
+func (s *fakeMount) Release() error {
+	return s.provider.Unmount(s.id)
+}
+
+func (s *fakeMount) Location() string {
+	return s.mountPath
+}
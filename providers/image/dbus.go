@@ -0,0 +1,197 @@
+package image
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+// How long udisks gets to probe the partitions of a new loop device.
+const probeTimeout = time.Second * 5
+
+const probeInterval = time.Millisecond * 250
+
+// partition A filesystem on a loop device
+type partition struct {
+	path   dbus.ObjectPath
+	number uint32
+	fsType string
+	label  string
+	uuid   string
+	size   uint64
+}
+
+func (s *imageProvider) managedObjects() (map[dbus.ObjectPath]map[string]map[string]dbus.Variant, error) {
+	var result map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+	udisks := s.conn.Object("org.freedesktop.UDisks2", "/org/freedesktop/UDisks2")
+	err := udisks.Call("org.freedesktop.DBus.ObjectManager.GetManagedObjects", 0).Store(&result)
+	return result, err
+}
+
+// attach Sets up a loop device for the image. Like udisksctl,
+// we pass an open file, so udisks never opens paths for us.
+func (s *imageProvider) attach(img *image) error {
+	flag := os.O_RDWR
+	if img.options.ReadOnly {
+		flag = os.O_RDONLY
+	}
+	file, err := s.openImage(img.options.Path, flag)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	options := map[string]dbus.Variant{
+		"read-only": dbus.MakeVariant(img.options.ReadOnly),
+	}
+	manager := s.conn.Object("org.freedesktop.UDisks2", "/org/freedesktop/UDisks2/Manager")
+	var loop dbus.ObjectPath
+	err = manager.Call("org.freedesktop.UDisks2.Manager.LoopSetup", 0, dbus.UnixFD(file.Fd()), options).Store(&loop)
+	if err != nil {
+		return err
+	}
+
+	img.loop = loop
+	return nil
+}
+
+// detach Deletes the loop device of the image.
+func (s *imageProvider) detach(img *image) error {
+	obj := s.conn.Object("org.freedesktop.UDisks2", img.loop)
+	err := obj.Call("org.freedesktop.UDisks2.Loop.Delete", 0, map[string]dbus.Variant{}).Store()
+	if err != nil {
+		return err
+	}
+	img.loop = ""
+	return nil
+}
+
+// findLoop Returns the loop device already backed by the image,
+// for example when the daemon was restarted.
+func (s *imageProvider) findLoop(img *image) (dbus.ObjectPath, error) {
+	// The loop device is backed by the file we opened,
+	// so it has the path with the symlinks resolved.
+	resolved, err := filepath.EvalSymlinks(img.options.Path)
+	if err != nil {
+		return "", err
+	}
+	objects, err := s.managedObjects()
+	if err != nil {
+		return "", err
+	}
+	for path, object := range objects {
+		loop, ok := object["org.freedesktop.UDisks2.Loop"]
+		if !ok {
+			continue
+		}
+		backingFile, _ := loop["BackingFile"].Value().([]byte)
+		if strings.TrimRight(string(backingFile), "\x00") != resolved {
+			continue
+		}
+		readOnly, _ := object["org.freedesktop.UDisks2.Block"]["ReadOnly"].Value().(bool)
+		if readOnly == img.options.ReadOnly {
+			return path, nil
+		}
+	}
+	return "", nil
+}
+
+// partitions Returns the filesystems on the loop device. If the image
+// has no partition table, the loop device itself is partition 0.
+func (s *imageProvider) partitions(loop dbus.ObjectPath) ([]partition, error) {
+	objects, err := s.managedObjects()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]partition, 0)
+	for path, object := range objects {
+		if _, ok := object["org.freedesktop.UDisks2.Filesystem"]; !ok {
+			continue
+		}
+		block, ok := object["org.freedesktop.UDisks2.Block"]
+		if !ok {
+			continue
+		}
+		var p partition
+		p.path = path
+		if path != loop {
+			info, ok := object["org.freedesktop.UDisks2.Partition"]
+			if !ok {
+				continue
+			}
+			if table, _ := info["Table"].Value().(dbus.ObjectPath); table != loop {
+				continue
+			}
+			p.number, _ = info["Number"].Value().(uint32)
+		}
+		p.fsType, _ = block["IdType"].Value().(string)
+		p.label, _ = block["IdLabel"].Value().(string)
+		p.uuid, _ = block["IdUUID"].Value().(string)
+		p.size, _ = block["Size"].Value().(uint64)
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+// waitForPartitions The kernel scans the partition table of a new loop
+// device, and udisks probes the partitions, after LoopSetup returns.
+// Polls the partitions until done says they are complete.
+func (s *imageProvider) waitForPartitions(loop dbus.ObjectPath, done func(previous []partition, current []partition) bool) ([]partition, error) {
+	deadline := time.Now().Add(probeTimeout)
+	var previous []partition
+	for {
+		current, err := s.partitions(loop)
+		if err != nil {
+			return nil, err
+		}
+		if done(previous, current) {
+			return current, nil
+		}
+		if time.Now().After(deadline) {
+			return current, fmt.Errorf("timed out waiting for udisks to probe the image")
+		}
+		previous = current
+		time.Sleep(probeInterval)
+	}
+}
+
+func findPartition(partitions []partition, number uint32) (partition, bool) {
+	for _, p := range partitions {
+		if p.number == number {
+			return p, true
+		}
+	}
+	return partition{}, false
+}
+
+func getPropertyStringArray(conn *dbus.Conn, path dbus.ObjectPath, propertyName string) ([]string, error) {
+	obj := conn.Object("org.freedesktop.UDisks2", path)
+	p, err := obj.GetProperty(propertyName)
+	if err != nil {
+		return nil, err
+	}
+	if byteArray, ok := p.Value().([][]byte); ok {
+		result := make([]string, 0)
+		for _, bytes := range byteArray {
+			result = append(result, strings.TrimRight(string(bytes), "\x00"))
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("invalid property type")
+}
+
+func getMountPoint(conn *dbus.Conn, path dbus.ObjectPath) (string, error) {
+	mountPoints, err := getPropertyStringArray(conn, path, "org.freedesktop.UDisks2.Filesystem.MountPoints")
+	if err != nil {
+		return "", err
+	}
+	if len(mountPoints) == 0 {
+		return "", fmt.Errorf("mount indicated it was already mounted, but couldn't find the mount")
+	}
+	return mountPoints[0], nil
+}
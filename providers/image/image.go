@@ -0,0 +1,562 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/godbus/dbus"
+	"github.com/olebedev/emitter"
+	"github.com/sirupsen/logrus"
+
+	"github.com/pauldotknopf/automounter/providers"
+)
+
+type imageProvider struct {
+	options  ProviderOptions
+	conn     *dbus.Conn
+	mutex    sync.Mutex
+	images   []*image
+	media    []*imageMedia
+	emit     *emitter.Emitter
+	registry *registry
+}
+
+type image struct {
+	id      string
+	options Options
+	// Whether the image is remembered across restarts
+	persisted bool
+	// The loop device, empty while the image isn't attached
+	loop dbus.ObjectPath
+	// The media of the image that are mounted, and where
+	mounted map[string]string
+	media   []*imageMedia
+}
+
+// ProviderOptions .
+type ProviderOptions struct {
+	// Where the images that are persisted are stored. If
+	// empty, images are only kept in memory.
+	RegistryPath string
+	// Only images in these directories can be added. At least one is required.
+	Directories []string
+}
+
+// Provider .
+type Provider interface {
+	providers.MediaProvider
+	// Add an image. The image is attached to find the filesystems in it,
+	// which are returned as media. It is only kept attached while any
+	// of them are mounted. Persisted images are remembered across restarts.
+	AddImage(options Options, persist bool) (string, []providers.Media, error)
+	RemoveImage(imageID string) error
+}
+
+// Create a disk image media provider
+func Create(options ProviderOptions) (Provider, error) {
+	if len(options.Directories) == 0 {
+		return nil, fmt.Errorf("at least one image directory is required")
+	}
+
+	p := &imageProvider{}
+	p.options = options
+
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return nil, err
+	}
+	p.conn = conn
+
+	p.emit = &emitter.Emitter{}
+	p.emit.Use("*", emitter.Void)
+
+	if len(options.RegistryPath) > 0 {
+		p.registry = &registry{options.RegistryPath}
+		options, err := p.registry.load()
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range options {
+			img := p.buildImage(o)
+			img.persisted = true
+			p.images = append(p.images, img)
+		}
+	}
+
+	return p, nil
+}
+
+func (s *imageProvider) Name() string {
+	return "image"
+}
+
+func (s *imageProvider) Start(ctx context.Context) error {
+	// Find the filesystems of the images we loaded from the registry.
+	// That takes a while for each of them, so they are probed as copies
+	// without the mutex, which is only taken to publish the media.
+	s.mutex.Lock()
+	loaded := make([]*image, len(s.images))
+	copy(loaded, s.images)
+	s.mutex.Unlock()
+
+	for _, img := range loaded {
+		probed := s.buildImage(img.options)
+		err := s.probe(probed)
+		if err != nil {
+			logrus.Warnf("couldn't probe image %s: %+v", img.options.Path, err)
+			continue
+		}
+
+		s.mutex.Lock()
+		if s.hasImage(img) {
+			img.loop = probed.loop
+			img.media = probed.media
+			for _, media := range img.media {
+				media.image = img
+				s.media = append(s.media, media)
+				s.emit.Emit("mediaAdded", media)
+			}
+		}
+		s.mutex.Unlock()
+	}
+
+	<-ctx.Done()
+	return nil
+}
+
+func (s *imageProvider) GetMedia() []providers.Media {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := make([]providers.Media, 0)
+	for _, media := range s.media {
+		result = append(result, media)
+	}
+	return result
+}
+
+func (s *imageProvider) GetMediaByID(id string) providers.Media {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	media := s.getMedia(id)
+	if media == nil {
+		return nil
+	}
+	return media
+}
+
+func (s *imageProvider) Mount(id string) (providers.MountSession, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	media := s.getMedia(id)
+	if media == nil {
+		return nil, providers.ErrIDNotFound
+	}
+	img := media.image
+
+	// Check to see if it is already mounted
+	if location, ok := img.mounted[id]; ok {
+		return &imageMountSession{media, location, s}, nil
+	}
+
+	if len(img.loop) == 0 {
+		err := s.attach(img)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	partitions, err := s.waitForPartitions(img.loop, func(previous []partition, current []partition) bool {
+		_, ok := findPartition(current, media.partition)
+		return ok
+	})
+	if err != nil {
+		s.detachIfUnused(img)
+		return nil, err
+	}
+	p, _ := findPartition(partitions, media.partition)
+
+	params := make(map[string]dbus.Variant)
+	if img.options.ReadOnly {
+		params["options"] = dbus.MakeVariant("ro")
+	}
+	var location string
+	obj := s.conn.Object("org.freedesktop.UDisks2", p.path)
+	err = obj.Call("org.freedesktop.UDisks2.Filesystem.Mount", 0, params).Store(&location)
+	if err != nil {
+		dbusError, ok := err.(dbus.Error)
+		if !ok || dbusError.Name != "org.freedesktop.UDisks2.Error.AlreadyMounted" {
+			s.detachIfUnused(img)
+			return nil, err
+		}
+		location, err = getMountPoint(s.conn, p.path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	img.mounted[id] = location
+	s.emit.Emit("mediaMounted", id)
+
+	return &imageMountSession{media, location, s}, nil
+}
+
+func (s *imageProvider) Unmount(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	media := s.getMedia(id)
+	if media == nil {
+		return providers.ErrIDNotFound
+	}
+	return s.unmount(media)
+}
+
+func (s *imageProvider) RestoreMount(id string, location string) (providers.MountSession, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	media := s.getMedia(id)
+	if media == nil {
+		return nil, providers.ErrIDNotFound
+	}
+	img := media.image
+
+	if len(img.loop) > 0 {
+		partitions, err := s.partitions(img.loop)
+		if err != nil {
+			return nil, err
+		}
+		if p, ok := findPartition(partitions, media.partition); ok {
+			mountPoints, err := getPropertyStringArray(s.conn, p.path, "org.freedesktop.UDisks2.Filesystem.MountPoints")
+			if err != nil {
+				return nil, err
+			}
+			for _, mountPoint := range mountPoints {
+				if mountPoint == location {
+					img.mounted[id] = location
+					return &imageMountSession{media, location, s}, nil
+				}
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("media is no longer mounted at %s", location)
+}
+
+func (s *imageProvider) MediaAddded() (<-chan providers.Media, func()) {
+	out := make(chan providers.Media)
+	in := s.emit.On("mediaAdded", func(event *emitter.Event) {
+		out <- event.Args[0].(providers.Media)
+	})
+	cancel := func() {
+		s.emit.Off("mediaAdded", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+func (s *imageProvider) MediaRemoved() (<-chan string, func()) {
+	out := make(chan string)
+	in := s.emit.On("mediaRemoved", func(event *emitter.Event) {
+		out <- event.String(0)
+	})
+	cancel := func() {
+		s.emit.Off("mediaRemoved", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+func (s *imageProvider) MediaMounted() (<-chan string, func()) {
+	out := make(chan string)
+	in := s.emit.On("mediaMounted", func(event *emitter.Event) {
+		out <- event.String(0)
+	})
+	cancel := func() {
+		s.emit.Off("mediaMounted", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+func (s *imageProvider) MediaUnmounted() (<-chan string, func()) {
+	out := make(chan string)
+	in := s.emit.On("mediaUnmounted", func(event *emitter.Event) {
+		out <- event.String(0)
+	})
+	cancel := func() {
+		s.emit.Off("mediaUnmounted", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+func (s *imageProvider) AddImage(options Options, persist bool) (string, []providers.Media, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// If the image was already added, act as if we added it.
+	for _, img := range s.images {
+		if img.options.Hash == options.Hash {
+			if persist && !img.persisted {
+				img.persisted = true
+				err := s.saveRegistry()
+				if err != nil {
+					img.persisted = false
+					return "", nil, err
+				}
+			}
+			return img.id, convertMedia(img.media), nil
+		}
+	}
+
+	img := s.buildImage(options)
+	err := s.probe(img)
+	if err != nil {
+		return "", nil, err
+	}
+
+	img.persisted = persist
+	s.images = append(s.images, img)
+	if persist {
+		err := s.saveRegistry()
+		if err != nil {
+			s.images = s.images[:len(s.images)-1]
+			return "", nil, err
+		}
+	}
+
+	for _, media := range img.media {
+		s.media = append(s.media, media)
+		s.emit.Emit("mediaAdded", media)
+	}
+
+	return img.id, convertMedia(img.media), nil
+}
+
+func (s *imageProvider) RemoveImage(imageID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for imageIndex, img := range s.images {
+		if img.id != imageID {
+			continue
+		}
+		s.images = append(s.images[:imageIndex], s.images[imageIndex+1:]...)
+		if img.persisted {
+			err := s.saveRegistry()
+			if err != nil {
+				logrus.Errorf("couldn't remove image %s from the registry: %+v", img.options.Path, err)
+			}
+		}
+		for _, media := range img.media {
+			for mediaIndex, m := range s.media {
+				if m == media {
+					s.media = append(s.media[:mediaIndex], s.media[mediaIndex+1:]...)
+					break
+				}
+			}
+			s.emit.Emit("mediaRemoved", media.id)
+		}
+		// Like the network shares, mounts that are in use are left
+		// alone. The image is detached once they are released.
+		return nil
+	}
+
+	return providers.ErrIDNotFound
+}
+
+// release Unmounts the media of a session, which may
+// belong to an image that was removed since.
+func (s *imageProvider) release(media *imageMedia) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.unmount(media)
+}
+
+// unmount The mutex must be held.
+func (s *imageProvider) unmount(media *imageMedia) error {
+	img := media.image
+	if _, ok := img.mounted[media.id]; !ok {
+		return nil
+	}
+
+	partitions, err := s.partitions(img.loop)
+	if err != nil {
+		return err
+	}
+	if p, ok := findPartition(partitions, media.partition); ok {
+		obj := s.conn.Object("org.freedesktop.UDisks2", p.path)
+		params := map[string]dbus.Variant{
+			"force": dbus.MakeVariant(true),
+		}
+		err = obj.Call("org.freedesktop.UDisks2.Filesystem.Unmount", 0, params).Store()
+		if err != nil {
+			dbusError, ok := err.(dbus.Error)
+			if !ok || dbusError.Name != "org.freedesktop.UDisks2.Error.NotMounted" {
+				return err
+			}
+		}
+	}
+
+	delete(img.mounted, media.id)
+	s.emit.Emit("mediaUnmounted", media.id)
+
+	s.detachIfUnused(img)
+	return nil
+}
+
+// detachIfUnused Detaches the loop device once nothing
+// on it is mounted. The mutex must be held.
+func (s *imageProvider) detachIfUnused(img *image) {
+	if len(img.loop) == 0 || len(img.mounted) > 0 {
+		return
+	}
+	err := s.detach(img)
+	if err != nil {
+		logrus.Warnf("couldn't detach the loop device %s of image %s: %+v", img.loop, img.options.Path, err)
+	}
+}
+
+// probe Finds the filesystems in the image. If it isn't attached
+// already, it is attached for as long as it takes. Nobody else may
+// be using the image yet.
+func (s *imageProvider) probe(img *image) error {
+	loop, err := s.findLoop(img)
+	if err != nil {
+		return err
+	}
+	if len(loop) > 0 {
+		// Left behind by a previous run, there may be mounts
+		// on it that are restored, so leave it attached.
+		img.loop = loop
+	} else {
+		err = s.attach(img)
+		if err != nil {
+			return err
+		}
+		defer s.detachIfUnused(img)
+	}
+
+	// Wait until there are filesystems, and no new ones show up.
+	partitions, err := s.waitForPartitions(img.loop, func(previous []partition, current []partition) bool {
+		return len(current) > 0 && len(current) == len(previous)
+	})
+	if len(partitions) == 0 {
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("no filesystems were found in the image")
+	}
+
+	img.media = make([]*imageMedia, 0)
+	for _, p := range partitions {
+		media := &imageMedia{}
+		media.id = fmt.Sprintf("%s-p%d", img.id, p.number)
+		media.image = img
+		media.partition = p.number
+		media.fsType = p.fsType
+		media.label = p.label
+		media.uuid = p.uuid
+		media.size = p.size
+		img.media = append(img.media, media)
+	}
+
+	return nil
+}
+
+// openImage Opens the image, making sure it is a regular file in one of
+// the allowed directories. The path is checked after resolving symlinks,
+// and again through the opened file, in case it was swapped in between.
+func (s *imageProvider) openImage(path string, flag int) (*os.File, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkDirectory(resolved); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(resolved, flag|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		return nil, err
+	}
+	opened, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", file.Fd()))
+	if err == nil {
+		err = s.checkDirectory(opened)
+	}
+	if err == nil {
+		var info os.FileInfo
+		info, err = file.Stat()
+		if err == nil && !info.Mode().IsRegular() {
+			err = fmt.Errorf("the image must be a regular file")
+		}
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// checkDirectory Makes sure the resolved path is in one of the allowed directories.
+func (s *imageProvider) checkDirectory(resolved string) error {
+	for _, directory := range s.options.Directories {
+		relative, err := filepath.Rel(filepath.Clean(directory), resolved)
+		if err == nil && relative != ".." && !strings.HasPrefix(relative, "../") {
+			return nil
+		}
+	}
+	return fmt.Errorf("images can't be added from this directory")
+}
+
+func (s *imageProvider) buildImage(options Options) *image {
+	img := &image{}
+	img.id = fmt.Sprintf("image-%s", options.Hash)
+	img.options = options
+	img.mounted = make(map[string]string)
+	return img
+}
+
+// hasImage If the image wasn't removed. The mutex must be held.
+func (s *imageProvider) hasImage(img *image) bool {
+	for _, i := range s.images {
+		if i == img {
+			return true
+		}
+	}
+	return false
+}
+
+// getMedia The mutex must be held.
+func (s *imageProvider) getMedia(id string) *imageMedia {
+	for _, media := range s.media {
+		if media.id == id {
+			return media
+		}
+	}
+	return nil
+}
+
+// saveRegistry persists the images. The mutex must be held.
+func (s *imageProvider) saveRegistry() error {
+	if s.registry == nil {
+		return nil
+	}
+	return s.registry.save(s.images)
+}
+
+func convertMedia(media []*imageMedia) []providers.Media {
+	result := make([]providers.Media, 0)
+	for _, m := range media {
+		result = append(result, m)
+	}
+	return result
+}
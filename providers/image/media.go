@@ -0,0 +1,52 @@
+package image
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// imageMedia A filesystem in an image. The whole image
+// is partition 0, for images without a partition table.
+type imageMedia struct {
+	id        string
+	image     *image
+	partition uint32
+	// What udisks probed when the image was added
+	fsType string
+	label  string
+	uuid   string
+	size   uint64
+}
+
+func (s *imageMedia) ID() string {
+	return s.id
+}
+
+func (s *imageMedia) DisplayName() string {
+	if len(s.label) > 0 {
+		return s.label
+	}
+	if s.partition == 0 {
+		return s.image.options.FriendlyName()
+	}
+	return fmt.Sprintf("%s (partition %d)", s.image.options.FriendlyName(), s.partition)
+}
+
+func (s *imageMedia) Provider() string {
+	return "image"
+}
+
+func (s *imageMedia) Properties() map[string]string {
+	result := make(map[string]string, 0)
+
+	result["imageId"] = s.image.id
+	result["path"] = s.image.options.Path
+	result["readOnly"] = strconv.FormatBool(s.image.options.ReadOnly)
+	result["partition"] = strconv.FormatUint(uint64(s.partition), 10)
+	result["fsType"] = s.fsType
+	result["label"] = s.label
+	result["uuid"] = s.uuid
+	result["size"] = strconv.FormatUint(s.size, 10)
+
+	return result
+}
@@ -0,0 +1,15 @@
+package image
+
+type imageMountSession struct {
+	media     *imageMedia
+	mountPath string
+	provider  *imageProvider
+}
+
+func (s *imageMountSession) Release() error {
+	return s.provider.release(s.media)
+}
+
+func (s *imageMountSession) Location() string {
+	return s.mountPath
+}
@@ -0,0 +1,65 @@
+package image
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Options .
+type Options struct {
+	// The absolute path of the image file. ISO and raw disk
+	// images are supported, as are fixed size VHD images,
+	// which are raw images with a footer.
+	Path string
+	// Attach the loop device read-only, so the image is never modified.
+	ReadOnly bool
+	Hash     string
+}
+
+// CreateOptions .
+func CreateOptions(path string, readOnly bool) (Options, error) {
+	var result Options
+	result.Path = path
+	result.ReadOnly = readOnly
+
+	if len(result.Path) == 0 {
+		return result, fmt.Errorf("path is required")
+	}
+
+	if !filepath.IsAbs(result.Path) {
+		return result, fmt.Errorf("the path must be absolute")
+	}
+	result.Path = filepath.Clean(result.Path)
+
+	info, err := os.Stat(result.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, fmt.Errorf("the image doesn't exist")
+		}
+		return result, err
+	}
+	if !info.Mode().IsRegular() {
+		return result, fmt.Errorf("the image must be a regular file")
+	}
+
+	// Build a hash of all the parameters
+	var hashBytes bytes.Buffer
+	hashBytes.Write([]byte(result.Path))
+	if result.ReadOnly {
+		hashBytes.WriteByte(1)
+	} else {
+		hashBytes.WriteByte(0)
+	}
+
+	result.Hash = fmt.Sprintf("%x", md5.Sum(hashBytes.Bytes()))
+
+	return result, nil
+}
+
+// FriendlyName .
+func (s Options) FriendlyName() string {
+	return filepath.Base(s.Path)
+}
@@ -0,0 +1,58 @@
+package image
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"github.com/pauldotknopf/automounter/helpers"
+)
+
+type registryImage struct {
+	Path     string `json:"path"`
+	ReadOnly bool   `json:"readOnly"`
+}
+
+type registryFile struct {
+	Images []registryImage `json:"images"`
+}
+
+type registry struct {
+	path string
+}
+
+// load Returns the images that were persisted. Images that no
+// longer exist are skipped, so that a deleted file doesn't keep
+// the daemon from starting.
+func (s *registry) load() ([]Options, error) {
+	result := make([]Options, 0)
+
+	var images registryFile
+	found, err := helpers.ReadJSONFile(s.path, &images)
+	if err != nil || !found {
+		return result, err
+	}
+
+	for _, image := range images.Images {
+		options, err := CreateOptions(image.Path, image.ReadOnly)
+		if err != nil {
+			logrus.Warnf("skipping image %s: %v", image.Path, err)
+			continue
+		}
+		result = append(result, options)
+	}
+
+	return result, nil
+}
+
+func (s *registry) save(images []*image) error {
+	var file registryFile
+	file.Images = make([]registryImage, 0)
+
+	for _, i := range images {
+		if !i.persisted {
+			continue
+		}
+		file.Images = append(file.Images, registryImage{i.options.Path, i.options.ReadOnly})
+	}
+
+	return helpers.WriteJSONFile(s.path, file, 0644)
+}
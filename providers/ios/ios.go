@@ -2,6 +2,7 @@ package ios
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/exec"
 	"sync"
@@ -17,15 +18,18 @@ import (
 )
 
 type iosProvider struct {
+	appID   string
 	mutex   sync.Mutex
 	emit    *emitter.Emitter
 	devices []*iosMedia
 	mounts  []*iosMountPoint
 }
 
-// Create a media provider for iOS devices
-func Create() (providers.MediaProvider, error) {
+// Create a media provider for iOS devices that
+// exposes the documents of the given app
+func Create(appID string) (providers.MediaProvider, error) {
 	p := &iosProvider{}
+	p.appID = appID
 	p.emit = &emitter.Emitter{}
 	p.emit.Use("*", emitter.Void)
 	return p, nil
@@ -91,13 +95,29 @@ func (s *iosProvider) GetMediaByID(id string) providers.Media {
 }
 
 func (s *iosProvider) Mount(id string) (providers.MountSession, error) {
+	return s.MountWithOptions(id, nil)
+}
+
+// MountWithOptions Only "ro" is supported.
+func (s *iosProvider) MountWithOptions(id string, options []string) (providers.MountSession, error) {
+	readOnly := false
+	for _, option := range options {
+		if option != "ro" {
+			return nil, fmt.Errorf("the mount option %s isn't supported for ios devices, only ro", option)
+		}
+		readOnly = true
+	}
+
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
 	// Check to see if the device is already mounted
 	for _, mount := range s.mounts {
 		if mount.uuid == id {
-			return &iosMountPoint{id, mount.path, s}, nil
+			if readOnly && !mount.readOnly {
+				return nil, fmt.Errorf("the device is already mounted read-write")
+			}
+			return &iosMountPoint{id, mount.path, mount.readOnly, s}, nil
 		}
 	}
 
@@ -112,9 +132,14 @@ func (s *iosProvider) Mount(id string) (providers.MountSession, error) {
 				return nil, err
 			}
 			mount.path = mountPath
+			mount.readOnly = readOnly
 			mount.provider = s
 
-			cmd := exec.Command("ifuse", mount.path, "-u", mount.uuid, "--documents", "com.medxchange.ackbar")
+			args := []string{mount.path, "-u", mount.uuid, "--documents", s.appID}
+			if readOnly {
+				args = append(args, "-o", "ro")
+			}
+			cmd := exec.Command("ifuse", args...)
 			err = cmd.Run()
 			if err != nil {
 				os.RemoveAll(mountPath)
@@ -139,6 +164,51 @@ func (s *iosProvider) Unmount(id string) error {
 	return s.unmount(id)
 }
 
+func (s *iosProvider) RestoreMount(id string, location string) (providers.MountSession, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.hasDevice(id) {
+		return nil, providers.ErrIDNotFound
+	}
+
+	isMounted, err := helpers.IsMountPoint(location)
+	if err != nil {
+		return nil, err
+	}
+	if !isMounted {
+		return nil, fmt.Errorf("media is no longer mounted at %s", location)
+	}
+
+	readOnly, err := helpers.IsReadOnlyMount(location)
+	if err != nil {
+		return nil, err
+	}
+
+	mount := &iosMountPoint{}
+	mount.uuid = id
+	mount.path = location
+	mount.readOnly = readOnly
+	mount.provider = s
+	s.mounts = append(s.mounts, mount)
+
+	return mount, nil
+}
+
+func (s *iosProvider) AdoptMount(mountInfo helpers.MountInfo) (string, providers.MountSession) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// ifuse doesn't record which device it mounted,
+	// so we can only claim the mounts we already own.
+	for _, mount := range s.mounts {
+		if mount.path == mountInfo.MountPoint {
+			return mount.uuid, mount
+		}
+	}
+	return "", nil
+}
+
 func (s *iosProvider) MediaAddded() (<-chan providers.Media, func()) {
 	out := make(chan providers.Media)
 	in := s.emit.On("mediaAdded", func(event *emitter.Event) {
@@ -236,7 +306,7 @@ func (s *iosProvider) deviceAdded(uuid string) error {
 		item := apps.ArrayItem(i)
 		bundleID := item.GetItem("CFBundleIdentifier")
 		bundleIDString := bundleID.String()
-		if bundleIDString == "com.medxchange.ackbar" {
+		if bundleIDString == s.appID {
 			if !s.hasDevice(uuid) {
 				media := &iosMedia{}
 				media.deviceName = deviceName
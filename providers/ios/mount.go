@@ -3,6 +3,7 @@ package ios
 type iosMountPoint struct {
 	uuid     string
 	path     string
+	readOnly bool
 	provider *iosProvider
 }
 
@@ -13,3 +14,10 @@ func (s *iosMountPoint) Release() error {
 func (s *iosMountPoint) Location() string {
 	return s.path
 }
+
+func (s *iosMountPoint) MountOptions() []string {
+	if s.readOnly {
+		return []string{"ro"}
+	}
+	return []string{"rw"}
+}
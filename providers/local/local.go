@@ -0,0 +1,349 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/olebedev/emitter"
+	"github.com/sirupsen/logrus"
+
+	"github.com/pauldotknopf/automounter/helpers"
+	"github.com/pauldotknopf/automounter/providers"
+)
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+
+// Directory A directory that is exposed as media
+type Directory struct {
+	// Used in the id of the media, "local-<name>"
+	Name string
+	Path string
+	// Bind mount the directory read-only. Symlinks can't be read-only.
+	ReadOnly bool
+}
+
+type localProvider struct {
+	mutex       sync.Mutex
+	media       []*localMedia
+	mounts      []*localMount
+	emit        *emitter.Emitter
+	useSymlinks bool
+}
+
+// Provider .
+type Provider interface {
+	providers.MediaProvider
+	// Replace the directories that are exposed. Directories that are
+	// removed are no longer available, but their mounts are left alone.
+	// Directories whose path or mode changed are unmounted, and removed
+	// and added again, so nobody keeps using the old mount.
+	SetDirectories(directories []Directory) error
+}
+
+// Create a provider for local directories. When running as root, the
+// directories are bind mounted under the mount root, otherwise they
+// are symlinked there.
+func Create() (Provider, error) {
+	p := &localProvider{}
+	p.useSymlinks = os.Geteuid() != 0
+
+	p.emit = &emitter.Emitter{}
+	p.emit.Use("*", emitter.Void)
+
+	return p, nil
+}
+
+// Validate Make sure the directory can be exposed
+func (s Directory) Validate() error {
+	if !validName.MatchString(s.Name) {
+		return fmt.Errorf("invalid name %s, only letters, numbers, - and _ are allowed", s.Name)
+	}
+	if !filepath.IsAbs(s.Path) {
+		return fmt.Errorf("the path of %s must be absolute", s.Name)
+	}
+	return nil
+}
+
+func (s *localProvider) Name() string {
+	return "local"
+}
+
+func (s *localProvider) Start(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (s *localProvider) GetMedia() []providers.Media {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := make([]providers.Media, 0)
+	for _, media := range s.media {
+		result = append(result, media)
+	}
+	return result
+}
+
+func (s *localProvider) GetMediaByID(id string) providers.Media {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, media := range s.media {
+		if media.ID() == id {
+			return media
+		}
+	}
+	return nil
+}
+
+func (s *localProvider) Mount(id string) (providers.MountSession, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Check to see if the directory is already mounted
+	for _, mount := range s.mounts {
+		if mount.id == id {
+			return &localMount{id, mount.mountPath, mount.symlink, s}, nil
+		}
+	}
+
+	for _, media := range s.media {
+		if media.id == id {
+			info, err := os.Stat(media.directory.Path)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				return nil, fmt.Errorf("%s isn't a directory", media.directory.Path)
+			}
+
+			mountPath, err := helpers.GetTmpMountPath()
+			if err != nil {
+				return nil, err
+			}
+
+			if s.useSymlinks {
+				err = os.Remove(mountPath)
+				if err == nil {
+					err = os.Symlink(media.directory.Path, mountPath)
+				}
+				if err != nil {
+					os.Remove(mountPath)
+					return nil, err
+				}
+			} else {
+				err = bindMount(media.directory, mountPath)
+				if err != nil {
+					os.Remove(mountPath)
+					return nil, err
+				}
+			}
+
+			mount := &localMount{id, mountPath, s.useSymlinks, s}
+			s.mounts = append(s.mounts, mount)
+			s.emit.Emit("mediaMounted", id)
+			return mount, nil
+		}
+	}
+
+	return nil, providers.ErrIDNotFound
+}
+
+func (s *localProvider) Unmount(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.unmount(id)
+}
+
+// unmount The mutex must be held.
+func (s *localProvider) unmount(id string) error {
+	for mountIndex, mount := range s.mounts {
+		if mount.id == id {
+			if !mount.symlink {
+				err := helpers.LazyUnmount(mount.mountPath)
+				if err != nil {
+					return err
+				}
+			}
+			// Only removes the empty directory, or the symlink
+			// itself, never the files in the directory.
+			err := os.Remove(mount.mountPath)
+			if err != nil {
+				logrus.Warnf("couldn't remove mount path %s after unmounting: %+v", mount.mountPath, err)
+			}
+			s.mounts = append(s.mounts[:mountIndex], s.mounts[mountIndex+1:]...)
+			s.emit.Emit("mediaUnmounted", id)
+			return nil
+		}
+	}
+
+	return providers.ErrIDNotFound
+}
+
+func (s *localProvider) RestoreMount(id string, location string) (providers.MountSession, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, media := range s.media {
+		if media.id == id {
+			symlink := false
+			if target, err := os.Readlink(location); err == nil {
+				if target != media.directory.Path {
+					return nil, fmt.Errorf("%s no longer links to %s", location, media.directory.Path)
+				}
+				symlink = true
+			} else {
+				isMounted, err := helpers.IsMountPoint(location)
+				if err != nil {
+					return nil, err
+				}
+				if !isMounted {
+					return nil, fmt.Errorf("media is no longer mounted at %s", location)
+				}
+			}
+			mount := &localMount{id, location, symlink, s}
+			s.mounts = append(s.mounts, mount)
+			return mount, nil
+		}
+	}
+
+	return nil, providers.ErrIDNotFound
+}
+
+func (s *localProvider) MediaAddded() (<-chan providers.Media, func()) {
+	out := make(chan providers.Media)
+	in := s.emit.On("mediaAdded", func(event *emitter.Event) {
+		out <- event.Args[0].(providers.Media)
+	})
+	cancel := func() {
+		s.emit.Off("mediaAdded", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+func (s *localProvider) MediaRemoved() (<-chan string, func()) {
+	out := make(chan string)
+	in := s.emit.On("mediaRemoved", func(event *emitter.Event) {
+		out <- event.String(0)
+	})
+	cancel := func() {
+		s.emit.Off("mediaRemoved", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+func (s *localProvider) MediaMounted() (<-chan string, func()) {
+	out := make(chan string)
+	in := s.emit.On("mediaMounted", func(event *emitter.Event) {
+		out <- event.String(0)
+	})
+	cancel := func() {
+		s.emit.Off("mediaMounted", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+func (s *localProvider) MediaUnmounted() (<-chan string, func()) {
+	out := make(chan string)
+	in := s.emit.On("mediaUnmounted", func(event *emitter.Event) {
+		out <- event.String(0)
+	})
+	cancel := func() {
+		s.emit.Off("mediaUnmounted", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+func (s *localProvider) SetDirectories(directories []Directory) error {
+	for _, directory := range directories {
+		err := directory.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	current := make(map[string]bool)
+	for _, directory := range directories {
+		id := fmt.Sprintf("local-%s", directory.Name)
+		if current[id] {
+			return fmt.Errorf("there is more than one directory named %s", directory.Name)
+		}
+		current[id] = true
+	}
+
+	for mediaIndex := 0; mediaIndex < len(s.media); mediaIndex++ {
+		media := s.media[mediaIndex]
+		if !current[media.id] {
+			s.media = append(s.media[:mediaIndex], s.media[mediaIndex+1:]...)
+			mediaIndex--
+			s.emit.Emit("mediaRemoved", media.id)
+		}
+	}
+
+	for _, directory := range directories {
+		id := fmt.Sprintf("local-%s", directory.Name)
+		media := &localMedia{id, directory}
+		existing := s.getMedia(id)
+		if existing == nil {
+			s.media = append(s.media, media)
+			s.emit.Emit("mediaAdded", media)
+			continue
+		}
+		if existing.directory == directory {
+			continue
+		}
+		// Replaced rather than changed, someone may be reading the
+		// old one. The mount still has the old path, or mode.
+		err := s.unmount(id)
+		if err != nil && err != providers.ErrIDNotFound {
+			logrus.Warnf("couldn't unmount %s after it changed: %+v", id, err)
+		}
+		for mediaIndex := range s.media {
+			if s.media[mediaIndex] == existing {
+				s.media[mediaIndex] = media
+			}
+		}
+		s.emit.Emit("mediaRemoved", id)
+		s.emit.Emit("mediaAdded", media)
+	}
+
+	return nil
+}
+
+// getMedia The mutex must be held.
+func (s *localProvider) getMedia(id string) *localMedia {
+	for _, media := range s.media {
+		if media.id == id {
+			return media
+		}
+	}
+	return nil
+}
+
+func bindMount(directory Directory, mountPath string) error {
+	output, err := exec.Command("mount", "--bind", directory.Path, mountPath).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("couldn't bind mount %s: %v: %s", directory.Path, err, string(output))
+	}
+	if directory.ReadOnly {
+		// A bind mount only becomes read-only when it is remounted.
+		output, err = exec.Command("mount", "-o", "remount,bind,ro", mountPath).CombinedOutput()
+		if err != nil {
+			helpers.LazyUnmount(mountPath)
+			return fmt.Errorf("couldn't make the bind mount of %s read-only: %v: %s", directory.Path, err, string(output))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/olebedev/emitter"
+
+	"github.com/pauldotknopf/automounter/helpers"
+	"github.com/pauldotknopf/automounter/providers"
+)
+
+// testEvents Records the added and removed events, like
+// "+local-docs" and "-local-docs", in the order they came in.
+type testEvents struct {
+	mutex  sync.Mutex
+	events []string
+}
+
+func (s *testEvents) add(event string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.events = append(s.events, event)
+}
+
+func (s *testEvents) take() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	result := strings.Join(s.events, " ")
+	s.events = nil
+	return result
+}
+
+func createTestProvider(t *testing.T) (*localProvider, *testEvents, string, func()) {
+	dir, err := ioutil.TempDir("", "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := helpers.MountRoot()
+	helpers.SetMountRoot(filepath.Join(dir, "mounts"))
+	for _, name := range []string{"docs", "photos"} {
+		err = os.MkdirAll(filepath.Join(dir, name), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := p.(*localProvider)
+	// Bind mounts need root, and leave mounts behind.
+	provider.useSymlinks = true
+
+	// Recorded while they are emitted, the channels don't keep the order.
+	events := &testEvents{}
+	provider.emit.On("mediaAdded", func(event *emitter.Event) {
+		events.add("+" + event.Args[0].(providers.Media).ID())
+	})
+	provider.emit.On("mediaRemoved", func(event *emitter.Event) {
+		events.add("-" + event.String(0))
+	})
+
+	return provider, events, dir, func() {
+		helpers.SetMountRoot(previous)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSetDirectoriesErrors(t *testing.T) {
+	p, events, dir, cleanup := createTestProvider(t)
+	defer cleanup()
+
+	tests := []struct {
+		name        string
+		directories []Directory
+		err         string
+	}{
+		{"bad name", []Directory{{Name: "my docs", Path: dir}}, "invalid name"},
+		{"relative path", []Directory{{Name: "docs", Path: "docs"}}, "must be absolute"},
+		{"same name", []Directory{{Name: "docs", Path: dir}, {Name: "docs", Path: dir}}, "more than one directory named docs"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := p.SetDirectories(test.directories)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected an error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+
+	if len(p.GetMedia()) != 0 || len(events.take()) != 0 {
+		t.Fatal("expected nothing to change")
+	}
+}
+
+func TestSetDirectories(t *testing.T) {
+	p, events, dir, cleanup := createTestProvider(t)
+	defer cleanup()
+
+	docs := filepath.Join(dir, "docs")
+	photos := filepath.Join(dir, "photos")
+
+	tests := []struct {
+		name        string
+		directories []Directory
+		events      string
+		// The media that are the same objects as before
+		kept []string
+		// The media that are unmounted
+		unmounted []string
+	}{
+		{"added", []Directory{{Name: "docs", Path: docs}, {Name: "photos", Path: photos}}, "+local-docs +local-photos", nil, nil},
+		{"unchanged", []Directory{{Name: "docs", Path: docs}, {Name: "photos", Path: photos}}, "", []string{"local-docs", "local-photos"}, nil},
+		{"path changed", []Directory{{Name: "docs", Path: photos}, {Name: "photos", Path: photos}}, "-local-docs +local-docs", []string{"local-photos"}, []string{"local-docs"}},
+		{"read-only changed", []Directory{{Name: "docs", Path: photos}, {Name: "photos", Path: photos, ReadOnly: true}}, "-local-photos +local-photos", []string{"local-docs"}, []string{"local-photos"}},
+		{"removed", []Directory{{Name: "photos", Path: photos, ReadOnly: true}}, "-local-docs", []string{"local-photos"}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before := make(map[string]providers.Media)
+			sessions := make(map[string]providers.MountSession)
+			for _, media := range p.GetMedia() {
+				before[media.ID()] = media
+				session, err := p.Mount(media.ID())
+				if err != nil {
+					t.Fatal(err)
+				}
+				sessions[media.ID()] = session
+			}
+
+			err := p.SetDirectories(test.directories)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual := events.take(); actual != test.events {
+				t.Fatalf("expected the events %q, got %q", test.events, actual)
+			}
+			if len(p.GetMedia()) != len(test.directories) {
+				t.Fatalf("expected %d media, got %d", len(test.directories), len(p.GetMedia()))
+			}
+			for _, directory := range test.directories {
+				media := p.GetMediaByID("local-" + directory.Name)
+				if media == nil || media.Properties()["path"] != directory.Path {
+					t.Fatalf("expected the media of %s to have the path %s", directory.Name, directory.Path)
+				}
+			}
+			for _, id := range test.kept {
+				if p.GetMediaByID(id) != before[id] {
+					t.Fatalf("expected %s to be kept", id)
+				}
+			}
+			for _, id := range test.unmounted {
+				if exists, _ := helpers.PathExists(sessions[id].Location()); exists {
+					t.Fatalf("expected %s to be unmounted", id)
+				}
+				// Mounted again with the new path.
+				session, err := p.Mount(id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				target, err := os.Readlink(session.Location())
+				if err != nil || target != p.GetMediaByID(id).Properties()["path"] {
+					t.Fatalf("expected %s to be mounted from its new path, got %s", id, target)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package local
+
+import "strconv"
+
+type localMedia struct {
+	id        string
+	directory Directory
+}
+
+func (s *localMedia) ID() string {
+	return s.id
+}
+
+func (s *localMedia) DisplayName() string {
+	return s.directory.Name
+}
+
+func (s *localMedia) Provider() string {
+	return "local"
+}
+
+func (s *localMedia) Properties() map[string]string {
+	result := make(map[string]string, 0)
+	result["name"] = s.directory.Name
+	result["path"] = s.directory.Path
+	result["readOnly"] = strconv.FormatBool(s.directory.ReadOnly)
+	return result
+}
@@ -0,0 +1,16 @@
+package local
+
+type localMount struct {
+	id        string
+	mountPath string
+	symlink   bool
+	provider  *localProvider
+}
+
+func (s *localMount) Release() error {
+	return s.provider.Unmount(s.id)
+}
+
+func (s *localMount) Location() string {
+	return s.mountPath
+}
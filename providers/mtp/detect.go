@@ -0,0 +1,87 @@
+package mtp
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const usbDevicesPath = "/sys/bus/usb/devices"
+
+// usbDevice A USB device that talks MTP
+type usbDevice struct {
+	// The name of the device in sysfs, "1-2"
+	name         string
+	busNum       string
+	devNum       string
+	vendorID     string
+	productID    string
+	manufacturer string
+	product      string
+	serial       string
+}
+
+// "1-2", "1-2.4", but not the interfaces ("1-2:1.0") or hubs ("usb1").
+var usbDeviceName = regexp.MustCompile(`^[0-9]+-[0-9.]+$`)
+
+// detectDevices Scans sysfs for USB devices with an MTP interface.
+// Phones usually describe it as a still image interface (class 6,
+// subclass 1, protocol 1), some as a vendor specific one named "MTP".
+func detectDevices() ([]usbDevice, error) {
+	entries, err := ioutil.ReadDir(usbDevicesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]usbDevice, 0)
+	for _, entry := range entries {
+		if !usbDeviceName.MatchString(entry.Name()) {
+			continue
+		}
+		devicePath := filepath.Join(usbDevicesPath, entry.Name())
+		if !hasMTPInterface(devicePath, entry.Name()) {
+			continue
+		}
+		var device usbDevice
+		device.name = entry.Name()
+		device.busNum = readAttribute(devicePath, "busnum")
+		device.devNum = readAttribute(devicePath, "devnum")
+		device.vendorID = readAttribute(devicePath, "idVendor")
+		device.productID = readAttribute(devicePath, "idProduct")
+		device.manufacturer = readAttribute(devicePath, "manufacturer")
+		device.product = readAttribute(devicePath, "product")
+		device.serial = readAttribute(devicePath, "serial")
+		if len(device.busNum) == 0 || len(device.devNum) == 0 {
+			continue
+		}
+		result = append(result, device)
+	}
+	return result, nil
+}
+
+func hasMTPInterface(devicePath string, name string) bool {
+	interfaces, err := filepath.Glob(filepath.Join(devicePath, name+":*"))
+	if err != nil {
+		return false
+	}
+	for _, i := range interfaces {
+		if readAttribute(i, "bInterfaceClass") == "06" &&
+			readAttribute(i, "bInterfaceSubClass") == "01" &&
+			readAttribute(i, "bInterfaceProtocol") == "01" {
+			return true
+		}
+		if readAttribute(i, "interface") == "MTP" {
+			return true
+		}
+	}
+	return false
+}
+
+func readAttribute(path string, attribute string) string {
+	value, err := ioutil.ReadFile(filepath.Join(path, attribute))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(value))
+}
@@ -0,0 +1,36 @@
+package mtp
+
+type mtpMedia struct {
+	id     string
+	device *mtpDevice
+	// The name of the storage, "Internal shared storage"
+	storage string
+}
+
+func (s *mtpMedia) ID() string {
+	return s.id
+}
+
+func (s *mtpMedia) DisplayName() string {
+	if len(s.device.usb.product) > 0 {
+		return s.device.usb.product + " - " + s.storage
+	}
+	return s.storage
+}
+
+func (s *mtpMedia) Provider() string {
+	return "mtp"
+}
+
+func (s *mtpMedia) Properties() map[string]string {
+	result := make(map[string]string, 0)
+
+	result["storage"] = s.storage
+	result["manufacturer"] = s.device.usb.manufacturer
+	result["model"] = s.device.usb.product
+	result["serial"] = s.device.usb.serial
+	result["vendorId"] = s.device.usb.vendorID
+	result["productId"] = s.device.usb.productID
+
+	return result
+}
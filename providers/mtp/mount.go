@@ -0,0 +1,15 @@
+package mtp
+
+type mtpMount struct {
+	media     *mtpMedia
+	mountPath string
+	provider  *mtpProvider
+}
+
+func (s *mtpMount) Release() error {
+	return s.provider.Unmount(s.media.ID())
+}
+
+func (s *mtpMount) Location() string {
+	return s.mountPath
+}
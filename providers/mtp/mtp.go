@@ -0,0 +1,352 @@
+package mtp
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/olebedev/emitter"
+	"github.com/sirupsen/logrus"
+
+	"github.com/pauldotknopf/automounter/helpers"
+	"github.com/pauldotknopf/automounter/providers"
+)
+
+type mtpProvider struct {
+	options ProviderOptions
+	mutex   sync.Mutex
+	devices []*mtpDevice
+	media   []*mtpMedia
+	mounts  []*mtpMount
+	emit    *emitter.Emitter
+}
+
+type mtpDevice struct {
+	usb usbDevice
+	// Where the whole device is mounted with jmtpfs. Only one program
+	// can talk to the device at a time, so the storages are bind
+	// mounted from here.
+	stagingPath string
+	media       []*mtpMedia
+}
+
+// ProviderOptions .
+type ProviderOptions struct {
+	// How often we look for devices that were plugged in
+	PollInterval time.Duration
+}
+
+var invalidIDCharacters = regexp.MustCompile(`[^A-Za-z0-9]`)
+
+// Create a MTP media provider, for Android phones and other
+// devices that only talk MTP.
+func Create(options ProviderOptions) (providers.MediaProvider, error) {
+	p := &mtpProvider{}
+	p.options = options
+
+	p.emit = &emitter.Emitter{}
+	p.emit.Use("*", emitter.Void)
+
+	return p, nil
+}
+
+func (s *mtpProvider) Name() string {
+	return "mtp"
+}
+
+func (s *mtpProvider) Start(ctx context.Context) error {
+	s.scan()
+
+	ticker := time.NewTicker(s.options.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.scan()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (s *mtpProvider) GetMedia() []providers.Media {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := make([]providers.Media, 0)
+	for _, media := range s.media {
+		result = append(result, media)
+	}
+	return result
+}
+
+func (s *mtpProvider) GetMediaByID(id string) providers.Media {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, media := range s.media {
+		if media.ID() == id {
+			return media
+		}
+	}
+	return nil
+}
+
+func (s *mtpProvider) Mount(id string) (providers.MountSession, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Check to see if the storage is already mounted
+	for _, mount := range s.mounts {
+		if mount.media.id == id {
+			return &mtpMount{mount.media, mount.mountPath, s}, nil
+		}
+	}
+
+	for _, media := range s.media {
+		if media.id == id {
+			mountPath, err := helpers.GetTmpMountPath()
+			if err != nil {
+				return nil, err
+			}
+			storagePath := filepath.Join(media.device.stagingPath, media.storage)
+			output, err := exec.Command("mount", "--bind", storagePath, mountPath).CombinedOutput()
+			if err != nil {
+				os.Remove(mountPath)
+				logrus.Warnf("couldn't bind mount mtp storage %s: %s: %+v", storagePath, string(output), err)
+				return nil, fmt.Errorf("couldn't mount the storage")
+			}
+
+			mount := &mtpMount{media, mountPath, s}
+			s.mounts = append(s.mounts, mount)
+			s.emit.Emit("mediaMounted", id)
+			return mount, nil
+		}
+	}
+
+	return nil, providers.ErrIDNotFound
+}
+
+func (s *mtpProvider) Unmount(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for mountIndex, mount := range s.mounts {
+		if mount.media.id == id {
+			err := helpers.LazyUnmount(mount.mountPath)
+			if err != nil {
+				return err
+			}
+			s.mounts = append(s.mounts[:mountIndex], s.mounts[mountIndex+1:]...)
+			s.emit.Emit("mediaUnmounted", id)
+			return os.Remove(mount.mountPath)
+		}
+	}
+
+	return providers.ErrIDNotFound
+}
+
+func (s *mtpProvider) MediaAddded() (<-chan providers.Media, func()) {
+	out := make(chan providers.Media)
+	in := s.emit.On("mediaAdded", func(event *emitter.Event) {
+		out <- event.Args[0].(providers.Media)
+	})
+	cancel := func() {
+		s.emit.Off("mediaAdded", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+func (s *mtpProvider) MediaRemoved() (<-chan string, func()) {
+	out := make(chan string)
+	in := s.emit.On("mediaRemoved", func(event *emitter.Event) {
+		out <- event.String(0)
+	})
+	cancel := func() {
+		s.emit.Off("mediaRemoved", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+func (s *mtpProvider) MediaMounted() (<-chan string, func()) {
+	out := make(chan string)
+	in := s.emit.On("mediaMounted", func(event *emitter.Event) {
+		out <- event.String(0)
+	})
+	cancel := func() {
+		s.emit.Off("mediaMounted", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+func (s *mtpProvider) MediaUnmounted() (<-chan string, func()) {
+	out := make(chan string)
+	in := s.emit.On("mediaUnmounted", func(event *emitter.Event) {
+		out <- event.String(0)
+	})
+	cancel := func() {
+		s.emit.Off("mediaUnmounted", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+// scan Looks for devices that were plugged in or removed.
+func (s *mtpProvider) scan() {
+	detected, err := detectDevices()
+	if err != nil {
+		logrus.Warnf("couldn't look for mtp devices: %+v", err)
+		return
+	}
+
+	s.mutex.Lock()
+	for deviceIndex := 0; deviceIndex < len(s.devices); deviceIndex++ {
+		device := s.devices[deviceIndex]
+		if !containsDevice(detected, device.usb) {
+			s.deviceRemoved(device)
+			s.devices = append(s.devices[:deviceIndex], s.devices[deviceIndex+1:]...)
+			deviceIndex--
+		}
+	}
+	added := make([]usbDevice, 0)
+	for _, usb := range detected {
+		if !s.hasDevice(usb) {
+			added = append(added, usb)
+		}
+	}
+	s.mutex.Unlock()
+
+	// Mounting a device takes a while, don't hold up everyone else.
+	for _, usb := range added {
+		device, err := s.stage(usb)
+		if err != nil {
+			// The phone may be locked, or not set to transfer files.
+			// We'll try again on the next scan.
+			logrus.Debugf("couldn't mount mtp device %s: %+v", usb.product, err)
+			continue
+		}
+		s.mutex.Lock()
+		s.devices = append(s.devices, device)
+		for _, media := range device.media {
+			s.media = append(s.media, media)
+			s.emit.Emit("mediaAdded", media)
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// stage Mounts the whole device, and finds its storages.
+func (s *mtpProvider) stage(usb usbDevice) (*mtpDevice, error) {
+	stagingPath, err := helpers.GetTmpMountPath()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("jmtpfs", fmt.Sprintf("-device=%s,%s", usb.busNum, usb.devNum), stagingPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		os.Remove(stagingPath)
+		return nil, fmt.Errorf("%v: %s", err, string(output))
+	}
+
+	entries, err := ioutil.ReadDir(stagingPath)
+	if err == nil && len(entries) == 0 {
+		err = fmt.Errorf("the device has no storages")
+	}
+	if err != nil {
+		unstage(stagingPath)
+		return nil, err
+	}
+
+	device := &mtpDevice{}
+	device.usb = usb
+	device.stagingPath = stagingPath
+	for index, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		media := &mtpMedia{}
+		media.id = fmt.Sprintf("mtp-%s-%d", deviceID(usb), index)
+		media.device = device
+		media.storage = entry.Name()
+		device.media = append(device.media, media)
+	}
+
+	return device, nil
+}
+
+// deviceRemoved Removes the media of a device that was unplugged.
+// The mutex must be held.
+func (s *mtpProvider) deviceRemoved(device *mtpDevice) {
+	for _, media := range device.media {
+		for mountIndex, mount := range s.mounts {
+			if mount.media == media {
+				err := helpers.LazyUnmount(mount.mountPath)
+				if err != nil {
+					logrus.Warnf("couldn't unmount %s: %+v", mount.mountPath, err)
+				} else {
+					os.Remove(mount.mountPath)
+				}
+				s.mounts = append(s.mounts[:mountIndex], s.mounts[mountIndex+1:]...)
+				break
+			}
+		}
+		for mediaIndex, m := range s.media {
+			if m == media {
+				s.media = append(s.media[:mediaIndex], s.media[mediaIndex+1:]...)
+				break
+			}
+		}
+		s.emit.Emit("mediaUnmounted", media.id)
+		s.emit.Emit("mediaRemoved", media.id)
+	}
+	unstage(device.stagingPath)
+}
+
+// hasDevice The mutex must be held.
+func (s *mtpProvider) hasDevice(usb usbDevice) bool {
+	for _, device := range s.devices {
+		if device.usb.name == usb.name && device.usb.devNum == usb.devNum {
+			return true
+		}
+	}
+	return false
+}
+
+func containsDevice(devices []usbDevice, usb usbDevice) bool {
+	for _, device := range devices {
+		if device.name == usb.name && device.devNum == usb.devNum {
+			return true
+		}
+	}
+	return false
+}
+
+// unstage Unmounts the whole device. The mount paths are only ever
+// removed with os.Remove, so that files on the device are never deleted
+// if they are still mounted.
+func unstage(stagingPath string) {
+	output, err := exec.Command("fusermount", "-u", "-z", stagingPath).CombinedOutput()
+	if err != nil {
+		logrus.Warnf("couldn't unmount mtp device at %s: %s: %+v", stagingPath, string(output), err)
+		return
+	}
+	os.Remove(stagingPath)
+}
+
+// deviceID Identifies the device in the ids of its media,
+// by its serial number if it has one.
+func deviceID(usb usbDevice) string {
+	if len(usb.serial) > 0 {
+		return invalidIDCharacters.ReplaceAllString(usb.serial, "")
+	}
+	return fmt.Sprintf("%s%s-%s-%s", usb.vendorID, usb.productID, usb.busNum, usb.devNum)
+}
@@ -6,6 +6,7 @@ import (
 
 	"golang.org/x/sync/errgroup"
 
+	"github.com/pauldotknopf/automounter/helpers"
 	"github.com/pauldotknopf/automounter/providers"
 )
 
@@ -76,6 +77,31 @@ func (s *muxer) Mount(id string) (providers.MountSession, error) {
 	return nil, providers.ErrIDNotFound
 }
 
+func (s *muxer) MountWithOptions(id string, options []string) (providers.MountSession, error) {
+	for _, provider := range s.p {
+		var session providers.MountSession
+		var err error
+		if mounter, ok := provider.(providers.OptionsMounter); ok {
+			session, err = mounter.MountWithOptions(id, options)
+		} else if len(options) > 0 {
+			if provider.GetMediaByID(id) == nil {
+				continue
+			}
+			return nil, providers.ErrMountOptionsUnsupported
+		} else {
+			session, err = provider.Mount(id)
+		}
+		if err == providers.ErrIDNotFound {
+			continue
+		}
+		if err == nil {
+			return session, nil
+		}
+		return nil, err
+	}
+	return nil, providers.ErrIDNotFound
+}
+
 func (s *muxer) Unmount(id string) error {
 	for _, provider := range s.p {
 		err := provider.Unmount(id)
@@ -87,6 +113,37 @@ func (s *muxer) Unmount(id string) error {
 	return providers.ErrIDNotFound
 }
 
+func (s *muxer) RestoreMount(id string, location string) (providers.MountSession, error) {
+	for _, provider := range s.p {
+		restorer, ok := provider.(providers.MountRestorer)
+		if !ok {
+			continue
+		}
+		session, err := restorer.RestoreMount(id, location)
+		if err == providers.ErrIDNotFound {
+			continue
+		}
+		if err == nil {
+			return session, nil
+		}
+		return nil, err
+	}
+	return nil, providers.ErrIDNotFound
+}
+
+func (s *muxer) AdoptMount(mount helpers.MountInfo) (string, providers.MountSession) {
+	for _, provider := range s.p {
+		adopter, ok := provider.(providers.MountAdopter)
+		if !ok {
+			continue
+		}
+		if mediaID, session := adopter.AdoptMount(mount); session != nil {
+			return mediaID, session
+		}
+	}
+	return "", nil
+}
+
 func (s *muxer) MediaAddded() (<-chan providers.Media, func()) {
 	out := make(chan providers.Media)
 
@@ -0,0 +1,173 @@
+package muxer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/pauldotknopf/automounter/helpers"
+	"github.com/pauldotknopf/automounter/providers"
+	"github.com/pauldotknopf/automounter/providers/fake"
+)
+
+func createTestMuxer(t *testing.T) (providers.MediaProvider, fake.Provider, fake.Provider, func()) {
+	dir, err := ioutil.TempDir("", "muxer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := helpers.MountRoot()
+	helpers.SetMountRoot(filepath.Join(dir, "mounts"))
+
+	first, err := fake.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := fake.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Create(first, second), first, second, func() {
+		helpers.SetMountRoot(previous)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestMuxerMedia(t *testing.T) {
+	m, first, second, cleanup := createTestMuxer(t)
+	defer cleanup()
+
+	first.AddMedia(fake.Options{ID: "first-stick"})
+	second.AddMedia(fake.Options{ID: "second-stick"})
+	second.AddMedia(fake.Options{ID: "second-card"})
+
+	ids := make([]string, 0)
+	for _, media := range m.GetMedia() {
+		ids = append(ids, media.ID())
+	}
+	if len(ids) != 3 || ids[0] != "first-stick" {
+		t.Fatalf("expected the media of every provider in order, got %v", ids)
+	}
+
+	tests := []struct {
+		id    string
+		found bool
+	}{
+		{"first-stick", true},
+		{"second-card", true},
+		{"missing", false},
+	}
+	for _, test := range tests {
+		media := m.GetMediaByID(test.id)
+		if (media != nil) != test.found {
+			t.Errorf("expected found for %s to be %v", test.id, test.found)
+		}
+		if media != nil && media.ID() != test.id {
+			t.Errorf("expected %s, got %s", test.id, media.ID())
+		}
+	}
+}
+
+func TestMuxerMount(t *testing.T) {
+	m, first, second, cleanup := createTestMuxer(t)
+	defer cleanup()
+
+	first.AddMedia(fake.Options{ID: "first-stick"})
+	second.AddMedia(fake.Options{ID: "second-stick"})
+	mounter := m.(providers.OptionsMounter)
+
+	tests := []struct {
+		name    string
+		id      string
+		options []string
+		err     error
+	}{
+		{"first provider", "first-stick", nil, nil},
+		{"second provider", "second-stick", nil, nil},
+		{"missing", "missing", nil, providers.ErrIDNotFound},
+		{"options unsupported", "second-stick", []string{"ro"}, providers.ErrMountOptionsUnsupported},
+		{"options for missing media", "missing", []string{"ro"}, providers.ErrIDNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			session, err := mounter.MountWithOptions(test.id, test.options)
+			if err != test.err {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if !helpers.IsUnderMountRoot(session.Location()) {
+				t.Fatalf("expected the mount under the mount root, got %s", session.Location())
+			}
+			restored, err := m.(providers.MountRestorer).RestoreMount(test.id, session.Location())
+			if err != nil || restored.Location() != session.Location() {
+				t.Fatalf("expected the mount to be restored, got %v", err)
+			}
+			err = m.Unmount(test.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exists, _ := helpers.PathExists(session.Location()); exists {
+				t.Fatal("expected the mount to be removed")
+			}
+		})
+	}
+
+	if err := m.Unmount("missing"); err != providers.ErrIDNotFound {
+		t.Fatalf("expected %v, got %v", providers.ErrIDNotFound, err)
+	}
+	mediaID, session := m.(providers.MountAdopter).AdoptMount(helpers.MountInfo{MountPoint: filepath.Join(helpers.MountRoot(), "stale")})
+	if len(mediaID) > 0 || session != nil {
+		t.Fatal("expected nobody to adopt the mount")
+	}
+}
+
+func TestMuxerEvents(t *testing.T) {
+	m, first, second, cleanup := createTestMuxer(t)
+	defer cleanup()
+
+	added, cancelAdded := m.MediaAddded()
+	removed, cancelRemoved := m.MediaRemoved()
+
+	go func() {
+		first.AddMedia(fake.Options{ID: "first-stick"})
+		second.AddMedia(fake.Options{ID: "second-stick"})
+		first.RemoveMedia("first-stick")
+		second.RemoveMedia("second-stick")
+	}()
+
+	addedIDs := make([]string, 0)
+	for len(addedIDs) < 2 {
+		select {
+		case media := <-added:
+			addedIDs = append(addedIDs, media.ID())
+		case <-time.After(time.Second * 2):
+			t.Fatal("timed out waiting for added media")
+		}
+	}
+	removedIDs := make([]string, 0)
+	for len(removedIDs) < 2 {
+		select {
+		case id := <-removed:
+			removedIDs = append(removedIDs, id)
+		case <-time.After(time.Second * 2):
+			t.Fatal("timed out waiting for removed media")
+		}
+	}
+	for _, ids := range [][]string{addedIDs, removedIDs} {
+		sort.Strings(ids)
+		if ids[0] != "first-stick" || ids[1] != "second-stick" {
+			t.Fatalf("expected the events of both providers, got %v", ids)
+		}
+	}
+
+	cancelAdded()
+	cancelRemoved()
+	if _, ok := <-added; ok {
+		t.Fatal("expected the channel to be closed")
+	}
+}
@@ -0,0 +1,78 @@
+package nfs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pauldotknopf/automounter/helpers"
+	"github.com/sirupsen/logrus"
+)
+
+func (s *nfsProvider) buildMedia(options Options) *nfsMedia {
+	media := &nfsMedia{}
+	media.id = fmt.Sprintf("nfs-%s", options.Hash)
+	media.options = options
+	return media
+}
+
+func (s *nfsMount) unmount() error {
+	output, err := run("umount", s.options.UnmountArgs(s.mountPath)...)
+	if err != nil {
+		logrus.Errorf("couldn't unmount nfs directory %s: %+v: %s", s.mountPath, err, output)
+		return fmt.Errorf("couldn't unmount nfs directory")
+	}
+
+	err = os.RemoveAll(s.mountPath)
+	if err != nil {
+		logrus.Warnf("couldn't remove mount path %s after unmounting: %+v", s.mountPath, err)
+	}
+
+	return nil
+}
+
+func (s *nfsProvider) mount(media *nfsMedia) (*nfsMount, error) {
+	mount := &nfsMount{}
+	mount.id = media.ID()
+	mountPath, err := helpers.GetTmpMountPath()
+	if err != nil {
+		return nil, err
+	}
+	mount.mountPath = mountPath
+	mount.options = media.options
+	mount.provider = s
+
+	output, err := run("mount", media.options.MountArgs(mountPath)...)
+	if err != nil {
+		// We couldn't mount the export.
+		os.RemoveAll(mountPath)
+		logrus.Warningf("couldn't mount nfs export %s: %s: %+v", media.DisplayName(), output, err)
+		output = extractErrorsFromMountOutput(output)
+		if len(output) == 0 {
+			return nil, fmt.Errorf("could not mount")
+		}
+		return nil, fmt.Errorf("%s", output)
+	}
+
+	return mount, nil
+}
+
+// "mount.nfs: access denied by server while mounting nas:/srv/data"
+func extractErrorsFromMountOutput(output string) string {
+	var result bytes.Buffer
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		for _, prefix := range []string{"mount.nfs: ", "mount.nfs4: "} {
+			if strings.HasPrefix(line, prefix) {
+				if result.Len() > 0 {
+					result.WriteString(", ")
+				}
+				result.WriteString(strings.TrimPrefix(line, prefix))
+			}
+		}
+	}
+	return result.String()
+}
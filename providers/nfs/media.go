@@ -0,0 +1,33 @@
+package nfs
+
+type nfsMedia struct {
+	id      string
+	options Options
+	// Whether the export is remembered across restarts
+	persisted bool
+}
+
+func (s *nfsMedia) ID() string {
+	return s.id
+}
+
+func (s *nfsMedia) DisplayName() string {
+	return s.options.FriendlyName()
+}
+
+func (s *nfsMedia) Provider() string {
+	return "nfs"
+}
+
+func (s *nfsMedia) Properties() map[string]string {
+	result := make(map[string]string, 0)
+
+	result["server"] = s.options.Server
+	result["export"] = s.options.Export
+
+	for key, value := range s.options.Mount.properties() {
+		result[key] = value
+	}
+
+	return result
+}
@@ -0,0 +1,20 @@
+package nfs
+
+type nfsMount struct {
+	id        string
+	mountPath string
+	options   Options
+	provider  *nfsProvider
+	isDynamic bool
+}
+
+func (s *nfsMount) Release() error {
+	if s.isDynamic {
+		return s.provider.releaseDynamic(s)
+	}
+	return s.provider.Unmount(s.id)
+}
+
+func (s *nfsMount) Location() string {
+	return s.mountPath
+}
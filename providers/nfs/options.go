@@ -0,0 +1,233 @@
+package nfs
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pauldotknopf/automounter/helpers"
+)
+
+// Host names, IPv4 and IPv6 addresses.
+var validServer = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.\-:\[\]_]*$`)
+
+// Options .
+type Options struct {
+	Server string
+	// The exported path, "/srv/data"
+	Export string
+	Mount  MountOptions
+	Hash   string
+}
+
+// MountOptions Optional settings for how an export is mounted.
+// Empty values use the defaults of mount.nfs.
+type MountOptions struct {
+	// The NFS protocol version, "vers=", 3, 4, 4.0, 4.1 or 4.2.
+	// Negotiated by default.
+	Version string `json:"version"`
+	// The security flavor, "sec=", sys, krb5, krb5i or krb5p.
+	Security string `json:"security"`
+	ReadOnly bool   `json:"readOnly"`
+	// Give up on requests after the retransmissions, instead of
+	// retrying forever. Applications may see I/O errors.
+	Soft bool `json:"soft"`
+	// In tenths of a second, "timeo=".
+	Timeout int `json:"timeout"`
+	// How often a request is retried before giving up, "retrans=".
+	Retrans int `json:"retrans"`
+	// "tcp" or "udp", "proto=".
+	Protocol string `json:"protocol"`
+	Port     int    `json:"port"`
+	// Don't use the NLM lock protocol, NFSv3 only.
+	NoLock bool `json:"noLock"`
+}
+
+// CreateOptions .
+func CreateOptions(server string, export string, mount MountOptions) (Options, error) {
+	var result Options
+	result.Server = server
+	result.Export = export
+	result.Mount = mount
+
+	if len(result.Server) == 0 {
+		return result, fmt.Errorf("server is required")
+	}
+
+	if !validServer.MatchString(result.Server) {
+		return result, fmt.Errorf("invalid server")
+	}
+
+	if len(result.Export) == 0 {
+		return result, fmt.Errorf("export is required")
+	}
+
+	if !strings.HasPrefix(result.Export, "/") || helpers.HasControlCharacters(result.Export) {
+		return result, fmt.Errorf("invalid export, it must be an absolute path")
+	}
+
+	err := result.Mount.validate()
+	if err != nil {
+		return result, err
+	}
+
+	// Build a hash of all the parameters
+	var hashBytes bytes.Buffer
+	hashBytes.Write([]byte(result.Server))
+	hashBytes.Write([]byte(result.Export))
+	hashBytes.Write([]byte(fmt.Sprintf("%+v", result.Mount)))
+
+	result.Hash = fmt.Sprintf("%x", md5.Sum(hashBytes.Bytes()))
+
+	return result, nil
+}
+
+// FriendlyName .
+func (s Options) FriendlyName() string {
+	return s.Source()
+}
+
+// Source The device that is mounted, "server:/export", as
+// it shows up in /proc/self/mountinfo.
+func (s Options) Source() string {
+	server := s.Server
+	if strings.Contains(server, ":") && !strings.HasPrefix(server, "[") {
+		server = fmt.Sprintf("[%s]", server)
+	}
+	return fmt.Sprintf("%s:%s", server, s.Export)
+}
+
+// MountArgs The arguments to run "mount" with to mount these options.
+func (s Options) MountArgs(mountPoint string) []string {
+	return []string{"-t", "nfs", "-o", strings.Join(s.Mount.args(), ","), s.Source(), mountPoint}
+}
+
+// UnmountArgs The arguments to run "umount" with.
+func (s Options) UnmountArgs(mountPoint string) []string {
+	return []string{"-l", mountPoint}
+}
+
+func (s MountOptions) validate() error {
+	if len(s.Version) > 0 {
+		switch s.Version {
+		case "3":
+		case "4":
+		case "4.0":
+		case "4.1":
+		case "4.2":
+			break
+		default:
+			return fmt.Errorf("invalid version value")
+		}
+	}
+
+	if len(s.Security) > 0 {
+		switch s.Security {
+		case "sys":
+		case "krb5":
+		case "krb5i":
+		case "krb5p":
+			break
+		default:
+			return fmt.Errorf("invalid security value")
+		}
+	}
+
+	if s.Timeout < 0 {
+		return fmt.Errorf("invalid timeout")
+	}
+
+	if s.Retrans < 0 {
+		return fmt.Errorf("invalid retrans")
+	}
+
+	if len(s.Protocol) > 0 {
+		switch s.Protocol {
+		case "tcp":
+		case "udp":
+			break
+		default:
+			return fmt.Errorf("invalid protocol value")
+		}
+	}
+
+	if s.Protocol == "udp" && strings.HasPrefix(s.Version, "4") {
+		return fmt.Errorf("version 4 requires tcp")
+	}
+
+	if s.Port < 0 || s.Port > 65535 {
+		return fmt.Errorf("invalid port")
+	}
+
+	if s.NoLock && strings.HasPrefix(s.Version, "4") {
+		return fmt.Errorf("noLock is only used with version 3")
+	}
+
+	return nil
+}
+
+func (s MountOptions) args() []string {
+	result := make([]string, 0)
+	if len(s.Version) > 0 {
+		result = append(result, fmt.Sprintf("vers=%s", s.Version))
+	}
+	if len(s.Security) > 0 {
+		result = append(result, fmt.Sprintf("sec=%s", s.Security))
+	}
+	if s.Soft {
+		result = append(result, "soft")
+	} else {
+		result = append(result, "hard")
+	}
+	if s.Timeout > 0 {
+		result = append(result, fmt.Sprintf("timeo=%d", s.Timeout))
+	}
+	if s.Retrans > 0 {
+		result = append(result, fmt.Sprintf("retrans=%d", s.Retrans))
+	}
+	if len(s.Protocol) > 0 {
+		result = append(result, fmt.Sprintf("proto=%s", s.Protocol))
+	}
+	if s.Port > 0 {
+		result = append(result, fmt.Sprintf("port=%d", s.Port))
+	}
+	if s.NoLock {
+		result = append(result, "nolock")
+	}
+	if s.ReadOnly {
+		result = append(result, "ro")
+	} else {
+		result = append(result, "rw")
+	}
+	return result
+}
+
+// properties The options that were set, for displaying with the media.
+func (s MountOptions) properties() map[string]string {
+	result := make(map[string]string)
+	if len(s.Version) > 0 {
+		result["version"] = s.Version
+	}
+	if len(s.Security) > 0 {
+		result["security"] = s.Security
+	}
+	if s.Timeout > 0 {
+		result["timeout"] = strconv.Itoa(s.Timeout)
+	}
+	if s.Retrans > 0 {
+		result["retrans"] = strconv.Itoa(s.Retrans)
+	}
+	if len(s.Protocol) > 0 {
+		result["protocol"] = s.Protocol
+	}
+	if s.Port > 0 {
+		result["port"] = strconv.Itoa(s.Port)
+	}
+	result["readOnly"] = strconv.FormatBool(s.ReadOnly)
+	result["soft"] = strconv.FormatBool(s.Soft)
+	result["noLock"] = strconv.FormatBool(s.NoLock)
+	return result
+}
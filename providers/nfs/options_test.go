@@ -0,0 +1,75 @@
+package nfs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCreateOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		server string
+		export string
+		mount  MountOptions
+		err    string
+	}{
+		{"defaults", "nas", "/srv/data", MountOptions{}, ""},
+		{"ipv6", "fe80::1", "/srv/data", MountOptions{}, ""},
+		{"no server", "", "/srv/data", MountOptions{}, "server is required"},
+		{"bad server", "nas,nolock", "/srv/data", MountOptions{}, "invalid server"},
+		{"no export", "nas", "", MountOptions{}, "export is required"},
+		{"relative export", "nas", "srv/data", MountOptions{}, "invalid export"},
+		{"export with newline", "nas", "/srv/data\n", MountOptions{}, "invalid export"},
+		{"bad version", "nas", "/srv", MountOptions{Version: "5"}, "invalid version value"},
+		{"bad security", "nas", "/srv", MountOptions{Security: "none"}, "invalid security value"},
+		{"negative timeout", "nas", "/srv", MountOptions{Timeout: -1}, "invalid timeout"},
+		{"negative retrans", "nas", "/srv", MountOptions{Retrans: -1}, "invalid retrans"},
+		{"bad protocol", "nas", "/srv", MountOptions{Protocol: "rdma"}, "invalid protocol value"},
+		{"udp with version 4", "nas", "/srv", MountOptions{Version: "4.1", Protocol: "udp"}, "version 4 requires tcp"},
+		{"bad port", "nas", "/srv", MountOptions{Port: 65536}, "invalid port"},
+		{"nolock with version 4", "nas", "/srv", MountOptions{Version: "4", NoLock: true}, "noLock is only used with version 3"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options, err := CreateOptions(test.server, test.export, test.mount)
+			if len(test.err) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if len(options.Hash) == 0 {
+					t.Fatal("expected a hash")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected an error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestMountArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		server   string
+		mount    MountOptions
+		expected string
+	}{
+		{"defaults", "nas", MountOptions{}, "-t nfs -o hard,rw nas:/srv/data /mnt"},
+		{"ipv6", "fe80::1", MountOptions{}, "-t nfs -o hard,rw [fe80::1]:/srv/data /mnt"},
+		{"bracketed ipv6", "[fe80::1]", MountOptions{}, "-t nfs -o hard,rw [fe80::1]:/srv/data /mnt"},
+		{"version 3", "nas", MountOptions{Version: "3", Protocol: "udp", Port: 2049, NoLock: true, ReadOnly: true}, "-t nfs -o vers=3,hard,proto=udp,port=2049,nolock,ro nas:/srv/data /mnt"},
+		{"soft", "nas", MountOptions{Version: "4.2", Security: "krb5p", Soft: true, Timeout: 100, Retrans: 3}, "-t nfs -o vers=4.2,sec=krb5p,soft,timeo=100,retrans=3,rw nas:/srv/data /mnt"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := Options{Server: test.server, Export: "/srv/data", Mount: test.mount}
+			actual := strings.Join(options.MountArgs("/mnt"), " ")
+			if actual != test.expected {
+				t.Fatalf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
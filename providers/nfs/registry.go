@@ -0,0 +1,51 @@
+package nfs
+
+import "github.com/pauldotknopf/automounter/helpers"
+
+type registryExport struct {
+	Server string       `json:"server"`
+	Export string       `json:"export"`
+	Mount  MountOptions `json:"mount"`
+}
+
+type registryFile struct {
+	Exports []registryExport `json:"exports"`
+}
+
+type registry struct {
+	path string
+}
+
+func (s *registry) load() ([]Options, error) {
+	result := make([]Options, 0)
+
+	var exports registryFile
+	found, err := helpers.ReadJSONFile(s.path, &exports)
+	if err != nil || !found {
+		return result, err
+	}
+
+	for _, export := range exports.Exports {
+		options, err := CreateOptions(export.Server, export.Export, export.Mount)
+		if err != nil {
+			return result, err
+		}
+		result = append(result, options)
+	}
+
+	return result, nil
+}
+
+func (s *registry) save(media []*nfsMedia) error {
+	var exports registryFile
+	exports.Exports = make([]registryExport, 0)
+
+	for _, m := range media {
+		if !m.persisted {
+			continue
+		}
+		exports.Exports = append(exports.Exports, registryExport{m.options.Server, m.options.Export, m.options.Mount})
+	}
+
+	return helpers.WriteJSONFile(s.path, exports, 0644)
+}
@@ -3,11 +3,15 @@ package providers
 import (
 	"context"
 	"errors"
+
+	"github.com/pauldotknopf/automounter/helpers"
 )
 
 var (
 	// ErrIDNotFound An error indicating the given id wasn't found
 	ErrIDNotFound = errors.New("Item not found")
+	// ErrMountOptionsUnsupported The media can't be mounted with options
+	ErrMountOptionsUnsupported = errors.New("the media can't be mounted with options")
 )
 
 // MediaProvider The type that will detect and mount media
@@ -38,3 +42,37 @@ type Media interface {
 	Provider() string
 	Properties() map[string]string
 }
+
+// MountRestorer Implemented by providers that can re-attach
+// to a mount that was made before the daemon was restarted.
+type MountRestorer interface {
+	RestoreMount(id string, location string) (MountSession, error)
+}
+
+// MountAdopter Implemented by providers that can take ownership
+// of a mount that was left behind by a previous run of the daemon.
+type MountAdopter interface {
+	// Returns the id of the media and the session of the mount if
+	// the provider owns it, either already or by adopting it now,
+	// and a nil session otherwise.
+	AdoptMount(mount helpers.MountInfo) (string, MountSession)
+}
+
+// SecretMedia Implemented by media with properties that shouldn't
+// be exposed to everyone, like passwords.
+type SecretMedia interface {
+	// The keys of the properties that are secret
+	SecretProperties() []string
+}
+
+// OptionsMounter Implemented by providers that can mount
+// media with options, like "ro" or "uid=1000".
+type OptionsMounter interface {
+	MountWithOptions(id string, options []string) (MountSession, error)
+}
+
+// OptionsSession Implemented by mount sessions that know
+// the options the media was mounted with.
+type OptionsSession interface {
+	MountOptions() []string
+}
@@ -0,0 +1,229 @@
+package smb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// How long we give the network to answer a discovery request
+const discoveryTimeout = time.Second * 5
+
+// Server A SMB server found on the local network
+type Server struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Port    int    `json:"port"`
+	// How the server was found, "mdns" or "netbios"
+	Source string `json:"source"`
+}
+
+// Share A share on a server
+type Share struct {
+	Name    string `json:"name"`
+	Comment string `json:"comment"`
+}
+
+// ShareListOptions How to connect to a server to list its shares
+type ShareListOptions struct {
+	Server   string
+	Port     int
+	Secure   bool
+	Domain   string
+	Username string
+	Password string
+}
+
+// "Looking up status of 192.168.1.5"
+var nmblookupStatusRegex = regexp.MustCompile(`^Looking up status of (\S+)`)
+
+// "	NAS             <20> -         B <ACTIVE>"
+var nmblookupNameRegex = regexp.MustCompile(`^\s+(\S+)\s+<20>\s+-\s+(<GROUP>\s+)?`)
+
+func (s *smbProvider) DiscoverServers() ([]Server, error) {
+	result := make([]Server, 0)
+
+	mdnsServers, mdnsErr := discoverMDNS()
+	if mdnsErr != nil {
+		logrus.Warnf("couldn't browse for smb servers with mdns: %+v", mdnsErr)
+	}
+	netbiosServers, netbiosErr := discoverNetBIOS()
+	if netbiosErr != nil {
+		logrus.Warnf("couldn't browse for smb servers with netbios: %+v", netbiosErr)
+	}
+	if mdnsErr != nil && netbiosErr != nil {
+		return nil, fmt.Errorf("couldn't browse for smb servers")
+	}
+
+	// The same server is often announced both ways,
+	// and on IPv4 and IPv6. Prefer IPv4 addresses.
+	seen := make(map[string]int)
+	for _, server := range append(mdnsServers, netbiosServers...) {
+		name := strings.ToLower(server.Name)
+		if index, ok := seen[name]; ok {
+			if strings.Contains(result[index].Address, ":") && !strings.Contains(server.Address, ":") {
+				result[index] = server
+			}
+			continue
+		}
+		seen[name] = len(result)
+		result = append(result, server)
+	}
+
+	return result, nil
+}
+
+func (s *smbProvider) ListShares(options ShareListOptions) ([]Share, error) {
+	if !validServer.MatchString(options.Server) {
+		return nil, fmt.Errorf("invalid server")
+	}
+	if options.Port < 0 || options.Port > 65535 {
+		return nil, fmt.Errorf("invalid port")
+	}
+
+	args := []string{"-g", "-L", fmt.Sprintf("//%s", options.Server)}
+	if options.Port > 0 {
+		args = append(args, "-p", strconv.Itoa(options.Port))
+	}
+	if options.Secure {
+		if len(options.Username) == 0 {
+			return nil, fmt.Errorf("a secured connection cannot be made without a username")
+		}
+		// Like mounting, keep the password off of the command line.
+		authPath, err := writeAuthFile(options)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(authPath)
+		args = append(args, "-A", authPath)
+	} else {
+		args = append(args, "-N")
+	}
+
+	output, err := runWithTimeout("smbclient", args...)
+	if err != nil {
+		logrus.Warnf("couldn't list the shares of %s: %s: %+v", options.Server, output, err)
+		return nil, fmt.Errorf("couldn't list the shares of %s", options.Server)
+	}
+
+	// Disk|share|comment
+	result := make([]Share, 0)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "|", 3)
+		if len(fields) != 3 || fields[0] != "Disk" {
+			continue
+		}
+		// Hidden administrative shares (C$, ADMIN$)
+		if strings.HasSuffix(fields[1], "$") {
+			continue
+		}
+		result = append(result, Share{fields[1], fields[2]})
+	}
+
+	return result, nil
+}
+
+func discoverMDNS() ([]Server, error) {
+	output, err := runWithTimeout("avahi-browse", "--resolve", "--terminate", "--parsable", "_smb._tcp")
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, output)
+	}
+
+	// =;eth0;IPv4;NAS;_smb._tcp;local;nas.local;192.168.1.5;445;
+	result := make([]Server, 0)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ";")
+		if len(fields) < 9 || fields[0] != "=" {
+			continue
+		}
+		port, _ := strconv.Atoi(fields[8])
+		result = append(result, Server{unescapeAvahi(fields[3]), fields[7], port, "mdns"})
+	}
+	return result, nil
+}
+
+func discoverNetBIOS() ([]Server, error) {
+	output, err := runWithTimeout("nmblookup", "-S", "*")
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, output)
+	}
+
+	result := make([]Server, 0)
+	address := ""
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if match := nmblookupStatusRegex.FindStringSubmatch(line); match != nil {
+			address = match[1]
+			continue
+		}
+		// The <20> name is the file server service of the host.
+		if match := nmblookupNameRegex.FindStringSubmatch(line); match != nil && len(match[2]) == 0 && len(address) > 0 {
+			result = append(result, Server{match[1], address, 445, "netbios"})
+			address = ""
+		}
+	}
+	return result, nil
+}
+
+// avahi escapes special characters in names as "\032" (decimal).
+func unescapeAvahi(value string) string {
+	var result bytes.Buffer
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+3 < len(value) {
+			if c, err := strconv.Atoi(value[i+1 : i+4]); err == nil && c < 256 {
+				result.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		result.WriteByte(value[i])
+	}
+	return result.String()
+}
+
+func writeAuthFile(options ShareListOptions) (string, error) {
+	if strings.ContainsAny(options.Username+options.Password+options.Domain, "\r\n") {
+		return "", fmt.Errorf("the credentials can't contain line breaks")
+	}
+
+	var contents bytes.Buffer
+	contents.WriteString(fmt.Sprintf("username = %s\n", options.Username))
+	contents.WriteString(fmt.Sprintf("password = %s\n", options.Password))
+	if len(options.Domain) > 0 {
+		contents.WriteString(fmt.Sprintf("domain = %s\n", options.Domain))
+	}
+
+	file, err := ioutil.TempFile("", "automounter-smb-")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	_, err = file.Write(contents.Bytes())
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+func runWithTimeout(name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+	defer cancel()
+	logrus.Debugf("running %s %s", name, strings.Join(args, " "))
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	return string(out), err
+}
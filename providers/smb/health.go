@@ -0,0 +1,154 @@
+package smb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"github.com/pauldotknopf/automounter/helpers"
+)
+
+// checkHealth Probes every mount, and lets everyone know when one
+// stops (or starts again) responding. If enabled, mounts that stopped
+// responding are remounted at the same path, so leases stay valid.
+func (s *smbProvider) checkHealth() {
+	s.mutex.Lock()
+	mounts := make([]*smbMount, 0)
+	for _, mount := range append(s.mounts, s.dynamicMounts...) {
+		// A probe of a dead mount can hang for a long time,
+		// don't pile up more probes behind it.
+		if !mount.probing {
+			mount.probing = true
+			mounts = append(mounts, mount)
+		}
+	}
+	s.mutex.Unlock()
+
+	for _, m := range mounts {
+		go s.checkMount(m)
+	}
+}
+
+// checkMount Probes one mount, remounting it if it stopped responding.
+// The mutex is only held to update the state, the probe and the
+// remount can block for a long time on a dead server.
+func (s *smbProvider) checkMount(mount *smbMount) {
+	err := probe(mount.mountPath, s.options.HealthTimeout)
+
+	s.mutex.Lock()
+	if !s.isTracked(mount) {
+		// It was unmounted while we were probing.
+		mount.probing = false
+		s.mutex.Unlock()
+		return
+	}
+	if err == nil {
+		mount.probing = false
+		if mount.degraded {
+			mount.degraded = false
+			logrus.Infof("smb mount %s at %s recovered", mount.options.FriendlyName(), mount.mountPath)
+			s.emit.Emit("mediaRecovered", mount.id)
+		}
+		s.mutex.Unlock()
+		return
+	}
+	if !mount.degraded {
+		mount.degraded = true
+		logrus.Warnf("smb mount %s at %s isn't responding: %+v", mount.options.FriendlyName(), mount.mountPath, err)
+		s.emit.Emit("mediaDegraded", mount.id)
+	}
+	if !s.options.Remount {
+		mount.probing = false
+		s.mutex.Unlock()
+		return
+	}
+	// Still marked as probing, so nobody else remounts it meanwhile.
+	options := mount.options
+	mountPath := mount.mountPath
+	s.mutex.Unlock()
+
+	err = s.remount(options, mountPath)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	mount.probing = false
+	if err != nil {
+		// Still degraded, the next probe tries again.
+		logrus.Warnf("couldn't remount smb mount %s at %s: %+v", options.FriendlyName(), mountPath, err)
+		return
+	}
+	if !s.isTracked(mount) {
+		// It was unmounted while we were remounting.
+		go helpers.LazyUnmount(mountPath)
+		return
+	}
+	mount.degraded = false
+	logrus.Infof("remounted smb mount %s at %s", options.FriendlyName(), mountPath)
+	s.emit.Emit("mediaRecovered", mount.id)
+}
+
+// remount Replaces a dead mount with a new one at the same path.
+// The mount can't be made on top of the dead one, any access to it
+// hangs, so it is detached first. If the new mount fails, the path
+// is left as a plain directory, which the next probe catches.
+func (s *smbProvider) remount(options Options, mountPath string) error {
+	isMounted, err := helpers.IsMountPoint(mountPath)
+	if err != nil {
+		return err
+	}
+	if isMounted {
+		err = helpers.LazyUnmount(mountPath)
+		if err != nil {
+			return err
+		}
+	}
+	output, err := s.runMount(options, mountPath)
+	if err != nil {
+		output = extractErrorsFromMountOutput(output)
+		if len(output) == 0 {
+			return fmt.Errorf("could not mount")
+		}
+		return fmt.Errorf("%s", output)
+	}
+	return nil
+}
+
+// isTracked The mutex must be held.
+func (s *smbProvider) isTracked(mount *smbMount) bool {
+	for _, m := range append(s.mounts, s.dynamicMounts...) {
+		if m == mount {
+			return true
+		}
+	}
+	return false
+}
+
+// The filesystem types statfs reports for cifs mounts
+const (
+	cifsMagic = 0xFF534D42
+	smb2Magic = 0xFE534D42
+)
+
+// probe Runs statfs on the path, giving up after the timeout. The kernel
+// may block on a dead server for much longer, in which case the goroutine
+// doing the statfs is left behind until it returns. A path that isn't
+// a cifs mount anymore, like after a failed remount, is an error too.
+func probe(path string, timeout time.Duration) error {
+	result := make(chan error, 1)
+	go func() {
+		var stat unix.Statfs_t
+		err := unix.Statfs(path, &stat)
+		if err == nil && uint32(stat.Type) != cifsMagic && uint32(stat.Type) != smb2Magic {
+			err = fmt.Errorf("the share isn't mounted")
+		}
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+}
@@ -17,7 +17,7 @@ func (s *smbProvider) buildMedia(options Options) *smbMedia {
 }
 
 func (s *smbMount) unmount() error {
-	output, err := run(s.options.UnmountCommand(s.mountPath))
+	output, err := run("umount", s.options.UnmountArgs(s.mountPath)...)
 	if err != nil {
 		logrus.Errorf("couldn't unmount smb directory %s: %+v: %s", s.mountPath, err, output)
 		return fmt.Errorf("couldn't unmount smb directory")
@@ -31,7 +31,9 @@ func (s *smbMount) unmount() error {
 	return nil
 }
 
-func (s *smbProvider) mount(media *smbMedia) (*smbMount, error) {
+// mount Mounts the share, read-only if either
+// the share or the caller asks for it.
+func (s *smbProvider) mount(media *smbMedia, readOnly bool) (*smbMount, error) {
 	mount := &smbMount{}
 	mount.id = media.ID()
 	mountPath, err := helpers.GetTmpMountPath()
@@ -40,9 +42,12 @@ func (s *smbProvider) mount(media *smbMedia) (*smbMount, error) {
 	}
 	mount.mountPath = mountPath
 	mount.options = media.options
+	if readOnly {
+		mount.options.Mount.ReadOnly = true
+	}
 	mount.provider = s
 
-	output, err := run(media.options.MountCommand(mountPath))
+	output, err := s.runMount(mount.options, mountPath)
 	if err != nil {
 		// We couldn't mount the smb connection.
 		os.RemoveAll(mountPath)
@@ -0,0 +1,167 @@
+package smb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// How often we look for tickets that need renewing
+const ticketCheckInterval = time.Minute
+
+// ticketCache Keeps a kerberos credential cache per share, obtaining
+// the tickets from the keytabs and renewing them before they expire.
+//
+// cifs.upcall only uses these caches while mounting, it finds them through
+// the KRB5CCNAME of the mount process. When the kernel reconnects later on,
+// it looks in the default cache of the uid instead, so every ticket is put
+// in there as well. With a collection cache type like KEYRING or KCM, each
+// principal keeps its own ticket there. With a FILE cache only the last
+// one is kept, so shares using different principals won't all reconnect.
+type ticketCache struct {
+	mutex    sync.Mutex
+	dir      string
+	lifetime time.Duration
+	tickets  map[string]*ticket
+}
+
+type ticket struct {
+	path     string
+	obtained time.Time
+}
+
+func createTicketCache(dir string, lifetime time.Duration) *ticketCache {
+	return &ticketCache{dir: dir, lifetime: lifetime, tickets: make(map[string]*ticket)}
+}
+
+// ensure Returns the credential cache of the share ("FILE:/path"),
+// obtaining a new ticket if there is none or it is due for renewal.
+func (s *ticketCache) ensure(options Options) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	t, ok := s.tickets[options.Hash]
+	if ok && !s.isDue(t) {
+		return "FILE:" + t.path, nil
+	}
+
+	t, err := s.obtain(options)
+	if err != nil {
+		return "", err
+	}
+
+	return "FILE:" + t.path, nil
+}
+
+// renew Renews the tickets of the given shares that are due, and
+// destroys the tickets of the shares that are no longer mounted.
+func (s *ticketCache) renew(mounted []Options) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	current := make(map[string]bool)
+	for _, options := range mounted {
+		if current[options.Hash] {
+			continue
+		}
+		current[options.Hash] = true
+		// Mounted before we were started, the kernel
+		// needs a ticket once it reconnects.
+		t, ok := s.tickets[options.Hash]
+		if ok && !s.isDue(t) {
+			continue
+		}
+		_, err := s.obtain(options)
+		if err != nil {
+			logrus.Warnf("couldn't renew the kerberos ticket of %s for %s: %+v", options.Kerberos.Principal, options.FriendlyName(), err)
+			continue
+		}
+		logrus.Debugf("renewed the kerberos ticket of %s for %s", options.Kerberos.Principal, options.FriendlyName())
+	}
+
+	for hash, t := range s.tickets {
+		if !current[hash] {
+			err := os.Remove(t.path)
+			if err != nil && !os.IsNotExist(err) {
+				logrus.Warnf("couldn't remove kerberos credential cache %s: %+v", t.path, err)
+			}
+			delete(s.tickets, hash)
+		}
+	}
+}
+
+// obtain Gets a new ticket into the cache of the share, and
+// into the default cache for reconnects. The mutex must be held.
+func (s *ticketCache) obtain(options Options) (*ticket, error) {
+	t, ok := s.tickets[options.Hash]
+	if !ok {
+		t = &ticket{path: filepath.Join(s.dir, "krb5cc_"+options.Hash)}
+	}
+
+	err := s.kinit(options.Kerberos, "FILE:"+t.path)
+	if err != nil {
+		return nil, err
+	}
+	t.obtained = time.Now()
+	s.tickets[options.Hash] = t
+
+	// An empty cache is the default one.
+	err = s.kinit(options.Kerberos, "")
+	if err != nil {
+		// The mount still works, only reconnecting doesn't.
+		logrus.Warnf("couldn't put the kerberos ticket of %s in the default cache: %+v", options.Kerberos.Principal, err)
+	}
+
+	return t, nil
+}
+
+// isDue Tickets are renewed halfway through their lifetime, which
+// leaves plenty of room if the KDC is unreachable for a while.
+func (s *ticketCache) isDue(t *ticket) bool {
+	return time.Since(t.obtained) > s.lifetime/2
+}
+
+func (s *ticketCache) kinit(options KerberosOptions, cache string) error {
+	err := os.MkdirAll(s.dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"-k", "-l", fmt.Sprintf("%ds", int(s.lifetime.Seconds()))}
+	if len(cache) > 0 {
+		args = append(args, "-c", cache)
+	}
+	if len(options.Keytab) > 0 {
+		args = append(args, "-t", options.Keytab)
+	}
+	args = append(args, options.Principal)
+
+	output, err := run("kinit", args...)
+	if err != nil {
+		return fmt.Errorf("kinit failed: %v: %s", err, output)
+	}
+	return nil
+}
+
+func (s *smbProvider) CheckKeytab(path string) error {
+	if len(s.options.KeytabDir) == 0 {
+		return fmt.Errorf("no keytab directory is configured, so keytabs can't be used here")
+	}
+	if len(path) == 0 {
+		return fmt.Errorf("a keytab from the keytab directory is required")
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	relative, err := filepath.Rel(filepath.Clean(s.options.KeytabDir), resolved)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, "../") {
+		return fmt.Errorf("the keytab must be in the keytab directory")
+	}
+	return nil
+}
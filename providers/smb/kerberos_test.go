@@ -0,0 +1,133 @@
+package smb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useFakeKinit Puts a kinit on the path that records its arguments,
+// and returns a function that reads them back, one call per line.
+func useFakeKinit(t *testing.T, dir string) func() []string {
+	bin := filepath.Join(dir, "bin")
+	err := os.MkdirAll(bin, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := filepath.Join(dir, "calls")
+	script := "#!/bin/sh\necho \"$*\" >> " + calls + "\n"
+	err = ioutil.WriteFile(filepath.Join(bin, "kinit"), []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := os.Getenv("PATH")
+	os.Setenv("PATH", bin+":"+previous)
+	t.Cleanup(func() { os.Setenv("PATH", previous) })
+
+	return func() []string {
+		content, _ := ioutil.ReadFile(calls)
+		os.Remove(calls)
+		if len(content) == 0 {
+			return nil
+		}
+		return strings.Split(strings.TrimSpace(string(content)), "\n")
+	}
+}
+
+func TestTicketCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "smb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	calls := useFakeKinit(t, dir)
+
+	options := Options{Hash: "abc", Security: "krb5"}
+	options.Kerberos.Principal = "backup@EXAMPLE.COM"
+	cacheDir := filepath.Join(dir, "krb5")
+	cache := createTicketCache(cacheDir, time.Minute*10)
+
+	ccache, err := cache.ensure(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ccache != "FILE:"+filepath.Join(cacheDir, "krb5cc_abc") {
+		t.Fatalf("unexpected credential cache %s", ccache)
+	}
+	// The share's cache for mounting, and the default one for reconnects.
+	expected := []string{
+		"-k -l 600s -c " + ccache + " backup@EXAMPLE.COM",
+		"-k -l 600s backup@EXAMPLE.COM",
+	}
+	if actual := calls(); strings.Join(actual, "|") != strings.Join(expected, "|") {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+
+	tests := []struct {
+		name    string
+		age     time.Duration
+		mounted []Options
+		kinits  int
+		kept    bool
+	}{
+		{"fresh", time.Minute, []Options{options}, 0, true},
+		{"due", time.Minute * 6, []Options{options}, 2, true},
+		{"mounted twice", time.Minute * 6, []Options{options, options}, 2, true},
+		{"unmounted", time.Minute * 6, nil, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cache.ensure(options)
+			calls()
+			cache.tickets[options.Hash].obtained = time.Now().Add(-test.age)
+
+			cache.renew(test.mounted)
+			if actual := calls(); len(actual) != test.kinits {
+				t.Fatalf("expected %d kinits, got %v", test.kinits, actual)
+			}
+			if _, ok := cache.tickets[options.Hash]; ok != test.kept {
+				t.Fatalf("expected the ticket to be kept: %v", test.kept)
+			}
+		})
+	}
+}
+
+func TestCreateKerberosOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		security string
+		kerberos KerberosOptions
+		err      string
+	}{
+		{"ticket of cifs.upcall", "krb5", KerberosOptions{}, ""},
+		{"principal", "krb5i", KerberosOptions{Principal: "backup@EXAMPLE.COM"}, ""},
+		{"keytab", "krb5", KerberosOptions{Principal: "host/nas@EXAMPLE.COM", Keytab: "/etc/keytabs/nas.keytab"}, ""},
+		{"principal without kerberos", "ntlmssp", KerberosOptions{Principal: "backup@EXAMPLE.COM"}, "only be used with the krb5 and krb5i"},
+		{"bad principal", "krb5", KerberosOptions{Principal: "backup @EXAMPLE.COM"}, "invalid principal"},
+		{"keytab without principal", "krb5", KerberosOptions{Keytab: "/etc/krb5.keytab"}, "a keytab requires a principal"},
+		{"relative keytab", "krb5", KerberosOptions{Principal: "backup@EXAMPLE.COM", Keytab: "nas.keytab"}, "must be an absolute path"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// No username is needed, the ticket is the credential.
+			options, err := CreateOptions("nas", "files", test.security, true, "", "", "", MountOptions{}, test.kerberos)
+			if len(test.err) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !options.UsesKerberos() {
+					t.Fatal("expected the options to use kerberos")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected an error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
@@ -3,6 +3,10 @@ package smb
 type smbMedia struct {
 	id      string
 	options Options
+	// Whether the share is remembered across restarts
+	persisted bool
+	// Whether the share is in the config, see SetConfiguredShares
+	configured bool
 }
 
 func (s *smbMedia) ID() string {
@@ -31,6 +35,16 @@ func (s *smbMedia) Properties() map[string]string {
 	result["domain"] = s.options.Domain
 	result["username"] = s.options.Username
 	result["password"] = s.options.Password
+	result["principal"] = s.options.Kerberos.Principal
+	result["keytab"] = s.options.Kerberos.Keytab
+
+	for key, value := range s.options.Mount.properties() {
+		result[key] = value
+	}
 
 	return result
 }
+
+func (s *smbMedia) SecretProperties() []string {
+	return []string{"password"}
+}
@@ -6,11 +6,14 @@ type smbMount struct {
 	options   Options
 	provider  *smbProvider
 	isDynamic bool
+	// The health of the mount, see checkHealth
+	probing  bool
+	degraded bool
 }
 
 func (s *smbMount) Release() error {
 	if s.isDynamic {
-		return s.unmount()
+		return s.provider.releaseDynamic(s)
 	}
 	return s.provider.Unmount(s.id)
 }
@@ -18,3 +21,10 @@ func (s *smbMount) Release() error {
 func (s *smbMount) Location() string {
 	return s.mountPath
 }
+
+func (s *smbMount) MountOptions() []string {
+	if s.options.Mount.ReadOnly {
+		return []string{"ro"}
+	}
+	return []string{"rw"}
+}
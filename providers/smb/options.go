@@ -4,9 +4,26 @@ import (
 	"bytes"
 	"crypto/md5"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+
+	"github.com/pauldotknopf/automounter/helpers"
 )
 
+// Host names, IPv4 and IPv6 addresses.
+var validServer = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.\-:\[\]_]*$`)
+
+// A numeric id, or a user/group name.
+var validOwner = regexp.MustCompile(`^([0-9]+|[a-z_][a-z0-9_\-]*\$?)$`)
+
+var validMode = regexp.MustCompile(`^0?[0-7]{3,4}$`)
+
+var validCharset = regexp.MustCompile(`^[A-Za-z0-9_.\-]+$`)
+
 // Options .
 type Options struct {
 	Server   string
@@ -16,11 +33,45 @@ type Options struct {
 	Domain   string
 	Username string
 	Password string
+	Mount    MountOptions
+	Kerberos KerberosOptions
 	Hash     string
 }
 
+// KerberosOptions The principal whose ticket is used to mount shares
+// with the krb5 and krb5i security modes. A ticket is obtained from
+// the keytab, so that no password has to be stored. If the principal is
+// empty, cifs.upcall looks for a ticket of its own.
+type KerberosOptions struct {
+	// "user@REALM", or "host/name@REALM"
+	Principal string `json:"principal"`
+	// The keytab with the key of the principal, the default
+	// keytab of the system (/etc/krb5.keytab) if empty.
+	Keytab string `json:"keytab"`
+}
+
+// MountOptions Optional settings for how a share is mounted.
+// Empty values use the defaults of mount.cifs.
+type MountOptions struct {
+	// The SMB protocol version, "vers=", negotiated by default.
+	Version string `json:"version"`
+	// The owner of the files, "uid=" and "gid=".
+	UID string `json:"uid"`
+	GID string `json:"gid"`
+	// Octal permissions, "file_mode=" and "dir_mode=".
+	FileMode string `json:"fileMode"`
+	DirMode  string `json:"dirMode"`
+	ReadOnly bool   `json:"readOnly"`
+	// The caching mode, "cache=", strict, none or loose.
+	Cache string `json:"cache"`
+	// Encrypt the connection, requires SMB 3.
+	Seal      bool   `json:"seal"`
+	Port      int    `json:"port"`
+	IOCharset string `json:"iocharset"`
+}
+
 // CreateOptions .
-func CreateOptions(server string, share string, security string, secure bool, domain string, username string, password string) (Options, error) {
+func CreateOptions(server string, share string, security string, secure bool, domain string, username string, password string, mount MountOptions, kerberos KerberosOptions) (Options, error) {
 	var result Options
 	result.Server = server
 	result.Share = share
@@ -29,15 +80,39 @@ func CreateOptions(server string, share string, security string, secure bool, do
 	result.Domain = domain
 	result.Username = username
 	result.Password = password
+	result.Mount = mount
+	result.Kerberos = kerberos
 
 	if len(result.Server) == 0 {
 		return result, fmt.Errorf("server is requierd")
 	}
 
+	if !validServer.MatchString(result.Server) {
+		return result, fmt.Errorf("invalid server")
+	}
+
 	if len(result.Share) == 0 {
 		return result, fmt.Errorf("share is required")
 	}
 
+	if strings.HasPrefix(result.Share, "/") || strings.Contains(result.Share, "\\") || helpers.HasControlCharacters(result.Share) {
+		return result, fmt.Errorf("invalid share")
+	}
+
+	// These are written to the credentials file one per line,
+	// and the domain is passed on to the kernel as an option.
+	if strings.ContainsAny(result.Domain, ",=/\\") || helpers.HasControlCharacters(result.Domain) {
+		return result, fmt.Errorf("invalid domain")
+	}
+
+	if helpers.HasControlCharacters(result.Username) {
+		return result, fmt.Errorf("invalid username")
+	}
+
+	if strings.ContainsAny(result.Password, "\r\n") {
+		return result, fmt.Errorf("the password can't contain line breaks")
+	}
+
 	if len(result.Security) > 0 {
 		switch security {
 		case "none":
@@ -55,12 +130,35 @@ func CreateOptions(server string, share string, security string, secure bool, do
 		}
 	}
 
-	if result.Secure {
+	if len(result.Kerberos.Principal) > 0 && !result.UsesKerberos() {
+		return result, fmt.Errorf("a principal can only be used with the krb5 and krb5i security values")
+	}
+
+	if strings.ContainsAny(result.Kerberos.Principal, " ") || helpers.HasControlCharacters(result.Kerberos.Principal) {
+		return result, fmt.Errorf("invalid principal")
+	}
+
+	if len(result.Kerberos.Keytab) > 0 {
+		if len(result.Kerberos.Principal) == 0 {
+			return result, fmt.Errorf("a keytab requires a principal")
+		}
+		if !filepath.IsAbs(result.Kerberos.Keytab) || helpers.HasControlCharacters(result.Kerberos.Keytab) {
+			return result, fmt.Errorf("the keytab must be an absolute path")
+		}
+	}
+
+	// With kerberos, the ticket is the credential.
+	if result.Secure && !result.UsesKerberos() {
 		if len(result.Username) == 0 {
 			return result, fmt.Errorf("a secured connection cannot be made without a username")
 		}
 	}
 
+	err := result.Mount.validate()
+	if err != nil {
+		return result, err
+	}
+
 	// Build a hash of all the parameters
 	var hashBytes bytes.Buffer
 	hashBytes.Write([]byte(result.Server))
@@ -74,6 +172,8 @@ func CreateOptions(server string, share string, security string, secure bool, do
 	hashBytes.Write([]byte(result.Domain))
 	hashBytes.Write([]byte(result.Username))
 	hashBytes.Write([]byte(result.Password))
+	hashBytes.Write([]byte(fmt.Sprintf("%+v", result.Mount)))
+	hashBytes.Write([]byte(fmt.Sprintf("%+v", result.Kerberos)))
 
 	result.Hash = fmt.Sprintf("%x", md5.Sum(hashBytes.Bytes()))
 
@@ -85,35 +185,204 @@ func (s Options) FriendlyName() string {
 	return fmt.Sprintf("//%s/%s", s.Server, s.Share)
 }
 
-// MountCommand The shell command to mount these options
-func (s Options) MountCommand(mountPoint string) string {
-	var opts bytes.Buffer
+// MountArgs The arguments to run "mount" with to mount these options.
+// The username, password and domain are read from credentialsPath, see
+// WriteCredentials. If the connection isn't secure, or kerberos is
+// used, it may be empty.
+func (s Options) MountArgs(mountPoint string, credentialsPath string) []string {
+	opts := make([]string, 0)
+
+	switch {
+	case s.UsesKerberos():
+		// cifs.upcall finds the ticket through the
+		// KRB5CCNAME of the process doing the mount.
+	case s.Secure:
+		opts = append(opts, fmt.Sprintf("credentials=%s", credentialsPath))
+	default:
+		opts = append(opts, "guest")
+	}
+
+	if len(s.Security) > 0 {
+		opts = append(opts, fmt.Sprintf("sec=%s", s.Security))
+	}
 
-	if s.Secure {
-		// escape single quotes in password character as it will be quoted in command line
-		opts.WriteString(fmt.Sprintf("username='%s',", strings.Replace(s.Username, "'", "\\'", -1)))
+	opts = append(opts, "noperm")
+	opts = append(opts, s.Mount.args()...)
+
+	return []string{"-t", "cifs", "-o", strings.Join(opts, ","), s.FriendlyName(), mountPoint}
+}
+
+// UnmountArgs The arguments to run "umount" with.
+func (s Options) UnmountArgs(mountPoint string) []string {
+	return []string{"-l", mountPoint}
+}
+
+// WriteCredentials Writes the username, password and domain to a file
+// that only we can read, so that they never show up on a command line.
+// The caller must remove the file once the mount is done.
+func (s Options) WriteCredentials() (string, error) {
+	file, err := ioutil.TempFile("", "automounter-smb-")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// TempFile creates the file with 0600, but let's not rely on it.
+	err = file.Chmod(0600)
+	if err == nil {
+		var contents bytes.Buffer
+		contents.WriteString(fmt.Sprintf("username=%s\n", s.Username))
 		if len(s.Password) > 0 {
-			opts.WriteString(fmt.Sprintf("password='%s',", strings.Replace(s.Password, "'", "\\'", -1)))
+			contents.WriteString(fmt.Sprintf("password=%s\n", s.Password))
 		}
 		if len(s.Domain) > 0 {
-			opts.WriteString(fmt.Sprintf("domain=%s,", s.Domain))
+			contents.WriteString(fmt.Sprintf("domain=%s\n", s.Domain))
 		}
-	} else {
-		opts.WriteString("guest,")
+		_, err = file.Write(contents.Bytes())
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
 	}
 
-	if len(s.Security) > 0 {
-		opts.WriteString(fmt.Sprintf("sec=%s,", s.Security))
+	return file.Name(), nil
+}
+
+// UsesKerberos If the share is mounted with a kerberos ticket
+func (s Options) UsesKerberos() bool {
+	return s.Security == "krb5" || s.Security == "krb5i"
+}
+
+func (s MountOptions) validate() error {
+	if len(s.Version) > 0 {
+		switch s.Version {
+		case "1.0":
+		case "2.0":
+		case "2.1":
+		case "3":
+		case "3.0":
+		case "3.02":
+		case "3.1.1":
+		case "3.11":
+		case "default":
+			break
+		default:
+			return fmt.Errorf("invalid version value")
+		}
+	}
+
+	if len(s.UID) > 0 && !validOwner.MatchString(s.UID) {
+		return fmt.Errorf("invalid uid")
+	}
+
+	if len(s.GID) > 0 && !validOwner.MatchString(s.GID) {
+		return fmt.Errorf("invalid gid")
+	}
+
+	if len(s.FileMode) > 0 && !validMode.MatchString(s.FileMode) {
+		return fmt.Errorf("invalid file mode, it must be octal")
+	}
+
+	if len(s.DirMode) > 0 && !validMode.MatchString(s.DirMode) {
+		return fmt.Errorf("invalid dir mode, it must be octal")
+	}
+
+	if len(s.Cache) > 0 {
+		switch s.Cache {
+		case "strict":
+		case "none":
+		case "loose":
+			break
+		default:
+			return fmt.Errorf("invalid cache value")
+		}
+	}
+
+	if s.Seal {
+		switch s.Version {
+		case "1.0":
+		case "2.0":
+		case "2.1":
+			return fmt.Errorf("seal requires version 3 or newer")
+		}
 	}
 
-	opts.WriteString("noperm,rw ")
+	if s.Port < 0 || s.Port > 65535 {
+		return fmt.Errorf("invalid port")
+	}
 
-	opts.WriteString(fmt.Sprintf("\"//%s/%s\" %s", s.Server, s.Share, mountPoint))
+	if len(s.IOCharset) > 0 && !validCharset.MatchString(s.IOCharset) {
+		return fmt.Errorf("invalid iocharset")
+	}
 
-	return fmt.Sprintf("mount -t cifs -o %s", opts.String())
+	return nil
 }
 
-// UnmountCommand .
-func (s Options) UnmountCommand(mountPoint string) string {
-	return fmt.Sprintf("umount -l %s", mountPoint)
+func (s MountOptions) args() []string {
+	result := make([]string, 0)
+	if len(s.Version) > 0 {
+		result = append(result, fmt.Sprintf("vers=%s", s.Version))
+	}
+	if len(s.UID) > 0 {
+		result = append(result, fmt.Sprintf("uid=%s", s.UID))
+	}
+	if len(s.GID) > 0 {
+		result = append(result, fmt.Sprintf("gid=%s", s.GID))
+	}
+	if len(s.FileMode) > 0 {
+		result = append(result, fmt.Sprintf("file_mode=%s", s.FileMode))
+	}
+	if len(s.DirMode) > 0 {
+		result = append(result, fmt.Sprintf("dir_mode=%s", s.DirMode))
+	}
+	if len(s.Cache) > 0 {
+		result = append(result, fmt.Sprintf("cache=%s", s.Cache))
+	}
+	if s.Seal {
+		result = append(result, "seal")
+	}
+	if s.Port > 0 {
+		result = append(result, fmt.Sprintf("port=%d", s.Port))
+	}
+	if len(s.IOCharset) > 0 {
+		result = append(result, fmt.Sprintf("iocharset=%s", s.IOCharset))
+	}
+	if s.ReadOnly {
+		result = append(result, "ro")
+	} else {
+		result = append(result, "rw")
+	}
+	return result
+}
+
+// properties The options that were set, for displaying with the media.
+func (s MountOptions) properties() map[string]string {
+	result := make(map[string]string)
+	if len(s.Version) > 0 {
+		result["version"] = s.Version
+	}
+	if len(s.UID) > 0 {
+		result["uid"] = s.UID
+	}
+	if len(s.GID) > 0 {
+		result["gid"] = s.GID
+	}
+	if len(s.FileMode) > 0 {
+		result["fileMode"] = s.FileMode
+	}
+	if len(s.DirMode) > 0 {
+		result["dirMode"] = s.DirMode
+	}
+	if len(s.Cache) > 0 {
+		result["cache"] = s.Cache
+	}
+	if s.Port > 0 {
+		result["port"] = strconv.Itoa(s.Port)
+	}
+	if len(s.IOCharset) > 0 {
+		result["iocharset"] = s.IOCharset
+	}
+	result["readOnly"] = strconv.FormatBool(s.ReadOnly)
+	result["seal"] = strconv.FormatBool(s.Seal)
+	return result
 }
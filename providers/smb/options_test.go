@@ -0,0 +1,176 @@
+package smb
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCreateOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		server   string
+		share    string
+		security string
+		secure   bool
+		domain   string
+		username string
+		password string
+		err      string
+	}{
+		{"guest", "nas", "files", "", false, "", "", "", ""},
+		{"secure", "nas.local", "files/backups", "ntlmssp", true, "WORKGROUP", "paul", "p@ss, word", ""},
+		{"ipv6", "fe80::1", "files", "", false, "", "", "", ""},
+		{"no server", "", "files", "", false, "", "", "", "server is requierd"},
+		{"bad server", "nas;reboot", "files", "", false, "", "", "", "invalid server"},
+		{"no share", "nas", "", "", false, "", "", "", "share is required"},
+		{"absolute share", "nas", "/files", "", false, "", "", "", "invalid share"},
+		{"backslash share", "nas", "files\\backups", "", false, "", "", "", "invalid share"},
+		{"bad domain", "nas", "files", "", true, "WORK,GROUP", "paul", "", "invalid domain"},
+		{"bad username", "nas", "files", "", true, "", "paul\nroot", "", "invalid username"},
+		{"bad password", "nas", "files", "", true, "", "paul", "pass\nword", "line breaks"},
+		{"bad security", "nas", "files", "plaintext", false, "", "", "", "invalid security value"},
+		{"secure without username", "nas", "files", "", true, "", "", "secret", "without a username"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options, err := CreateOptions(test.server, test.share, test.security, test.secure, test.domain, test.username, test.password, MountOptions{}, KerberosOptions{})
+			if len(test.err) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if len(options.Hash) == 0 {
+					t.Fatal("expected a hash")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected an error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestCreateOptionsHash(t *testing.T) {
+	first, _ := CreateOptions("nas", "files", "", true, "", "paul", "secret", MountOptions{}, KerberosOptions{})
+	same, _ := CreateOptions("nas", "files", "", true, "", "paul", "secret", MountOptions{}, KerberosOptions{})
+	other, _ := CreateOptions("nas", "files", "", true, "", "paul", "other", MountOptions{}, KerberosOptions{})
+	if first.Hash != same.Hash {
+		t.Fatal("expected the same options to have the same hash")
+	}
+	if first.Hash == other.Hash {
+		t.Fatal("expected different options to have different hashes")
+	}
+}
+
+func TestMountArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		security string
+		secure   bool
+		username string
+		expected string
+	}{
+		{"guest", "", false, "", "-t cifs -o guest,noperm,rw //nas/files /mnt"},
+		{"credentials", "ntlmssp", true, "paul", "-t cifs -o credentials=/tmp/creds,sec=ntlmssp,noperm,rw //nas/files /mnt"},
+		{"kerberos", "krb5", true, "", "-t cifs -o sec=krb5,noperm,rw //nas/files /mnt"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options, err := CreateOptions("nas", "files", test.security, test.secure, "", test.username, "", MountOptions{}, KerberosOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The password never shows up on the command line.
+			actual := strings.Join(options.MountArgs("/mnt", "/tmp/creds"), " ")
+			if actual != test.expected {
+				t.Fatalf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestWriteCredentials(t *testing.T) {
+	tests := []struct {
+		name     string
+		domain   string
+		password string
+		expected string
+	}{
+		{"username only", "", "", "username=paul\n"},
+		{"everything", "WORKGROUP", "p@ss, word", "username=paul\npassword=p@ss, word\ndomain=WORKGROUP\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options, err := CreateOptions("nas", "files", "", true, test.domain, "paul", test.password, MountOptions{}, KerberosOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			path, err := options.WriteCredentials()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(path)
+
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0600 {
+				t.Fatalf("expected only us to be able to read the file, got %v", info.Mode().Perm())
+			}
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != test.expected {
+				t.Fatalf("expected %q, got %q", test.expected, content)
+			}
+		})
+	}
+}
+
+func TestMountOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		mount    MountOptions
+		expected string
+		err      string
+	}{
+		{"defaults", MountOptions{}, "rw", ""},
+		{"everything", MountOptions{Version: "3.0", UID: "1000", GID: "users", FileMode: "0644", DirMode: "755", ReadOnly: true, Cache: "strict", Seal: true, Port: 4445, IOCharset: "utf8"}, "vers=3.0,uid=1000,gid=users,file_mode=0644,dir_mode=755,cache=strict,seal,port=4445,iocharset=utf8,ro", ""},
+		{"bad version", MountOptions{Version: "4"}, "", "invalid version value"},
+		{"bad uid", MountOptions{UID: "paul,setuids"}, "", "invalid uid"},
+		{"bad gid", MountOptions{GID: "Users"}, "", "invalid gid"},
+		{"bad file mode", MountOptions{FileMode: "0999"}, "", "invalid file mode"},
+		{"bad dir mode", MountOptions{DirMode: "rwx"}, "", "invalid dir mode"},
+		{"bad cache", MountOptions{Cache: "fast"}, "", "invalid cache value"},
+		{"seal on smb 2", MountOptions{Version: "2.1", Seal: true}, "", "seal requires version 3"},
+		{"bad port", MountOptions{Port: 70000}, "", "invalid port"},
+		{"bad iocharset", MountOptions{IOCharset: "utf8,uid=0"}, "", "invalid iocharset"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options, err := CreateOptions("nas", "files", "", false, "", "", "", test.mount, KerberosOptions{})
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected an error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			args := options.MountArgs("/mnt", "")
+			expected := "guest,noperm," + test.expected
+			if args[3] != expected {
+				t.Fatalf("expected %q, got %q", expected, args[3])
+			}
+		})
+	}
+}
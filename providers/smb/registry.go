@@ -0,0 +1,93 @@
+package smb
+
+import "github.com/pauldotknopf/automounter/helpers"
+
+// The shares are stored without their passwords, which are kept
+// in a separate file that only root can read.
+type registryShare struct {
+	Server   string       `json:"server"`
+	Share    string       `json:"share"`
+	Security string       `json:"security"`
+	Secure   bool         `json:"secure"`
+	Domain   string       `json:"domain"`
+	Username string       `json:"username"`
+	Mount    MountOptions `json:"mount"`
+	// The keytab is a path, the key itself isn't stored.
+	Kerberos KerberosOptions `json:"kerberos"`
+	// Used to find the password in the secrets file.
+	ID string `json:"id"`
+}
+
+type registryFile struct {
+	Shares []registryShare `json:"shares"`
+}
+
+type secretsFile struct {
+	Passwords map[string]string `json:"passwords"`
+}
+
+type registry struct {
+	path        string
+	secretsPath string
+}
+
+func (s *registry) load() ([]Options, error) {
+	result := make([]Options, 0)
+
+	var shares registryFile
+	found, err := helpers.ReadJSONFile(s.path, &shares)
+	if err != nil || !found {
+		return result, err
+	}
+
+	var secrets secretsFile
+	_, err = helpers.ReadJSONFile(s.secretsPath, &secrets)
+	if err != nil {
+		return result, err
+	}
+
+	for _, share := range shares.Shares {
+		options, err := CreateOptions(share.Server, share.Share, share.Security, share.Secure, share.Domain, share.Username, secrets.Passwords[share.ID], share.Mount, share.Kerberos)
+		if err != nil {
+			return result, err
+		}
+		result = append(result, options)
+	}
+
+	return result, nil
+}
+
+func (s *registry) save(media []*smbMedia) error {
+	var shares registryFile
+	shares.Shares = make([]registryShare, 0)
+	var secrets secretsFile
+	secrets.Passwords = make(map[string]string)
+
+	for _, m := range media {
+		if !m.persisted {
+			continue
+		}
+		var share registryShare
+		share.Server = m.options.Server
+		share.Share = m.options.Share
+		share.Security = m.options.Security
+		share.Secure = m.options.Secure
+		share.Domain = m.options.Domain
+		share.Username = m.options.Username
+		share.Mount = m.options.Mount
+		share.Kerberos = m.options.Kerberos
+		share.ID = m.id
+		shares.Shares = append(shares.Shares, share)
+		if len(m.options.Password) > 0 {
+			secrets.Passwords[m.id] = m.options.Password
+		}
+	}
+
+	// Write the secrets first, so that a share is never
+	// stored without the password it needs.
+	err := helpers.WriteJSONFile(s.secretsPath, secrets, 0600)
+	if err != nil {
+		return err
+	}
+	return helpers.WriteJSONFile(s.path, shares, 0644)
+}
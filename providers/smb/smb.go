@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
@@ -18,28 +20,83 @@ import (
 )
 
 type smbProvider struct {
-	mutex  sync.Mutex
-	media  []*smbMedia
-	mounts []*smbMount
-	emit   *emitter.Emitter
+	mutex   sync.Mutex
+	options ProviderOptions
+	media   []*smbMedia
+	mounts  []*smbMount
+	// The mounts of dynamic leases, which aren't
+	// shared with the registered media.
+	dynamicMounts []*smbMount
+	emit          *emitter.Emitter
+	registry      *registry
+	tickets       *ticketCache
+}
+
+// ProviderOptions .
+type ProviderOptions struct {
+	// Where the shares that are persisted are stored, with their
+	// passwords in SecretsPath. If RegistryPath is empty, shares
+	// are only kept in memory.
+	RegistryPath string
+	SecretsPath  string
+	// How often the mounts are checked, zero to never check them.
+	HealthInterval time.Duration
+	// How long a mount has to respond before it is considered degraded.
+	HealthTimeout time.Duration
+	// Remount degraded mounts at the same path.
+	Remount bool
+	// Where the kerberos credential caches of the shares are kept,
+	// and the lifetime requested for their tickets.
+	TicketCacheDir string
+	TicketLifetime time.Duration
+	// Where keytabs that didn't come from the config must be, see CheckKeytab.
+	KeytabDir string
 }
 
 // Provider .
 type Provider interface {
 	providers.MediaProvider
 	TestConnection(options Options) error
-	AddMedia(options Options) (providers.Media, error)
+	// Add a share. Persisted shares are remembered across restarts.
+	AddMedia(options Options, persist bool) (providers.Media, error)
 	RemoveMedia(mediaID string) error
-	DynamicLease(options Options, l leaser.Leaser) (leaser.Lease, providers.Media, error)
+	// Replace the shares from the config. Shares that were
+	// also added through the web API are kept.
+	SetConfiguredShares(shares []Options) error
+	// Browse the local network for smb servers
+	DiscoverServers() ([]Server, error)
+	ListShares(options ShareListOptions) ([]Share, error)
+	// Mounts that stopped responding, and ones that came back.
+	MediaDegraded() (<-chan string, func())
+	MediaRecovered() (<-chan string, func())
+	DynamicLease(options Options, leaseOptions leaser.LeaseOptions, l leaser.Leaser) (leaser.Lease, providers.Media, error)
+	// Makes sure a keytab that didn't come from the config
+	// is in the keytab directory.
+	CheckKeytab(path string) error
 }
 
-// Create a udisks block device media provider
-func Create() (Provider, error) {
+// Create a smb media provider
+func Create(options ProviderOptions) (Provider, error) {
 	p := &smbProvider{}
+	p.options = options
+	p.tickets = createTicketCache(options.TicketCacheDir, options.TicketLifetime)
 
 	p.emit = &emitter.Emitter{}
 	p.emit.Use("*", emitter.Void)
 
+	if len(options.RegistryPath) > 0 {
+		p.registry = &registry{options.RegistryPath, options.SecretsPath}
+		options, err := p.registry.load()
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range options {
+			media := p.buildMedia(o)
+			media.persisted = true
+			p.media = append(p.media, media)
+		}
+	}
+
 	return p, nil
 }
 
@@ -48,8 +105,33 @@ func (s *smbProvider) Name() string {
 }
 
 func (s *smbProvider) Start(ctx context.Context) error {
-	<-ctx.Done()
-	return nil
+	// Let everyone know about the shares we loaded from the registry.
+	s.mutex.Lock()
+	for _, media := range s.media {
+		s.emit.Emit("mediaAdded", media)
+	}
+	s.mutex.Unlock()
+
+	var healthTicks <-chan time.Time
+	if s.options.HealthInterval > 0 {
+		healthTicker := time.NewTicker(s.options.HealthInterval)
+		defer healthTicker.Stop()
+		healthTicks = healthTicker.C
+	}
+
+	ticketTicker := time.NewTicker(ticketCheckInterval)
+	defer ticketTicker.Stop()
+
+	for {
+		select {
+		case <-healthTicks:
+			s.checkHealth()
+		case <-ticketTicker.C:
+			s.renewTickets()
+		case <-ctx.Done():
+			return nil
+		}
+	}
 }
 
 func (s *smbProvider) GetMedia() []providers.Media {
@@ -75,13 +157,30 @@ func (s *smbProvider) GetMediaByID(id string) providers.Media {
 }
 
 func (s *smbProvider) Mount(id string) (providers.MountSession, error) {
+	return s.MountWithOptions(id, nil)
+}
+
+// MountWithOptions Only "ro" is supported, the other
+// options are part of the share (see MountOptions).
+func (s *smbProvider) MountWithOptions(id string, options []string) (providers.MountSession, error) {
+	readOnly := false
+	for _, option := range options {
+		if option != "ro" {
+			return nil, fmt.Errorf("the mount option %s isn't supported for smb shares, only ro", option)
+		}
+		readOnly = true
+	}
+
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
 	// Check to see if the device is already mounted
 	for _, mount := range s.mounts {
 		if mount.id == id {
-			return &smbMount{id, mount.mountPath, mount.options, s, false}, nil
+			if readOnly && !mount.options.Mount.ReadOnly {
+				return nil, fmt.Errorf("the share is already mounted read-write")
+			}
+			return &smbMount{id: id, mountPath: mount.mountPath, options: mount.options, provider: s}, nil
 		}
 	}
 
@@ -89,7 +188,7 @@ func (s *smbProvider) Mount(id string) (providers.MountSession, error) {
 	for _, media := range s.media {
 		if media.id == id {
 			// We are trying to mount this smb media
-			mount, err := s.mount(media)
+			mount, err := s.mount(media, readOnly)
 			if err != nil {
 				return nil, err
 			}
@@ -121,6 +220,77 @@ func (s *smbProvider) Unmount(id string) error {
 	return providers.ErrIDNotFound
 }
 
+func (s *smbProvider) RestoreMount(id string, location string) (providers.MountSession, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, media := range s.media {
+		if media.id == id {
+			isMounted, err := helpers.IsMountPoint(location)
+			if err != nil {
+				return nil, err
+			}
+			if !isMounted {
+				return nil, fmt.Errorf("media is no longer mounted at %s", location)
+			}
+			mount := &smbMount{}
+			mount.id = id
+			mount.mountPath = location
+			mount.options = media.options
+			mount.provider = s
+			// It may have been mounted read-only for a lease,
+			// which has to be kept when it is remounted.
+			readOnly, err := helpers.IsReadOnlyMount(location)
+			if err != nil {
+				return nil, err
+			}
+			mount.options.Mount.ReadOnly = readOnly
+			s.mounts = append(s.mounts, mount)
+			return mount, nil
+		}
+	}
+
+	return nil, providers.ErrIDNotFound
+}
+
+func (s *smbProvider) AdoptMount(mountInfo helpers.MountInfo) (string, providers.MountSession) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, mount := range s.mounts {
+		if mount.mountPath == mountInfo.MountPoint {
+			return mount.id, mount
+		}
+	}
+
+	if mountInfo.FSType != "cifs" {
+		return "", nil
+	}
+
+	// Only adopt the mount if it belongs to a share we know about,
+	// and we don't already have that share mounted somewhere else.
+	for _, media := range s.media {
+		if media.options.FriendlyName() != mountInfo.Source {
+			continue
+		}
+		for _, mount := range s.mounts {
+			if mount.id == media.id {
+				return "", nil
+			}
+		}
+		mount := &smbMount{}
+		mount.id = media.id
+		mount.mountPath = mountInfo.MountPoint
+		mount.options = media.options
+		mount.options.Mount.ReadOnly = strings.Contains(","+mountInfo.Options+",", ",ro,")
+		mount.provider = s
+		s.mounts = append(s.mounts, mount)
+		return mount.id, mount
+	}
+
+	return "", nil
+}
+
 func (s *smbProvider) MediaAddded() (<-chan providers.Media, func()) {
 	out := make(chan providers.Media)
 	in := s.emit.On("mediaAdded", func(event *emitter.Event) {
@@ -169,6 +339,30 @@ func (s *smbProvider) MediaUnmounted() (<-chan string, func()) {
 	return out, cancel
 }
 
+func (s *smbProvider) MediaDegraded() (<-chan string, func()) {
+	out := make(chan string)
+	in := s.emit.On("mediaDegraded", func(event *emitter.Event) {
+		out <- event.String(0)
+	})
+	cancel := func() {
+		s.emit.Off("mediaDegraded", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+func (s *smbProvider) MediaRecovered() (<-chan string, func()) {
+	out := make(chan string)
+	in := s.emit.On("mediaRecovered", func(event *emitter.Event) {
+		out <- event.String(0)
+	})
+	cancel := func() {
+		s.emit.Off("mediaRecovered", in)
+		close(out)
+	}
+	return out, cancel
+}
+
 func (s *smbProvider) TestConnection(options Options) error {
 	tmpMountPath, err := helpers.GetTmpMountPath()
 	if err != nil {
@@ -176,7 +370,7 @@ func (s *smbProvider) TestConnection(options Options) error {
 	}
 	defer os.Remove(tmpMountPath)
 
-	output, err := run(options.MountCommand(tmpMountPath))
+	output, err := s.runMount(options, tmpMountPath)
 	if err != nil {
 		// We had an error, let's see if we can get the error from the output
 		logrus.Warnf("error testing mount for %s: %s: %+v", options.FriendlyName(), output, err)
@@ -187,7 +381,7 @@ func (s *smbProvider) TestConnection(options Options) error {
 		return fmt.Errorf(output)
 	}
 
-	output, err = run(options.UnmountCommand(tmpMountPath))
+	output, err = run("umount", options.UnmountArgs(tmpMountPath)...)
 	if err != nil {
 		logrus.Warnf("error removing mount after test for %s: %s: %+v", options.FriendlyName(), output, err)
 	}
@@ -195,7 +389,7 @@ func (s *smbProvider) TestConnection(options Options) error {
 	return nil
 }
 
-func (s *smbProvider) AddMedia(options Options) (providers.Media, error) {
+func (s *smbProvider) AddMedia(options Options, persist bool) (providers.Media, error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
@@ -204,13 +398,29 @@ func (s *smbProvider) AddMedia(options Options) (providers.Media, error) {
 	for _, media := range s.media {
 		if media.options.Hash == options.Hash {
 			// Just act as if we added it.
+			if persist && !media.persisted {
+				media.persisted = true
+				err := s.saveRegistry()
+				if err != nil {
+					media.persisted = false
+					return nil, err
+				}
+			}
 			return media, nil
 		}
 	}
 
 	// Add it as a new item.
 	media := s.buildMedia(options)
+	media.persisted = persist
 	s.media = append(s.media, media)
+	if persist {
+		err := s.saveRegistry()
+		if err != nil {
+			s.media = s.media[:len(s.media)-1]
+			return nil, err
+		}
+	}
 	s.emit.Emit("mediaAdded", media)
 
 	return media, nil
@@ -228,7 +438,21 @@ func (s *smbProvider) RemoveMedia(mediaID string) error {
 	// that is already present.
 	for mediaIndex, media := range s.media {
 		if media.id == mediaID {
+			if media.configured {
+				if !media.persisted {
+					return fmt.Errorf("the share is in the config, it can only be removed from there")
+				}
+				// Only forget that it was also added through the API.
+				media.persisted = false
+				return s.saveRegistry()
+			}
 			s.media = append(s.media[:mediaIndex], s.media[mediaIndex+1:]...)
+			if media.persisted {
+				err := s.saveRegistry()
+				if err != nil {
+					logrus.Errorf("couldn't remove smb share %s from the registry: %+v", media.DisplayName(), err)
+				}
+			}
 			s.emit.Emit("mediaRemoved", mediaID)
 			// We are choosing to not unmount now,
 			// since there may be mounts/leases currently in effect.
@@ -241,14 +465,59 @@ func (s *smbProvider) RemoveMedia(mediaID string) error {
 	return providers.ErrIDNotFound
 }
 
-func (s *smbProvider) DynamicLease(options Options, l leaser.Leaser) (leaser.Lease, providers.Media, error) {
+func (s *smbProvider) SetConfiguredShares(shares []Options) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	current := make(map[string]bool)
+	for _, options := range shares {
+		current[options.Hash] = true
+		found := false
+		for _, media := range s.media {
+			if media.options.Hash == options.Hash {
+				media.configured = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			media := s.buildMedia(options)
+			media.configured = true
+			s.media = append(s.media, media)
+			s.emit.Emit("mediaAdded", media)
+		}
+	}
+
+	for mediaIndex := 0; mediaIndex < len(s.media); mediaIndex++ {
+		media := s.media[mediaIndex]
+		if !media.configured || current[media.options.Hash] {
+			continue
+		}
+		media.configured = false
+		if media.persisted {
+			// It was added through the API as well, so it stays.
+			continue
+		}
+		s.media = append(s.media[:mediaIndex], s.media[mediaIndex+1:]...)
+		mediaIndex--
+		s.emit.Emit("mediaRemoved", media.id)
+	}
+
+	return nil
+}
+
+func (s *smbProvider) DynamicLease(options Options, leaseOptions leaser.LeaseOptions, l leaser.Leaser) (leaser.Lease, providers.Media, error) {
 	media := s.buildMedia(options)
-	lease, err := l.LeaseDynamic(media.ID(), func() (providers.MountSession, error) {
-		result, err := s.mount(media)
-		if result != nil {
-			result.isDynamic = true
+	lease, err := l.LeaseDynamic(media, leaseOptions, func() (providers.MountSession, error) {
+		result, err := s.mount(media, leaseOptions.Access == leaser.AccessReadOnly)
+		if err != nil {
+			return nil, err
 		}
-		return result, err
+		result.isDynamic = true
+		s.mutex.Lock()
+		s.dynamicMounts = append(s.dynamicMounts, result)
+		s.mutex.Unlock()
+		return result, nil
 	})
 	if err != nil {
 		return nil, nil, err
@@ -256,6 +525,42 @@ func (s *smbProvider) DynamicLease(options Options, l leaser.Leaser) (leaser.Lea
 	return lease, media, nil
 }
 
+func (s *smbProvider) releaseDynamic(mount *smbMount) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for mountIndex, m := range s.dynamicMounts {
+		if m == mount {
+			s.dynamicMounts = append(s.dynamicMounts[:mountIndex], s.dynamicMounts[mountIndex+1:]...)
+			break
+		}
+	}
+	return mount.unmount()
+}
+
+// renewTickets Renews the kerberos tickets of the mounted shares,
+// and destroys the tickets of the shares we unmounted.
+func (s *smbProvider) renewTickets() {
+	s.mutex.Lock()
+	mounted := make([]Options, 0)
+	for _, mount := range append(s.mounts, s.dynamicMounts...) {
+		if mount.options.UsesKerberos() && len(mount.options.Kerberos.Principal) > 0 {
+			mounted = append(mounted, mount.options)
+		}
+	}
+	s.mutex.Unlock()
+
+	s.tickets.renew(mounted)
+}
+
+// saveRegistry persists the shares. The mutex must be held.
+func (s *smbProvider) saveRegistry() error {
+	if s.registry == nil {
+		return nil
+	}
+	return s.registry.save(s.media)
+}
+
 func extractErrorsFromMountOutput(output string) string {
 	var result bytes.Buffer
 	regex := regexp.MustCompile(`mount error(\(.*\))?: (.*)`)
@@ -1,14 +1,53 @@
 package smb
 
 import (
-	"fmt"
+	"os"
 	"os/exec"
+	"strings"
+
+	"github.com/sirupsen/logrus"
 )
 
-func run(cmd string) (string, error) {
-	fmt.Println(cmd)
-	if out, err := exec.Command("sh", "-c", cmd).CombinedOutput(); err != nil {
+func run(name string, args ...string) (string, error) {
+	return runWithEnv(nil, name, args...)
+}
+
+// runWithEnv Runs the command with additional environment variables.
+func runWithEnv(env []string, name string, args ...string) (string, error) {
+	logrus.Debugf("running %s %s", name, strings.Join(args, " "))
+	cmd := exec.Command(name, args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
 		return string(out), err
 	}
 	return "", nil
 }
+
+// runMount Mounts the options at the given path, passing the credentials
+// through a file that is removed afterwards, or through a kerberos ticket.
+func (s *smbProvider) runMount(options Options, mountPath string) (string, error) {
+	if options.UsesKerberos() {
+		var env []string
+		if len(options.Kerberos.Principal) > 0 {
+			ccache, err := s.tickets.ensure(options)
+			if err != nil {
+				return "", err
+			}
+			env = append(env, "KRB5CCNAME="+ccache)
+		}
+		return runWithEnv(env, "mount", options.MountArgs(mountPath, "")...)
+	}
+
+	credentialsPath := ""
+	if options.Secure {
+		var err error
+		credentialsPath, err = options.WriteCredentials()
+		if err != nil {
+			return "", err
+		}
+		defer os.Remove(credentialsPath)
+	}
+	return run("mount", options.MountArgs(mountPath, credentialsPath)...)
+}
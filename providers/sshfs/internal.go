@@ -0,0 +1,117 @@
+package sshfs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pauldotknopf/automounter/helpers"
+	"github.com/sirupsen/logrus"
+)
+
+func (s *sshfsProvider) buildMedia(options Options) *sshfsMedia {
+	media := &sshfsMedia{}
+	media.id = fmt.Sprintf("sshfs-%s", options.Hash)
+	media.options = options
+	return media
+}
+
+// stateDirFor The state directory is named after the mount path, so
+// that it can be found again for mounts restored after a restart.
+func (s *sshfsProvider) stateDirFor(mountPath string) string {
+	return filepath.Join(s.options.StateDir, filepath.Base(mountPath))
+}
+
+func (s *sshfsMount) unmount() error {
+	output, err := run("", "fusermount", s.options.UnmountArgs(s.mountPath)...)
+	if err != nil {
+		logrus.Errorf("couldn't unmount sshfs directory %s: %+v: %s", s.mountPath, err, output)
+		return fmt.Errorf("couldn't unmount sshfs directory")
+	}
+
+	err = os.RemoveAll(s.mountPath)
+	if err != nil {
+		logrus.Warnf("couldn't remove mount path %s after unmounting: %+v", s.mountPath, err)
+	}
+
+	err = os.RemoveAll(s.stateDir)
+	if err != nil {
+		logrus.Warnf("couldn't remove state directory %s after unmounting: %+v", s.stateDir, err)
+	}
+
+	return nil
+}
+
+func (s *sshfsProvider) mount(media *sshfsMedia) (*sshfsMount, error) {
+	mount := &sshfsMount{}
+	mount.id = media.ID()
+	mountPath, err := helpers.GetTmpMountPath()
+	if err != nil {
+		return nil, err
+	}
+	mount.mountPath = mountPath
+	mount.stateDir = s.stateDirFor(mountPath)
+	mount.options = media.options
+	mount.provider = s
+
+	output, err := s.runMount(media.options, mountPath, mount.stateDir)
+	if err != nil {
+		// We couldn't mount the directory.
+		os.RemoveAll(mountPath)
+		os.RemoveAll(mount.stateDir)
+		logrus.Warningf("couldn't mount sshfs directory %s: %s: %+v", media.DisplayName(), output, err)
+		output = extractErrorsFromMountOutput(output)
+		if len(output) == 0 {
+			return nil, fmt.Errorf("could not mount")
+		}
+		return nil, fmt.Errorf("%s", output)
+	}
+
+	return mount, nil
+}
+
+// runMount Writes the private key and known hosts to the state
+// directory, which only root can read, and runs sshfs.
+func (s *sshfsProvider) runMount(options Options, mountPath string, stateDir string) (string, error) {
+	err := os.MkdirAll(stateDir, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	knownHostsPath := ""
+	if len(options.KnownHosts) > 0 {
+		knownHostsPath = filepath.Join(stateDir, "known_hosts")
+		err = ioutil.WriteFile(knownHostsPath, []byte(strings.TrimSpace(options.KnownHosts)+"\n"), 0600)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	identityPath := ""
+	stdin := ""
+	if len(options.PrivateKey) > 0 {
+		identityPath = filepath.Join(stateDir, "identity")
+		err = ioutil.WriteFile(identityPath, []byte(strings.TrimSpace(options.PrivateKey)+"\n"), 0600)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		stdin = options.Password + "\n"
+	}
+
+	return run(stdin, "sshfs", options.MountArgs(mountPath, knownHostsPath, identityPath)...)
+}
+
+// sshfs prints what ssh complained about, "Host key verification failed."
+func extractErrorsFromMountOutput(output string) string {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) > 0 {
+			lines = append(lines, strings.TrimSuffix(line, "."))
+		}
+	}
+	return strings.Join(lines, ", ")
+}
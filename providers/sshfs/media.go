@@ -0,0 +1,47 @@
+package sshfs
+
+import "strconv"
+
+type sshfsMedia struct {
+	id      string
+	options Options
+	// Whether the directory is remembered across restarts
+	persisted bool
+}
+
+func (s *sshfsMedia) ID() string {
+	return s.id
+}
+
+func (s *sshfsMedia) DisplayName() string {
+	return s.options.FriendlyName()
+}
+
+func (s *sshfsMedia) Provider() string {
+	return "sshfs"
+}
+
+func (s *sshfsMedia) Properties() map[string]string {
+	result := make(map[string]string, 0)
+
+	result["server"] = s.options.Server
+	result["port"] = "22"
+	if s.options.Port > 0 {
+		result["port"] = strconv.Itoa(s.options.Port)
+	}
+	result["username"] = s.options.Username
+	result["path"] = s.options.Path
+	result["password"] = s.options.Password
+	result["privateKey"] = s.options.PrivateKey
+	result["knownHosts"] = s.options.KnownHosts
+
+	for key, value := range s.options.Mount.properties() {
+		result[key] = value
+	}
+
+	return result
+}
+
+func (s *sshfsMedia) SecretProperties() []string {
+	return []string{"password", "privateKey"}
+}
@@ -0,0 +1,23 @@
+package sshfs
+
+type sshfsMount struct {
+	id        string
+	mountPath string
+	// Holds the private key and known hosts of the mount,
+	// which ssh needs again when it reconnects.
+	stateDir  string
+	options   Options
+	provider  *sshfsProvider
+	isDynamic bool
+}
+
+func (s *sshfsMount) Release() error {
+	if s.isDynamic {
+		return s.provider.releaseDynamic(s)
+	}
+	return s.provider.Unmount(s.id)
+}
+
+func (s *sshfsMount) Location() string {
+	return s.mountPath
+}
@@ -0,0 +1,234 @@
+package sshfs
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pauldotknopf/automounter/helpers"
+)
+
+// Host names, IPv4 and IPv6 addresses.
+var validServer = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.\-:\[\]_]*$`)
+
+var validUsername = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.\-]*$`)
+
+var validID = regexp.MustCompile(`^[0-9]+$`)
+
+// Options .
+type Options struct {
+	Server   string
+	Port     int
+	Username string
+	// The remote directory, relative to the home directory
+	// of the user if it doesn't start with "/".
+	Path string
+	// Either the password or the private key (in OpenSSH or
+	// PEM format) is used to log in.
+	Password   string
+	PrivateKey string
+	// The known_hosts lines the host key of the server is verified
+	// against. If empty, the known hosts of the system are used.
+	// Connecting to a server with an unknown host key always fails.
+	KnownHosts string
+	Mount      MountOptions
+	Hash       string
+}
+
+// MountOptions Optional settings for how a directory is mounted.
+type MountOptions struct {
+	ReadOnly bool `json:"readOnly"`
+	// Let users other than root access the mount, "allow_other".
+	AllowOther bool `json:"allowOther"`
+	// The numeric owner of the files, "uid=" and "gid=".
+	UID string `json:"uid"`
+	GID string `json:"gid"`
+	// Compress the traffic, useful on slow links.
+	Compression bool `json:"compression"`
+}
+
+// CreateOptions .
+func CreateOptions(server string, port int, username string, path string, password string, privateKey string, knownHosts string, mount MountOptions) (Options, error) {
+	var result Options
+	result.Server = server
+	result.Port = port
+	result.Username = username
+	result.Path = path
+	result.Password = password
+	result.PrivateKey = privateKey
+	result.KnownHosts = knownHosts
+	result.Mount = mount
+
+	if len(result.Server) == 0 {
+		return result, fmt.Errorf("server is required")
+	}
+
+	if !validServer.MatchString(result.Server) {
+		return result, fmt.Errorf("invalid server")
+	}
+
+	if result.Port < 0 || result.Port > 65535 {
+		return result, fmt.Errorf("invalid port")
+	}
+
+	if len(result.Username) == 0 {
+		return result, fmt.Errorf("username is required")
+	}
+
+	if !validUsername.MatchString(result.Username) {
+		return result, fmt.Errorf("invalid username")
+	}
+
+	if helpers.HasControlCharacters(result.Path) {
+		return result, fmt.Errorf("invalid path")
+	}
+
+	if len(result.Password) == 0 && len(result.PrivateKey) == 0 {
+		return result, fmt.Errorf("a password or a private key is required")
+	}
+
+	if len(result.Password) > 0 && len(result.PrivateKey) > 0 {
+		return result, fmt.Errorf("only one of password and private key can be used")
+	}
+
+	// sshfs reads the password from stdin, up to the line break.
+	if strings.ContainsAny(result.Password, "\r\n") {
+		return result, fmt.Errorf("the password can't contain line breaks")
+	}
+
+	if len(result.PrivateKey) > 0 && !strings.HasPrefix(strings.TrimSpace(result.PrivateKey), "-----BEGIN ") {
+		return result, fmt.Errorf("invalid private key")
+	}
+
+	err := result.Mount.validate()
+	if err != nil {
+		return result, err
+	}
+
+	// Build a hash of all the parameters
+	var hashBytes bytes.Buffer
+	hashBytes.Write([]byte(result.Server))
+	hashBytes.Write([]byte(strconv.Itoa(result.Port)))
+	hashBytes.Write([]byte(result.Username))
+	hashBytes.Write([]byte(result.Path))
+	hashBytes.Write([]byte(result.Password))
+	hashBytes.Write([]byte(result.PrivateKey))
+	hashBytes.Write([]byte(result.KnownHosts))
+	hashBytes.Write([]byte(fmt.Sprintf("%+v", result.Mount)))
+
+	result.Hash = fmt.Sprintf("%x", md5.Sum(hashBytes.Bytes()))
+
+	return result, nil
+}
+
+// FriendlyName .
+func (s Options) FriendlyName() string {
+	if s.Port > 0 {
+		return fmt.Sprintf("sftp://%s@%s:%d/%s", s.Username, s.Server, s.Port, strings.TrimPrefix(s.Path, "/"))
+	}
+	return fmt.Sprintf("sftp://%s@%s/%s", s.Username, s.Server, strings.TrimPrefix(s.Path, "/"))
+}
+
+// Source The remote directory, "user@server:path", as it
+// shows up in /proc/self/mountinfo.
+func (s Options) Source() string {
+	server := s.Server
+	if strings.Contains(server, ":") && !strings.HasPrefix(server, "[") {
+		server = fmt.Sprintf("[%s]", server)
+	}
+	return fmt.Sprintf("%s@%s:%s", s.Username, server, s.Path)
+}
+
+// MountArgs The arguments to run "sshfs" with to mount these options.
+// The host keys are read from knownHostsPath, and the private key from
+// identityPath. Both may be empty, to use the defaults of the system.
+func (s Options) MountArgs(mountPoint string, knownHostsPath string, identityPath string) []string {
+	opts := make([]string, 0)
+
+	// Never ask about unknown host keys.
+	opts = append(opts, "StrictHostKeyChecking=yes")
+	if len(knownHostsPath) > 0 {
+		opts = append(opts, fmt.Sprintf("UserKnownHostsFile=%s", knownHostsPath))
+		opts = append(opts, "GlobalKnownHostsFile=/dev/null")
+	}
+
+	if len(s.PrivateKey) > 0 {
+		opts = append(opts, fmt.Sprintf("IdentityFile=%s", identityPath))
+		opts = append(opts, "IdentitiesOnly=yes")
+		opts = append(opts, "PasswordAuthentication=no")
+		opts = append(opts, "BatchMode=yes")
+		// The key is still around when the connection drops,
+		// the password isn't.
+		opts = append(opts, "reconnect")
+	} else {
+		opts = append(opts, "password_stdin")
+		opts = append(opts, "PubkeyAuthentication=no")
+	}
+
+	opts = append(opts, "ServerAliveInterval=15")
+	opts = append(opts, "ServerAliveCountMax=3")
+	opts = append(opts, s.Mount.args()...)
+
+	args := []string{s.Source(), mountPoint, "-o", strings.Join(opts, ",")}
+	if s.Port > 0 {
+		args = append(args, "-p", strconv.Itoa(s.Port))
+	}
+	return args
+}
+
+// UnmountArgs The arguments to run "fusermount" with.
+func (s Options) UnmountArgs(mountPoint string) []string {
+	return []string{"-u", "-z", mountPoint}
+}
+
+func (s MountOptions) validate() error {
+	if len(s.UID) > 0 && !validID.MatchString(s.UID) {
+		return fmt.Errorf("invalid uid, it must be numeric")
+	}
+
+	if len(s.GID) > 0 && !validID.MatchString(s.GID) {
+		return fmt.Errorf("invalid gid, it must be numeric")
+	}
+
+	return nil
+}
+
+func (s MountOptions) args() []string {
+	result := make([]string, 0)
+	if s.AllowOther {
+		result = append(result, "allow_other")
+	}
+	if len(s.UID) > 0 {
+		result = append(result, fmt.Sprintf("uid=%s", s.UID))
+	}
+	if len(s.GID) > 0 {
+		result = append(result, fmt.Sprintf("gid=%s", s.GID))
+	}
+	if s.Compression {
+		result = append(result, "Compression=yes")
+	}
+	if s.ReadOnly {
+		result = append(result, "ro")
+	} else {
+		result = append(result, "rw")
+	}
+	return result
+}
+
+// properties The options that were set, for displaying with the media.
+func (s MountOptions) properties() map[string]string {
+	result := make(map[string]string)
+	if len(s.UID) > 0 {
+		result["uid"] = s.UID
+	}
+	if len(s.GID) > 0 {
+		result["gid"] = s.GID
+	}
+	result["readOnly"] = strconv.FormatBool(s.ReadOnly)
+	result["allowOther"] = strconv.FormatBool(s.AllowOther)
+	result["compression"] = strconv.FormatBool(s.Compression)
+	return result
+}
@@ -0,0 +1,93 @@
+package sshfs
+
+import "github.com/pauldotknopf/automounter/helpers"
+
+// The directories are stored without their passwords and private
+// keys, which are kept in a separate file that only root can read.
+type registryDirectory struct {
+	Server     string       `json:"server"`
+	Port       int          `json:"port"`
+	Username   string       `json:"username"`
+	Path       string       `json:"path"`
+	KnownHosts string       `json:"knownHosts"`
+	Mount      MountOptions `json:"mount"`
+	// Used to find the secrets in the secrets file.
+	ID string `json:"id"`
+}
+
+type registryFile struct {
+	Directories []registryDirectory `json:"directories"`
+}
+
+type secretsFile struct {
+	Passwords   map[string]string `json:"passwords"`
+	PrivateKeys map[string]string `json:"privateKeys"`
+}
+
+type registry struct {
+	path        string
+	secretsPath string
+}
+
+func (s *registry) load() ([]Options, error) {
+	result := make([]Options, 0)
+
+	var directories registryFile
+	found, err := helpers.ReadJSONFile(s.path, &directories)
+	if err != nil || !found {
+		return result, err
+	}
+
+	var secrets secretsFile
+	_, err = helpers.ReadJSONFile(s.secretsPath, &secrets)
+	if err != nil {
+		return result, err
+	}
+
+	for _, d := range directories.Directories {
+		options, err := CreateOptions(d.Server, d.Port, d.Username, d.Path, secrets.Passwords[d.ID], secrets.PrivateKeys[d.ID], d.KnownHosts, d.Mount)
+		if err != nil {
+			return result, err
+		}
+		result = append(result, options)
+	}
+
+	return result, nil
+}
+
+func (s *registry) save(media []*sshfsMedia) error {
+	var directories registryFile
+	directories.Directories = make([]registryDirectory, 0)
+	var secrets secretsFile
+	secrets.Passwords = make(map[string]string)
+	secrets.PrivateKeys = make(map[string]string)
+
+	for _, m := range media {
+		if !m.persisted {
+			continue
+		}
+		var d registryDirectory
+		d.Server = m.options.Server
+		d.Port = m.options.Port
+		d.Username = m.options.Username
+		d.Path = m.options.Path
+		d.KnownHosts = m.options.KnownHosts
+		d.Mount = m.options.Mount
+		d.ID = m.id
+		directories.Directories = append(directories.Directories, d)
+		if len(m.options.Password) > 0 {
+			secrets.Passwords[m.id] = m.options.Password
+		}
+		if len(m.options.PrivateKey) > 0 {
+			secrets.PrivateKeys[m.id] = m.options.PrivateKey
+		}
+	}
+
+	// Write the secrets first, so that a directory is never
+	// stored without the credentials it needs.
+	err := helpers.WriteJSONFile(s.secretsPath, secrets, 0600)
+	if err != nil {
+		return err
+	}
+	return helpers.WriteJSONFile(s.path, directories, 0644)
+}
@@ -0,0 +1,21 @@
+package sshfs
+
+import (
+	"os/exec"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// run Runs the command, writing stdin to it if it isn't empty.
+func run(stdin string, name string, args ...string) (string, error) {
+	logrus.Debugf("running %s %s", name, strings.Join(args, " "))
+	cmd := exec.Command(name, args...)
+	if len(stdin) > 0 {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return string(out), err
+	}
+	return "", nil
+}
@@ -2,6 +2,7 @@ package udisks
 
 import (
 	"fmt"
+	"log"
 	"strings"
 
 	"github.com/godbus/dbus"
@@ -31,3 +32,40 @@ func getPropertyStringArray(conn *dbus.Conn, path dbus.ObjectPath, propertyName
 	}
 	return nil, fmt.Errorf("invalid property type")
 }
+
+// getDrive Returns the properties of the drive a block device
+// is on, nil if it isn't on one.
+func (s *udisksProvider) getDrive(dBusObject map[string]map[string]dbus.Variant) map[string]dbus.Variant {
+	block, ok := dBusObject["org.freedesktop.UDisks2.Block"]
+	if !ok {
+		return nil
+	}
+	drivePath, ok := block["Drive"].Value().(dbus.ObjectPath)
+	if !ok || drivePath == "/" {
+		return nil
+	}
+	var result map[string]dbus.Variant
+	drive := s.conn.Object("org.freedesktop.UDisks2", drivePath)
+	err := drive.Call("org.freedesktop.DBus.Properties.GetAll", 0, "org.freedesktop.UDisks2.Drive").Store(&result)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	return result
+}
+
+func (s *udisksProvider) managedObjects() (map[dbus.ObjectPath]map[string]map[string]dbus.Variant, error) {
+	var result map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+	udisks := s.conn.Object("org.freedesktop.UDisks2", "/org/freedesktop/UDisks2")
+	err := udisks.Call("org.freedesktop.DBus.ObjectManager.GetManagedObjects", 0).Store(&result)
+	return result, err
+}
+
+// getBackingDevice Returns the encrypted device that an unlocked
+// (cleartext) device belongs to, or "" for other devices.
+func getBackingDevice(block map[string]dbus.Variant) dbus.ObjectPath {
+	if backing, ok := block["CryptoBackingDevice"].Value().(dbus.ObjectPath); ok && backing != "/" {
+		return backing
+	}
+	return ""
+}
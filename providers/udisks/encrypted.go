@@ -0,0 +1,195 @@
+package udisks
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/godbus/dbus"
+
+	"github.com/pauldotknopf/automounter/providers"
+)
+
+var (
+	// ErrLocked Returned when mounting encrypted media, the
+	// media that appears after unlocking it is mounted instead.
+	ErrLocked = errors.New("the media is encrypted, unlock it first")
+)
+
+// How long udisks gets to probe the filesystem of unlocked media.
+const unlockTimeout = time.Second * 5
+
+// How long media we unlocked can go unmounted before it is locked again.
+const unlockedTimeout = time.Minute
+
+const unlockInterval = time.Millisecond * 250
+
+// Provider .
+type Provider interface {
+	providers.MediaProvider
+	// Unlock Unlocks encrypted media with a passphrase or the contents
+	// of a keyfile, and returns the media of the filesystem on it.
+	// It is locked again when that media is unmounted, when mounting
+	// it fails, or when it isn't mounted within a minute.
+	Unlock(id string, passphrase string, keyfile []byte) (providers.Media, error)
+}
+
+func (s *udisksProvider) Unlock(id string, passphrase string, keyfile []byte) (providers.Media, error) {
+	if len(passphrase) == 0 && len(keyfile) == 0 {
+		return nil, fmt.Errorf("a passphrase or a keyfile is required")
+	}
+
+	s.mutex.Lock()
+	media := s.getObject(dbus.ObjectPath(id))
+	if media == nil {
+		s.mutex.Unlock()
+		return nil, providers.ErrIDNotFound
+	}
+	if !media.isEncrypted() {
+		s.mutex.Unlock()
+		return nil, fmt.Errorf("the media isn't encrypted")
+	}
+	if len(media.cleartext) > 0 {
+		cleartext := s.getObject(media.cleartext)
+		s.mutex.Unlock()
+		if cleartext == nil {
+			return nil, fmt.Errorf("the media is already unlocked, but the unlocked media is missing")
+		}
+		return cleartext, nil
+	}
+	s.mutex.Unlock()
+
+	// Unlocking adds the cleartext device, which deviceAdded needs
+	// the mutex for, so we can't hold it while waiting for udisks.
+	options := make(map[string]dbus.Variant)
+	if len(keyfile) > 0 {
+		options["keyfile_contents"] = dbus.MakeVariant(keyfile)
+	}
+	obj := s.conn.Object("org.freedesktop.UDisks2", media.path)
+	var cleartextPath dbus.ObjectPath
+	err := obj.Call("org.freedesktop.UDisks2.Encrypted.Unlock", 0, passphrase, options).Store(&cleartextPath)
+	if err != nil {
+		return nil, err
+	}
+
+	cleartext, err := s.waitForCleartext(cleartextPath)
+	if err != nil {
+		s.lock(media.path)
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	if timer, ok := s.unlocked[media.path]; ok {
+		timer.Stop()
+	}
+	s.unlocked[media.path] = time.AfterFunc(unlockedTimeout, func() {
+		s.lockIfUnused(cleartextPath)
+	})
+	s.mutex.Unlock()
+
+	return cleartext, nil
+}
+
+// waitForCleartext Waits for udisks to find the filesystem on unlocked
+// media, which happens after Unlock returns, and adds the media for it.
+func (s *udisksProvider) waitForCleartext(path dbus.ObjectPath) (providers.Media, error) {
+	deadline := time.Now().Add(unlockTimeout)
+	for {
+		objects, err := s.managedObjects()
+		if err != nil {
+			return nil, err
+		}
+		if object, ok := objects[path]; ok {
+			if _, ok := object["org.freedesktop.UDisks2.Filesystem"]; ok {
+				err = s.deviceAdded(path, object)
+				if err != nil {
+					return nil, err
+				}
+				s.mutex.Lock()
+				media := s.getObject(path)
+				s.mutex.Unlock()
+				if media == nil {
+					return nil, fmt.Errorf("the unlocked media isn't supported")
+				}
+				return media, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("no filesystem was found on the unlocked media")
+		}
+		time.Sleep(unlockInterval)
+	}
+}
+
+// lock Locks encrypted media, removing its cleartext device.
+func (s *udisksProvider) lock(path dbus.ObjectPath) error {
+	obj := s.conn.Object("org.freedesktop.UDisks2", path)
+	err := obj.Call("org.freedesktop.UDisks2.Encrypted.Lock", 0, map[string]dbus.Variant{}).Store()
+	if err != nil {
+		if dbusError, ok := err.(dbus.Error); ok {
+			if dbusError.Name == "org.freedesktop.UDisks2.Error.NotUnlocked" {
+				return nil
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// lockIfUnused Locks the encrypted media behind the given unlocked
+// media, if we unlocked it and the unlocked media isn't mounted.
+func (s *udisksProvider) lockIfUnused(path dbus.ObjectPath) {
+	s.mutex.Lock()
+	media := s.getObject(path)
+	if media == nil || len(media.parent) == 0 {
+		s.mutex.Unlock()
+		return
+	}
+	if _, ok := s.unlocked[media.parent]; !ok {
+		s.mutex.Unlock()
+		return
+	}
+	mountPoints, err := getPropertyStringArray(s.conn, media.path, "org.freedesktop.UDisks2.Filesystem.MountPoints")
+	if err != nil || len(mountPoints) > 0 {
+		// In use, it is locked once it is unmounted.
+		s.mutex.Unlock()
+		return
+	}
+	parent := s.forgetUnlocked(media.parent)
+	s.mutex.Unlock()
+
+	// Locking removes the unlocked media, which
+	// deviceRemoved needs the mutex for.
+	err = s.lock(parent)
+	if err != nil {
+		log.Printf("couldn't lock %s: %v", parent, err)
+	}
+}
+
+// forgetUnlocked Returns the encrypted media if we unlocked it, and
+// stops tracking it, "" otherwise. The mutex must be held.
+func (s *udisksProvider) forgetUnlocked(path dbus.ObjectPath) dbus.ObjectPath {
+	timer, ok := s.unlocked[path]
+	if !ok {
+		return ""
+	}
+	timer.Stop()
+	delete(s.unlocked, path)
+	return path
+}
+
+// setCleartext Records the cleartext device of encrypted media,
+// "" when it was locked. The mutex must be held.
+func (s *udisksProvider) setCleartext(path dbus.ObjectPath, cleartext dbus.ObjectPath) {
+	for mediaIndex, media := range s.media {
+		if media.path == path {
+			// Replaced rather than changed, someone
+			// may be reading the old one.
+			updated := *media
+			updated.cleartext = cleartext
+			s.media[mediaIndex] = &updated
+			return
+		}
+	}
+}
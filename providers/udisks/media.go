@@ -9,6 +9,26 @@ import (
 type udisksMedia struct {
 	path   dbus.ObjectPath
 	object map[string]map[string]dbus.Variant
+	// The properties of the drive it is on, if any
+	drive map[string]dbus.Variant
+	// For unlocked media, the encrypted media it belongs to.
+	parent dbus.ObjectPath
+	// For encrypted media, the unlocked media while it is unlocked.
+	cleartext dbus.ObjectPath
+}
+
+func (s *udisksMedia) fsType() string {
+	if block, ok := s.object["org.freedesktop.UDisks2.Block"]; ok {
+		if fsType, ok := block["IdType"].Value().(string); ok {
+			return fsType
+		}
+	}
+	return ""
+}
+
+func (s *udisksMedia) isEncrypted() bool {
+	_, ok := s.object["org.freedesktop.UDisks2.Encrypted"]
+	return ok
 }
 
 func (s *udisksMedia) ID() string {
@@ -45,6 +65,24 @@ func (s *udisksMedia) Properties() map[string]string {
 		result["fsVersion"] = block["IdVersion"].Value().(string)
 		result["size"] = strconv.FormatUint(block["Size"].Value().(uint64), 10)
 		result["uuid"] = block["IdUUID"].Value().(string)
+		result["label"] = block["IdLabel"].Value().(string)
+	}
+
+	for key, property := range map[string]string{"vendor": "Vendor", "model": "Model", "serial": "Serial"} {
+		if value, ok := s.drive[property].Value().(string); ok && len(value) > 0 {
+			result[key] = value
+		}
+	}
+
+	if s.isEncrypted() {
+		result["encrypted"] = "true"
+		result["locked"] = strconv.FormatBool(len(s.cleartext) == 0)
+		if len(s.cleartext) > 0 {
+			result["unlockedId"] = string(s.cleartext)
+		}
+	}
+	if len(s.parent) > 0 {
+		result["encryptedId"] = string(s.parent)
 	}
 
 	return result
@@ -3,7 +3,9 @@ package udisks
 type udisksMountSession struct {
 	media     *udisksMedia
 	mountPath string
-	provider  *udisksProvider
+	// nil if the media was already mounted by someone else
+	options  []string
+	provider *udisksProvider
 }
 
 func (s *udisksMountSession) Release() error {
@@ -13,3 +15,7 @@ func (s *udisksMountSession) Release() error {
 func (s *udisksMountSession) Location() string {
 	return s.mountPath
 }
+
+func (s *udisksMountSession) MountOptions() []string {
+	return s.options
+}
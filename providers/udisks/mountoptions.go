@@ -0,0 +1,60 @@
+package udisks
+
+import (
+	"fmt"
+	"strings"
+)
+
+// validateMountOptions Makes sure the options can be passed to udisks.
+// Whether they are allowed is up to udisks, it refuses the ones
+// that aren't in its defaults or /etc/udisks2/mount_options.conf.
+func validateMountOptions(options []string) error {
+	for _, option := range options {
+		if len(option) == 0 || strings.ContainsAny(option, ", \t\n") {
+			return fmt.Errorf("invalid mount option %q", option)
+		}
+	}
+	return nil
+}
+
+// mergeMountOptions Combines the lists of options, later
+// options replace earlier ones that set the same thing.
+func mergeMountOptions(lists ...[]string) []string {
+	result := make([]string, 0)
+	for _, list := range lists {
+		for _, option := range list {
+			key := mountOptionKey(option)
+			replaced := false
+			for index, existing := range result {
+				if mountOptionKey(existing) == key {
+					result[index] = option
+					replaced = true
+					break
+				}
+			}
+			if !replaced {
+				result = append(result, option)
+			}
+		}
+	}
+	return result
+}
+
+// mountOptionKey Returns what the option sets, so that
+// "ro" replaces "rw" and "uid=1000" replaces "uid=0".
+func mountOptionKey(option string) string {
+	if index := strings.Index(option, "="); index >= 0 {
+		return option[:index]
+	}
+	switch option {
+	case "ro", "rw":
+		return "rw"
+	case "exec", "noexec":
+		return "exec"
+	case "atime", "noatime", "relatime", "strictatime":
+		return "atime"
+	case "datacow", "nodatacow", "datasum", "nodatasum", "autodefrag", "noautodefrag", "discard", "nodiscard", "compression", "nocompression":
+		return strings.TrimPrefix(option, "no")
+	}
+	return option
+}
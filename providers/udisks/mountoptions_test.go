@@ -0,0 +1,53 @@
+package udisks
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeMountOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		lists    [][]string
+		expected []string
+	}{
+		{"nothing", nil, []string{}},
+		{"appended", [][]string{{"nosuid"}, {"utf8"}, {"noexec"}}, []string{"nosuid", "utf8", "noexec"}},
+		{"ro replaces rw", [][]string{{"rw", "nosuid"}, nil, {"ro"}}, []string{"ro", "nosuid"}},
+		{"values replaced", [][]string{{"uid=0", "gid=0"}, {"uid=1000"}}, []string{"uid=1000", "gid=0"}},
+		{"exec replaces noexec", [][]string{{"noexec"}, {"exec"}}, []string{"exec"}},
+		{"atime", [][]string{{"relatime"}, {"noatime"}}, []string{"noatime"}},
+		{"btrfs negations", [][]string{{"datacow", "discard"}, {"nodiscard"}}, []string{"datacow", "nodiscard"}},
+		{"duplicates", [][]string{{"sync"}, {"sync"}}, []string{"sync"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := mergeMountOptions(test.lists...)
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestValidateMountOptions(t *testing.T) {
+	tests := []struct {
+		options []string
+		valid   bool
+	}{
+		{nil, true},
+		{[]string{"ro", "uid=1000", "iocharset=utf8"}, true},
+		{[]string{""}, false},
+		{[]string{"ro,exec"}, false},
+		{[]string{"uid= 0"}, false},
+		{[]string{"noexec\n"}, false},
+	}
+
+	for _, test := range tests {
+		err := validateMountOptions(test.options)
+		if (err == nil) != test.valid {
+			t.Errorf("validateMountOptions(%q) = %v, expected valid %v", test.options, err, test.valid)
+		}
+	}
+}
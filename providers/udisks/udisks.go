@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/olebedev/emitter"
 
@@ -13,15 +15,41 @@ import (
 )
 
 type udisksProvider struct {
-	conn  *dbus.Conn
-	mutex sync.Mutex
-	media []*udisksMedia
-	Emit  *emitter.Emitter
+	conn    *dbus.Conn
+	options ProviderOptions
+	mutex   sync.Mutex
+	media   []*udisksMedia
+	// The encrypted media we unlocked, and so may lock again.
+	// Media someone else unlocked is left alone.
+	unlocked map[dbus.ObjectPath]*time.Timer
+	Emit     *emitter.Emitter
+}
+
+// ProviderOptions Options for the udisks provider
+type ProviderOptions struct {
+	// Used for every mount, before the options of the lease
+	MountOptions []string
+	// Used for the filesystems of the given type ("vfat"),
+	// after the ones above.
+	FSMountOptions map[string][]string
 }
 
 // Create a udisks block device media provider
-func Create() (providers.MediaProvider, error) {
+func Create(options ProviderOptions) (Provider, error) {
+	err := validateMountOptions(options.MountOptions)
+	if err != nil {
+		return nil, err
+	}
+	for _, fsOptions := range options.FSMountOptions {
+		err = validateMountOptions(fsOptions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	p := &udisksProvider{}
+	p.options = options
+	p.unlocked = make(map[dbus.ObjectPath]*time.Timer)
 
 	conn, err := dbus.SystemBus()
 	if err != nil {
@@ -56,10 +84,16 @@ func (s *udisksProvider) Start(ctx context.Context) error {
 		return err
 	}
 
-	for path := range result {
-		err := s.deviceAdded(path, result[path])
-		if err != nil {
-			log.Println(err)
+	// Unlocked media is added after the encrypted media it belongs to.
+	for _, cleartext := range []bool{false, true} {
+		for path := range result {
+			if block, ok := result[path]["org.freedesktop.UDisks2.Block"]; ok && (len(getBackingDevice(block)) > 0) != cleartext {
+				continue
+			}
+			err := s.deviceAdded(path, result[path])
+			if err != nil {
+				log.Println(err)
+			}
 		}
 	}
 
@@ -125,15 +159,44 @@ func (s *udisksProvider) GetMediaByID(id string) providers.Media {
 }
 
 func (s *udisksProvider) Mount(id string) (providers.MountSession, error) {
+	return s.MountWithOptions(id, nil)
+}
+
+func (s *udisksProvider) MountWithOptions(id string, options []string) (providers.MountSession, error) {
+	session, err := s.mount(id, options)
+	if err != nil {
+		// Don't leave media we unlocked for it lying around.
+		s.lockIfUnused(dbus.ObjectPath(id))
+	}
+	return session, err
+}
+
+func (s *udisksProvider) mount(id string, options []string) (providers.MountSession, error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
 	for _, media := range s.media {
 		if media.ID() == id {
+			if media.isEncrypted() {
+				if len(media.cleartext) > 0 {
+					return nil, fmt.Errorf("the media is unlocked, mount %s instead", media.cleartext)
+				}
+				return nil, ErrLocked
+			}
+			fsType := media.fsType()
+			err := validateMountOptions(options)
+			if err != nil {
+				return nil, err
+			}
+			effective := mergeMountOptions(s.options.MountOptions, s.options.FSMountOptions[fsType], options)
+
 			obj := s.conn.Object("org.freedesktop.UDisks2", media.path)
-			var params map[string]dbus.Variant
+			params := make(map[string]dbus.Variant)
+			if len(effective) > 0 {
+				params["options"] = dbus.MakeVariant(strings.Join(effective, ","))
+			}
 			var location string
-			err := obj.Call("org.freedesktop.UDisks2.Filesystem.Mount", 0, params).Store(&location)
+			err = obj.Call("org.freedesktop.UDisks2.Filesystem.Mount", 0, params).Store(&location)
 			if err != nil {
 				if dbusError, ok := err.(dbus.Error); ok {
 					if dbusError.Name == "org.freedesktop.UDisks2.Error.AlreadyMounted" {
@@ -144,6 +207,9 @@ func (s *udisksProvider) Mount(id string) (providers.MountSession, error) {
 						if len(v) == 0 {
 							return nil, fmt.Errorf("mount indicated it was already mounted, but couldn't find the mount")
 						}
+						if len(options) > 0 {
+							return nil, fmt.Errorf("the media is already mounted at %s, it can't be mounted with other options", v[0])
+						}
 
 						s.Emit.Emit("mediaMounted", media.ID())
 
@@ -153,6 +219,11 @@ func (s *udisksProvider) Mount(id string) (providers.MountSession, error) {
 						session.provider = s
 						return session, nil
 					}
+					if dbusError.Name == "org.freedesktop.UDisks2.Error.OptionNotPermitted" {
+						// Options other than the defaults have to be
+						// allowed in /etc/udisks2/mount_options.conf.
+						return nil, fmt.Errorf("udisks doesn't allow the mount options %s for %s filesystems: %v", strings.Join(effective, ","), fsType, err)
+					}
 				}
 				return nil, err
 			}
@@ -162,6 +233,7 @@ func (s *udisksProvider) Mount(id string) (providers.MountSession, error) {
 			session := &udisksMountSession{}
 			session.media = media
 			session.mountPath = location
+			session.options = effective
 			session.provider = s
 			return session, nil
 		}
@@ -171,6 +243,20 @@ func (s *udisksProvider) Mount(id string) (providers.MountSession, error) {
 }
 
 func (s *udisksProvider) Unmount(id string) error {
+	parent, err := s.unmount(id)
+	if err != nil {
+		return err
+	}
+	if len(parent) > 0 {
+		// Nobody is using the unlocked media anymore. Locking removes
+		// it, which deviceRemoved needs the mutex for.
+		return s.lock(parent)
+	}
+	return nil
+}
+
+// unmount Returns the encrypted media to lock, if we unlocked the media.
+func (s *udisksProvider) unmount(id string) (dbus.ObjectPath, error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
@@ -192,17 +278,43 @@ func (s *udisksProvider) Unmount(id string) error {
 				if dbusError, ok := err.(dbus.Error); ok {
 					if dbusError.Name == "org.freedesktop.UDisks2.Error.NotMounted" {
 						wasUnmounted = true
-						return nil
+						return s.forgetUnlocked(media.parent), nil
 					}
 				}
-				return err
+				return "", err
 			}
 			wasUnmounted = true
-			return nil
+			return s.forgetUnlocked(media.parent), nil
 		}
 	}
 
-	return providers.ErrIDNotFound
+	return "", providers.ErrIDNotFound
+}
+
+func (s *udisksProvider) RestoreMount(id string, location string) (providers.MountSession, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, media := range s.media {
+		if media.ID() == id {
+			mountPoints, err := getPropertyStringArray(s.conn, media.path, "org.freedesktop.UDisks2.Filesystem.MountPoints")
+			if err != nil {
+				return nil, err
+			}
+			for _, mountPoint := range mountPoints {
+				if mountPoint == location {
+					session := &udisksMountSession{}
+					session.media = media
+					session.mountPath = location
+					session.provider = s
+					return session, nil
+				}
+			}
+			return nil, fmt.Errorf("media is no longer mounted at %s", location)
+		}
+	}
+
+	return nil, providers.ErrIDNotFound
 }
 
 func (s *udisksProvider) MediaAddded() (<-chan providers.Media, func()) {
@@ -254,10 +366,30 @@ func (s *udisksProvider) MediaUnmounted() (<-chan string, func()) {
 }
 
 func (s *udisksProvider) deviceAdded(path dbus.ObjectPath, dBusObject map[string]map[string]dbus.Variant) error {
+	// Looked up before locking, it is a call over dbus.
+	drive := s.getDrive(dBusObject)
+
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	if _, ok := dBusObject["org.freedesktop.UDisks2.Filesystem"]; ok {
+	_, isFilesystem := dBusObject["org.freedesktop.UDisks2.Filesystem"]
+	_, isEncrypted := dBusObject["org.freedesktop.UDisks2.Encrypted"]
+
+	if block, ok := dBusObject["org.freedesktop.UDisks2.Block"]; ok && isFilesystem {
+		// Unlocked media is added regardless of the hints,
+		// as long as we have the encrypted media.
+		if backing := getBackingDevice(block); len(backing) > 0 {
+			if parent := s.getObject(backing); parent != nil && !s.hasObject(path) {
+				m := &udisksMedia{path: path, object: dBusObject, drive: parent.drive, parent: backing}
+				s.media = append(s.media, m)
+				s.setCleartext(backing, path)
+				s.Emit.Emit("mediaAdded", m)
+			}
+			return nil
+		}
+	}
+
+	if isFilesystem || isEncrypted {
 		if block, ok := dBusObject["org.freedesktop.UDisks2.Block"]; ok {
 			if hintIgnore, ok := block["HintIgnore"]; ok {
 				if hintIgnore.Value() == true {
@@ -266,11 +398,15 @@ func (s *udisksProvider) deviceAdded(path dbus.ObjectPath, dBusObject map[string
 			} else {
 				return nil
 			}
+			// Loop devices belong to the image provider.
+			if device, ok := block["Device"].Value().([]byte); ok && strings.HasPrefix(string(device), "/dev/loop") {
+				return nil
+			}
 			if hintIgnore, ok := block["HintAuto"]; ok {
 				if hintIgnore.Value() == true {
 					// Add this device
 					if !s.hasObject(path) {
-						m := &udisksMedia{path, dBusObject}
+						m := &udisksMedia{path: path, object: dBusObject, drive: drive}
 						s.media = append(s.media, m)
 						s.Emit.Emit("mediaAdded", m)
 					}
@@ -290,6 +426,10 @@ func (s *udisksProvider) deviceRemoved(path dbus.ObjectPath) error {
 	for mediaIndex, media := range s.media {
 		if media.path == path {
 			s.media = append(s.media[:mediaIndex], s.media[mediaIndex+1:]...)
+			if len(media.parent) > 0 {
+				s.setCleartext(media.parent, "")
+				s.forgetUnlocked(media.parent)
+			}
 			s.Emit.Emit("mediaUnmounted", string(path))
 			s.Emit.Emit("mediaRemoved", string(path))
 			return nil
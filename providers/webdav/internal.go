@@ -0,0 +1,152 @@
+package webdav
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pauldotknopf/automounter/helpers"
+	"github.com/sirupsen/logrus"
+)
+
+func (s *webdavProvider) buildMedia(options Options) *webdavMedia {
+	media := &webdavMedia{}
+	media.id = fmt.Sprintf("webdav-%s", options.Hash)
+	media.options = options
+	return media
+}
+
+// stateDirFor The state directory is named after the mount path, so
+// that it can be found again for mounts restored after a restart.
+func (s *webdavProvider) stateDirFor(mountPath string) string {
+	return filepath.Join(s.options.StateDir, filepath.Base(mountPath))
+}
+
+func (s *webdavMount) unmount() error {
+	output, err := run("umount", s.options.UnmountArgs(s.mountPath)...)
+	if err != nil {
+		logrus.Errorf("couldn't unmount webdav directory %s: %+v: %s", s.mountPath, err, output)
+		return fmt.Errorf("couldn't unmount webdav directory")
+	}
+
+	err = os.RemoveAll(s.mountPath)
+	if err != nil {
+		logrus.Warnf("couldn't remove mount path %s after unmounting: %+v", s.mountPath, err)
+	}
+
+	err = os.RemoveAll(s.stateDir)
+	if err != nil {
+		logrus.Warnf("couldn't remove state directory %s after unmounting: %+v", s.stateDir, err)
+	}
+
+	return nil
+}
+
+func (s *webdavProvider) mount(media *webdavMedia) (*webdavMount, error) {
+	mount := &webdavMount{}
+	mount.id = media.ID()
+	mountPath, err := helpers.GetTmpMountPath()
+	if err != nil {
+		return nil, err
+	}
+	mount.mountPath = mountPath
+	mount.stateDir = s.stateDirFor(mountPath)
+	mount.options = media.options
+	mount.provider = s
+
+	output, err := s.runMount(media.options, mountPath, mount.stateDir)
+	if err != nil {
+		// We couldn't mount the collection.
+		os.RemoveAll(mountPath)
+		os.RemoveAll(mount.stateDir)
+		logrus.Warningf("couldn't mount webdav collection %s: %s: %+v", media.DisplayName(), output, err)
+		output = extractErrorsFromMountOutput(output)
+		if len(output) == 0 {
+			return nil, fmt.Errorf("could not mount")
+		}
+		return nil, fmt.Errorf("%s", output)
+	}
+
+	return mount, nil
+}
+
+// runMount Writes the davfs2 configuration of the mount to the state
+// directory, which only root can read, and mounts the collection.
+func (s *webdavProvider) runMount(options Options, mountPath string, stateDir string) (string, error) {
+	err := os.MkdirAll(stateDir, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	var config bytes.Buffer
+	// Never prompt for credentials or certificates.
+	config.WriteString("ask_auth 0\n")
+	if options.Mount.UseLocks {
+		config.WriteString("use_locks 1\n")
+	} else {
+		config.WriteString("use_locks 0\n")
+	}
+
+	secretsPath := filepath.Join(stateDir, "secrets")
+	config.WriteString(fmt.Sprintf("secrets %s\n", secretsPath))
+	var secrets bytes.Buffer
+	if len(options.Username) > 0 {
+		secrets.WriteString(fmt.Sprintf("%s %s %s\n", quote(options.URL), quote(options.Username), quote(options.Password)))
+	}
+	err = ioutil.WriteFile(secretsPath, secrets.Bytes(), 0600)
+	if err != nil {
+		return "", err
+	}
+
+	// These require davfs2 1.6 or newer.
+	if len(options.CACertificate) > 0 {
+		caPath := filepath.Join(stateDir, "ca.pem")
+		err = ioutil.WriteFile(caPath, []byte(strings.TrimSpace(options.CACertificate)+"\n"), 0600)
+		if err != nil {
+			return "", err
+		}
+		config.WriteString(fmt.Sprintf("trust_ca_cert %s\n", caPath))
+	}
+	if len(options.ServerCertificate) > 0 {
+		serverPath := filepath.Join(stateDir, "server.pem")
+		err = ioutil.WriteFile(serverPath, []byte(strings.TrimSpace(options.ServerCertificate)+"\n"), 0600)
+		if err != nil {
+			return "", err
+		}
+		config.WriteString(fmt.Sprintf("trust_server_cert %s\n", serverPath))
+	}
+
+	configPath := filepath.Join(stateDir, "davfs2.conf")
+	err = ioutil.WriteFile(configPath, config.Bytes(), 0600)
+	if err != nil {
+		return "", err
+	}
+
+	return run("mount", options.MountArgs(mountPath, configPath)...)
+}
+
+// quote Quotes a field of the davfs2 secrets file.
+func quote(value string) string {
+	value = strings.Replace(value, "\\", "\\\\", -1)
+	value = strings.Replace(value, "\"", "\\\"", -1)
+	return fmt.Sprintf("\"%s\"", value)
+}
+
+// "/sbin/mount.davfs: Mounting failed.\n401 Unauthorized"
+func extractErrorsFromMountOutput(output string) string {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasSuffix(line, "Mounting failed.") {
+			continue
+		}
+		if index := strings.Index(line, "mount.davfs: "); index >= 0 {
+			line = line[index+len("mount.davfs: "):]
+		}
+		lines = append(lines, strings.TrimSuffix(line, "."))
+	}
+	return strings.Join(lines, ", ")
+}
@@ -0,0 +1,23 @@
+package webdav
+
+import "testing"
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"", `""`},
+		{"paul", `"paul"`},
+		{"p@ss word", `"p@ss word"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`back\slash`, `"back\\slash"`},
+		{`\"`, `"\\\""`},
+	}
+
+	for _, test := range tests {
+		if actual := quote(test.value); actual != test.expected {
+			t.Fatalf("expected %s to be quoted as %s, got %s", test.value, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package webdav
+
+type webdavMedia struct {
+	id      string
+	options Options
+	// Whether the collection is remembered across restarts
+	persisted bool
+}
+
+func (s *webdavMedia) ID() string {
+	return s.id
+}
+
+func (s *webdavMedia) DisplayName() string {
+	return s.options.FriendlyName()
+}
+
+func (s *webdavMedia) Provider() string {
+	return "webdav"
+}
+
+func (s *webdavMedia) Properties() map[string]string {
+	result := make(map[string]string, 0)
+
+	result["url"] = s.options.URL
+	result["username"] = s.options.Username
+	result["password"] = s.options.Password
+	result["caCertificate"] = s.options.CACertificate
+	result["serverCertificate"] = s.options.ServerCertificate
+
+	for key, value := range s.options.Mount.properties() {
+		result[key] = value
+	}
+
+	return result
+}
+
+func (s *webdavMedia) SecretProperties() []string {
+	return []string{"password"}
+}
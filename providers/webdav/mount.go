@@ -0,0 +1,23 @@
+package webdav
+
+type webdavMount struct {
+	id        string
+	mountPath string
+	// Holds the davfs2 configuration, credentials and
+	// certificates of the mount.
+	stateDir  string
+	options   Options
+	provider  *webdavProvider
+	isDynamic bool
+}
+
+func (s *webdavMount) Release() error {
+	if s.isDynamic {
+		return s.provider.releaseDynamic(s)
+	}
+	return s.provider.Unmount(s.id)
+}
+
+func (s *webdavMount) Location() string {
+	return s.mountPath
+}
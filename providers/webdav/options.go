@@ -0,0 +1,192 @@
+package webdav
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pauldotknopf/automounter/helpers"
+)
+
+// A numeric id, or a user/group name.
+var validOwner = regexp.MustCompile(`^([0-9]+|[a-z_][a-z0-9_\-]*\$?)$`)
+
+var validMode = regexp.MustCompile(`^0?[0-7]{3,4}$`)
+
+// Options .
+type Options struct {
+	// The collection to mount, "https://server/remote.php/dav/files/user"
+	URL string
+	// Both are empty for servers that don't need a login. davfs2
+	// uses basic or digest authentication, whatever the server asks for.
+	Username string
+	Password string
+	// PEM certificates to trust, in addition to the system CAs. The CA
+	// that signed the certificate of the server, or the (self signed)
+	// certificate of the server itself.
+	CACertificate     string
+	ServerCertificate string
+	Mount             MountOptions
+	Hash              string
+}
+
+// MountOptions Optional settings for how a collection is mounted.
+type MountOptions struct {
+	ReadOnly bool `json:"readOnly"`
+	// The owner of the files, "uid=" and "gid=".
+	UID string `json:"uid"`
+	GID string `json:"gid"`
+	// Octal permissions, "file_mode=" and "dir_mode=".
+	FileMode string `json:"fileMode"`
+	DirMode  string `json:"dirMode"`
+	// Lock files on the server while they are open.
+	UseLocks bool `json:"useLocks"`
+}
+
+// CreateOptions .
+func CreateOptions(rawURL string, username string, password string, caCertificate string, serverCertificate string, mount MountOptions) (Options, error) {
+	var result Options
+	result.URL = rawURL
+	result.Username = username
+	result.Password = password
+	result.CACertificate = caCertificate
+	result.ServerCertificate = serverCertificate
+	result.Mount = mount
+
+	if len(result.URL) == 0 {
+		return result, fmt.Errorf("url is required")
+	}
+
+	// The url is written to the secrets file of davfs2,
+	// where whitespace separates the fields.
+	u, err := url.Parse(result.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 || u.User != nil || strings.ContainsAny(result.URL, " \\\"") || helpers.HasControlCharacters(result.URL) {
+		return result, fmt.Errorf("invalid url, it must be an http or https url")
+	}
+
+	if strings.ContainsAny(result.Username, " \\\"") || helpers.HasControlCharacters(result.Username) {
+		return result, fmt.Errorf("invalid username")
+	}
+
+	if helpers.HasControlCharacters(result.Password) {
+		return result, fmt.Errorf("invalid password")
+	}
+
+	if len(result.Password) > 0 && len(result.Username) == 0 {
+		return result, fmt.Errorf("a password requires a username")
+	}
+
+	for _, certificate := range []string{result.CACertificate, result.ServerCertificate} {
+		if len(certificate) > 0 && !strings.HasPrefix(strings.TrimSpace(certificate), "-----BEGIN CERTIFICATE-----") {
+			return result, fmt.Errorf("invalid certificate, it must be in PEM format")
+		}
+	}
+
+	if u.Scheme == "http" && (len(result.CACertificate) > 0 || len(result.ServerCertificate) > 0) {
+		return result, fmt.Errorf("certificates can only be used with https")
+	}
+
+	err = result.Mount.validate()
+	if err != nil {
+		return result, err
+	}
+
+	// Build a hash of all the parameters
+	var hashBytes bytes.Buffer
+	hashBytes.Write([]byte(result.URL))
+	hashBytes.Write([]byte(result.Username))
+	hashBytes.Write([]byte(result.Password))
+	hashBytes.Write([]byte(result.CACertificate))
+	hashBytes.Write([]byte(result.ServerCertificate))
+	hashBytes.Write([]byte(fmt.Sprintf("%+v", result.Mount)))
+
+	result.Hash = fmt.Sprintf("%x", md5.Sum(hashBytes.Bytes()))
+
+	return result, nil
+}
+
+// FriendlyName .
+func (s Options) FriendlyName() string {
+	return s.URL
+}
+
+// MountArgs The arguments to run "mount" with to mount these options.
+// The davfs2 configuration is read from configPath, see writeConfig.
+func (s Options) MountArgs(mountPoint string, configPath string) []string {
+	opts := make([]string, 0)
+	opts = append(opts, fmt.Sprintf("conf=%s", configPath))
+	opts = append(opts, s.Mount.args()...)
+	return []string{"-t", "davfs", "-o", strings.Join(opts, ","), s.URL, mountPoint}
+}
+
+// UnmountArgs The arguments to run "umount" with. This isn't a lazy
+// unmount, davfs2 uploads the changed files while unmounting.
+func (s Options) UnmountArgs(mountPoint string) []string {
+	return []string{mountPoint}
+}
+
+func (s MountOptions) validate() error {
+	if len(s.UID) > 0 && !validOwner.MatchString(s.UID) {
+		return fmt.Errorf("invalid uid")
+	}
+
+	if len(s.GID) > 0 && !validOwner.MatchString(s.GID) {
+		return fmt.Errorf("invalid gid")
+	}
+
+	if len(s.FileMode) > 0 && !validMode.MatchString(s.FileMode) {
+		return fmt.Errorf("invalid file mode, it must be octal")
+	}
+
+	if len(s.DirMode) > 0 && !validMode.MatchString(s.DirMode) {
+		return fmt.Errorf("invalid dir mode, it must be octal")
+	}
+
+	return nil
+}
+
+func (s MountOptions) args() []string {
+	result := make([]string, 0)
+	if len(s.UID) > 0 {
+		result = append(result, fmt.Sprintf("uid=%s", s.UID))
+	}
+	if len(s.GID) > 0 {
+		result = append(result, fmt.Sprintf("gid=%s", s.GID))
+	}
+	if len(s.FileMode) > 0 {
+		result = append(result, fmt.Sprintf("file_mode=%s", s.FileMode))
+	}
+	if len(s.DirMode) > 0 {
+		result = append(result, fmt.Sprintf("dir_mode=%s", s.DirMode))
+	}
+	if s.ReadOnly {
+		result = append(result, "ro")
+	} else {
+		result = append(result, "rw")
+	}
+	return result
+}
+
+// properties The options that were set, for displaying with the media.
+func (s MountOptions) properties() map[string]string {
+	result := make(map[string]string)
+	if len(s.UID) > 0 {
+		result["uid"] = s.UID
+	}
+	if len(s.GID) > 0 {
+		result["gid"] = s.GID
+	}
+	if len(s.FileMode) > 0 {
+		result["fileMode"] = s.FileMode
+	}
+	if len(s.DirMode) > 0 {
+		result["dirMode"] = s.DirMode
+	}
+	result["readOnly"] = strconv.FormatBool(s.ReadOnly)
+	result["useLocks"] = strconv.FormatBool(s.UseLocks)
+	return result
+}
@@ -0,0 +1,86 @@
+package webdav
+
+import "github.com/pauldotknopf/automounter/helpers"
+
+// The collections are stored without their passwords, which are
+// kept in a separate file that only root can read.
+type registryCollection struct {
+	URL               string       `json:"url"`
+	Username          string       `json:"username"`
+	CACertificate     string       `json:"caCertificate"`
+	ServerCertificate string       `json:"serverCertificate"`
+	Mount             MountOptions `json:"mount"`
+	// Used to find the password in the secrets file.
+	ID string `json:"id"`
+}
+
+type registryFile struct {
+	Collections []registryCollection `json:"collections"`
+}
+
+type secretsFile struct {
+	Passwords map[string]string `json:"passwords"`
+}
+
+type registry struct {
+	path        string
+	secretsPath string
+}
+
+func (s *registry) load() ([]Options, error) {
+	result := make([]Options, 0)
+
+	var collections registryFile
+	found, err := helpers.ReadJSONFile(s.path, &collections)
+	if err != nil || !found {
+		return result, err
+	}
+
+	var secrets secretsFile
+	_, err = helpers.ReadJSONFile(s.secretsPath, &secrets)
+	if err != nil {
+		return result, err
+	}
+
+	for _, c := range collections.Collections {
+		options, err := CreateOptions(c.URL, c.Username, secrets.Passwords[c.ID], c.CACertificate, c.ServerCertificate, c.Mount)
+		if err != nil {
+			return result, err
+		}
+		result = append(result, options)
+	}
+
+	return result, nil
+}
+
+func (s *registry) save(media []*webdavMedia) error {
+	var collections registryFile
+	collections.Collections = make([]registryCollection, 0)
+	var secrets secretsFile
+	secrets.Passwords = make(map[string]string)
+
+	for _, m := range media {
+		if !m.persisted {
+			continue
+		}
+		var c registryCollection
+		c.URL = m.options.URL
+		c.Username = m.options.Username
+		c.CACertificate = m.options.CACertificate
+		c.ServerCertificate = m.options.ServerCertificate
+		c.Mount = m.options.Mount
+		c.ID = m.id
+		collections.Collections = append(collections.Collections, c)
+		if len(m.options.Password) > 0 {
+			secrets.Passwords[m.id] = m.options.Password
+		}
+	}
+
+	// Write the secrets first, so that a collection is never
+	// stored without the password it needs.
+	err := helpers.WriteJSONFile(s.secretsPath, secrets, 0600)
+	if err != nil {
+		return err
+	}
+	return helpers.WriteJSONFile(s.path, collections, 0644)
+}
@@ -0,0 +1,16 @@
+package webdav
+
+import (
+	"os/exec"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+func run(name string, args ...string) (string, error) {
+	logrus.Debugf("running %s %s", name, strings.Join(args, " "))
+	if out, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		return string(out), err
+	}
+	return "", nil
+}
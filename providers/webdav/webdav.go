@@ -0,0 +1,396 @@
+package webdav
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/olebedev/emitter"
+
+	"github.com/pauldotknopf/automounter/helpers"
+	"github.com/pauldotknopf/automounter/leaser"
+	"github.com/pauldotknopf/automounter/providers"
+)
+
+type webdavProvider struct {
+	mutex   sync.Mutex
+	options ProviderOptions
+	media   []*webdavMedia
+	mounts  []*webdavMount
+	// The mounts of dynamic leases, which aren't
+	// shared with the registered media.
+	dynamicMounts []*webdavMount
+	emit          *emitter.Emitter
+	registry      *registry
+}
+
+// ProviderOptions .
+type ProviderOptions struct {
+	// Where the collections that are persisted are stored, with their
+	// passwords in SecretsPath. If RegistryPath is empty, collections
+	// are only kept in memory.
+	RegistryPath string
+	SecretsPath  string
+	// Where the davfs2 configuration of the mounts is written to.
+	StateDir string
+}
+
+// Provider .
+type Provider interface {
+	providers.MediaProvider
+	TestConnection(options Options) error
+	// Add a collection. Persisted collections are remembered across restarts.
+	AddMedia(options Options, persist bool) (providers.Media, error)
+	RemoveMedia(mediaID string) error
+	DynamicLease(options Options, leaseOptions leaser.LeaseOptions, l leaser.Leaser) (leaser.Lease, providers.Media, error)
+}
+
+// Create a webdav media provider
+func Create(options ProviderOptions) (Provider, error) {
+	p := &webdavProvider{}
+	p.options = options
+
+	p.emit = &emitter.Emitter{}
+	p.emit.Use("*", emitter.Void)
+
+	if len(options.RegistryPath) > 0 {
+		p.registry = &registry{options.RegistryPath, options.SecretsPath}
+		options, err := p.registry.load()
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range options {
+			media := p.buildMedia(o)
+			media.persisted = true
+			p.media = append(p.media, media)
+		}
+	}
+
+	return p, nil
+}
+
+func (s *webdavProvider) Name() string {
+	return "webdav"
+}
+
+func (s *webdavProvider) Start(ctx context.Context) error {
+	// Let everyone know about the collections we loaded from the registry.
+	s.mutex.Lock()
+	for _, media := range s.media {
+		s.emit.Emit("mediaAdded", media)
+	}
+	s.mutex.Unlock()
+
+	<-ctx.Done()
+	return nil
+}
+
+func (s *webdavProvider) GetMedia() []providers.Media {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := make([]providers.Media, 0)
+	for _, media := range s.media {
+		result = append(result, media)
+	}
+	return result
+}
+
+func (s *webdavProvider) GetMediaByID(id string) providers.Media {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, media := range s.media {
+		if media.ID() == id {
+			return media
+		}
+	}
+	return nil
+}
+
+func (s *webdavProvider) Mount(id string) (providers.MountSession, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Check to see if the collection is already mounted
+	for _, mount := range s.mounts {
+		if mount.id == id {
+			return &webdavMount{id: id, mountPath: mount.mountPath, options: mount.options, provider: s}, nil
+		}
+	}
+
+	for _, media := range s.media {
+		if media.id == id {
+			mount, err := s.mount(media)
+			if err != nil {
+				return nil, err
+			}
+			s.mounts = append(s.mounts, mount)
+			s.emit.Emit("mediaMounted", id)
+			return mount, nil
+		}
+	}
+
+	return nil, providers.ErrIDNotFound
+}
+
+func (s *webdavProvider) Unmount(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for mountIndex, mount := range s.mounts {
+		if mount.id == id {
+			err := mount.unmount()
+			if err == nil {
+				s.mounts = append(s.mounts[:mountIndex], s.mounts[mountIndex+1:]...)
+				s.emit.Emit("mediaUnmounted", id)
+			}
+			return err
+		}
+	}
+
+	return providers.ErrIDNotFound
+}
+
+func (s *webdavProvider) RestoreMount(id string, location string) (providers.MountSession, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, media := range s.media {
+		if media.id == id {
+			isMounted, err := helpers.IsMountPoint(location)
+			if err != nil {
+				return nil, err
+			}
+			if !isMounted {
+				return nil, fmt.Errorf("media is no longer mounted at %s", location)
+			}
+			mount := &webdavMount{}
+			mount.id = id
+			mount.mountPath = location
+			mount.stateDir = s.stateDirFor(location)
+			mount.options = media.options
+			mount.provider = s
+			s.mounts = append(s.mounts, mount)
+			return mount, nil
+		}
+	}
+
+	return nil, providers.ErrIDNotFound
+}
+
+func (s *webdavProvider) AdoptMount(mountInfo helpers.MountInfo) (string, providers.MountSession) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, mount := range s.mounts {
+		if mount.mountPath == mountInfo.MountPoint {
+			return mount.id, mount
+		}
+	}
+
+	// davfs2 uses fuse, or coda on older kernels.
+	if mountInfo.FSType != "fuse" && mountInfo.FSType != "davfs" {
+		return "", nil
+	}
+
+	// Only adopt the mount if it belongs to a collection we know about,
+	// and we don't already have that collection mounted somewhere else.
+	for _, media := range s.media {
+		if media.options.URL != mountInfo.Source {
+			continue
+		}
+		for _, mount := range s.mounts {
+			if mount.id == media.id {
+				return "", nil
+			}
+		}
+		mount := &webdavMount{}
+		mount.id = media.id
+		mount.mountPath = mountInfo.MountPoint
+		mount.stateDir = s.stateDirFor(mountInfo.MountPoint)
+		mount.options = media.options
+		mount.provider = s
+		s.mounts = append(s.mounts, mount)
+		return mount.id, mount
+	}
+
+	return "", nil
+}
+
+func (s *webdavProvider) MediaAddded() (<-chan providers.Media, func()) {
+	out := make(chan providers.Media)
+	in := s.emit.On("mediaAdded", func(event *emitter.Event) {
+		out <- event.Args[0].(providers.Media)
+	})
+	cancel := func() {
+		s.emit.Off("mediaAdded", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+func (s *webdavProvider) MediaRemoved() (<-chan string, func()) {
+	out := make(chan string)
+	in := s.emit.On("mediaRemoved", func(event *emitter.Event) {
+		out <- event.String(0)
+	})
+	cancel := func() {
+		s.emit.Off("mediaRemoved", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+func (s *webdavProvider) MediaMounted() (<-chan string, func()) {
+	out := make(chan string)
+	in := s.emit.On("mediaMounted", func(event *emitter.Event) {
+		out <- event.String(0)
+	})
+	cancel := func() {
+		s.emit.Off("mediaMounted", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+func (s *webdavProvider) MediaUnmounted() (<-chan string, func()) {
+	out := make(chan string)
+	in := s.emit.On("mediaUnmounted", func(event *emitter.Event) {
+		out <- event.String(0)
+	})
+	cancel := func() {
+		s.emit.Off("mediaUnmounted", in)
+		close(out)
+	}
+	return out, cancel
+}
+
+func (s *webdavProvider) TestConnection(options Options) error {
+	tmpMountPath, err := helpers.GetTmpMountPath()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpMountPath)
+	stateDir := s.stateDirFor(tmpMountPath)
+	defer os.RemoveAll(stateDir)
+
+	output, err := s.runMount(options, tmpMountPath, stateDir)
+	if err != nil {
+		logrus.Warnf("error testing mount for %s: %s: %+v", options.FriendlyName(), output, err)
+		output = extractErrorsFromMountOutput(output)
+		if len(output) == 0 {
+			return fmt.Errorf("could not mount")
+		}
+		return fmt.Errorf("%s", output)
+	}
+
+	output, err = run("umount", options.UnmountArgs(tmpMountPath)...)
+	if err != nil {
+		logrus.Warnf("error removing mount after test for %s: %s: %+v", options.FriendlyName(), output, err)
+	}
+
+	return nil
+}
+
+func (s *webdavProvider) AddMedia(options Options, persist bool) (providers.Media, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// If the collection is already present, act as if we added it.
+	for _, media := range s.media {
+		if media.options.Hash == options.Hash {
+			if persist && !media.persisted {
+				media.persisted = true
+				err := s.saveRegistry()
+				if err != nil {
+					media.persisted = false
+					return nil, err
+				}
+			}
+			return media, nil
+		}
+	}
+
+	media := s.buildMedia(options)
+	media.persisted = persist
+	s.media = append(s.media, media)
+	if persist {
+		err := s.saveRegistry()
+		if err != nil {
+			s.media = s.media[:len(s.media)-1]
+			return nil, err
+		}
+	}
+	s.emit.Emit("mediaAdded", media)
+
+	return media, nil
+}
+
+func (s *webdavProvider) RemoveMedia(mediaID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(mediaID) == 0 {
+		return providers.ErrIDNotFound
+	}
+
+	for mediaIndex, media := range s.media {
+		if media.id == mediaID {
+			s.media = append(s.media[:mediaIndex], s.media[mediaIndex+1:]...)
+			if media.persisted {
+				err := s.saveRegistry()
+				if err != nil {
+					logrus.Errorf("couldn't remove webdav collection %s from the registry: %+v", media.DisplayName(), err)
+				}
+			}
+			s.emit.Emit("mediaRemoved", mediaID)
+			// Existing mounts/leases are left alone.
+			return nil
+		}
+	}
+
+	return providers.ErrIDNotFound
+}
+
+func (s *webdavProvider) DynamicLease(options Options, leaseOptions leaser.LeaseOptions, l leaser.Leaser) (leaser.Lease, providers.Media, error) {
+	media := s.buildMedia(options)
+	lease, err := l.LeaseDynamic(media, leaseOptions, func() (providers.MountSession, error) {
+		result, err := s.mount(media)
+		if err != nil {
+			return nil, err
+		}
+		result.isDynamic = true
+		s.mutex.Lock()
+		s.dynamicMounts = append(s.dynamicMounts, result)
+		s.mutex.Unlock()
+		return result, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return lease, media, nil
+}
+
+func (s *webdavProvider) releaseDynamic(mount *webdavMount) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for mountIndex, m := range s.dynamicMounts {
+		if m == mount {
+			s.dynamicMounts = append(s.dynamicMounts[:mountIndex], s.dynamicMounts[mountIndex+1:]...)
+			break
+		}
+	}
+	return mount.unmount()
+}
+
+// saveRegistry persists the collections. The mutex must be held.
+func (s *webdavProvider) saveRegistry() error {
+	if s.registry == nil {
+		return nil
+	}
+	return s.registry.save(s.media)
+}
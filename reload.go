@@ -0,0 +1,132 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/pauldotknopf/automounter/config"
+	"github.com/pauldotknopf/automounter/leaser"
+	"github.com/pauldotknopf/automounter/providers/local"
+	"github.com/pauldotknopf/automounter/providers/smb"
+)
+
+// reloadConfig re-reads the config file and applies the settings that
+// can be changed while running. The running config is returned, which
+// keeps the old values of the settings that require a restart.
+func reloadConfig(configPath string, running config.Config, l leaser.Leaser, smbProvider smb.Provider, localProvider local.Provider) config.Config {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		logrus.Errorf("couldn't reload the config, keeping the current one: %v", err)
+		return running
+	}
+	if *fakeMode {
+		cfg = fakeConfig(cfg)
+	}
+
+	restartRequired := config.RestartRequired(running, cfg)
+	if len(restartRequired) > 0 {
+		logrus.Warnf("these settings changed, but require a restart to take effect: %s", strings.Join(restartRequired, ", "))
+	}
+
+	running.LogLevel = cfg.LogLevel
+	running.Leases.UnmountDelay = cfg.Leases.UnmountDelay
+	running.Rules = cfg.Rules
+	running.Providers.SMB.Shares = cfg.Providers.SMB.Shares
+	running.Providers.Local.Directories = cfg.Providers.Local.Directories
+
+	err = applyConfig(running, l, smbProvider, localProvider)
+	if err != nil {
+		logrus.Errorf("couldn't apply the reloaded config: %v", err)
+		return running
+	}
+
+	logrus.Infof("reloaded the config")
+	return running
+}
+
+// applyConfig applies the settings that can be changed while running.
+func applyConfig(cfg config.Config, l leaser.Leaser, smbProvider smb.Provider, localProvider local.Provider) error {
+	logLevel, _ := logrus.ParseLevel(cfg.LogLevel)
+	logrus.SetLevel(logLevel)
+
+	l.SetOptions(buildLeaserOptions(cfg))
+	l.SetRules(buildRules(cfg))
+
+	if smbProvider != nil {
+		err := syncConfiguredShares(cfg.Providers.SMB.Shares, smbProvider)
+		if err != nil {
+			return err
+		}
+	}
+	if localProvider != nil {
+		return localProvider.SetDirectories(buildLocalDirectories(cfg))
+	}
+	return nil
+}
+
+func buildLeaserOptions(cfg config.Config) leaser.Options {
+	options := leaser.DefaultOptions()
+	options.UnmountDelay = cfg.Leases.UnmountDelay
+	options.RestoreTimeout = cfg.Leases.RestoreTimeout
+	return options
+}
+
+func buildRules(cfg config.Config) leaser.Rules {
+	var rules leaser.Rules
+	for _, rule := range cfg.Rules.Allow {
+		rules.Allow = append(rules.Allow, leaser.Rule{Provider: rule.Provider, Properties: rule.Properties})
+	}
+	for _, rule := range cfg.Rules.Deny {
+		rules.Deny = append(rules.Deny, leaser.Rule{Provider: rule.Provider, Properties: rule.Properties})
+	}
+	return rules
+}
+
+func buildLocalDirectories(cfg config.Config) []local.Directory {
+	var directories []local.Directory
+	for _, directory := range cfg.Providers.Local.Directories {
+		var localDirectory local.Directory
+		localDirectory.Name = directory.Name
+		localDirectory.Path = directory.Path
+		localDirectory.ReadOnly = directory.ReadOnly
+		directories = append(directories, localDirectory)
+	}
+	return directories
+}
+
+// syncConfiguredShares adds the shares that are in the config file and
+// removes the ones that aren't anymore. Existing leases aren't affected.
+func syncConfiguredShares(shares []config.SMBShareConfig, smbProvider smb.Provider) error {
+	configured := make([]smb.Options, 0)
+	for _, share := range shares {
+		options, err := smb.CreateOptions(share.Server, share.Share, share.Security, share.Secure, share.Domain, share.Username, share.Password, buildSMBMountOptions(share.Mount), buildSMBKerberosOptions(share.Kerberos))
+		if err != nil {
+			return err
+		}
+		configured = append(configured, options)
+	}
+	return smbProvider.SetConfiguredShares(configured)
+}
+
+func buildSMBMountOptions(mount config.SMBMountConfig) smb.MountOptions {
+	var options smb.MountOptions
+	options.Version = mount.Version
+	options.UID = mount.UID
+	options.GID = mount.GID
+	options.FileMode = mount.FileMode
+	options.DirMode = mount.DirMode
+	options.ReadOnly = mount.ReadOnly
+	options.Cache = mount.Cache
+	options.Seal = mount.Seal
+	options.Port = mount.Port
+	options.IOCharset = mount.IOCharset
+	return options
+}
+
+func buildSMBKerberosOptions(kerberos config.SMBKerberosConfig) smb.KerberosOptions {
+	var options smb.KerberosOptions
+	options.Principal = kerberos.Principal
+	options.Keytab = kerberos.Keytab
+	return options
+}
@@ -0,0 +1,8 @@
+#!/usr/bin/env bash
+
+PENDING_ID="$1"
+
+curl --silent \
+    --request POST \
+    --data '{"pendingId":"'$PENDING_ID'"}' \
+     http://localhost:3000/leases/pending/cancel | jq
@@ -0,0 +1,10 @@
+#!/usr/bin/env bash
+
+# The wait is optional, in seconds to wait for the other leases to be released.
+MEDIA_ID="$1"
+WAIT="${2:-0}"
+
+curl --silent \
+    --request POST \
+    --data "$(jq -n --arg id "$MEDIA_ID" --argjson wait "$WAIT" '{mediaId: $id, mode: "exclusive", wait: $wait}')" \
+     http://localhost:3000/leases/create | jq
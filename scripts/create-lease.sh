@@ -1,9 +1,12 @@
 #!/usr/bin/env bash
 
+# The mount options are optional, comma separated ("noexec,uid=1000").
+# The access is optional, "ro" or "rw".
 MEDIA_ID="$1"
+MOUNT_OPTIONS="$2"
+ACCESS="$3"
 
 curl --silent \
     --request POST \
-    --data '{"mediaId":"'$MEDIA_ID'"}' \
+    --data "$(jq -n --arg id "$MEDIA_ID" --arg options "$MOUNT_OPTIONS" --arg access "$ACCESS" '{mediaId: $id, mountOptions: ($options | split(",") | map(select(length > 0))), access: $access}')" \
      http://localhost:3000/leases/create | jq
-
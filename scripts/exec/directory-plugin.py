@@ -0,0 +1,93 @@
+#!/usr/bin/env python3
+"""An example plugin for the exec provider.
+
+Every directory in the given directory is exposed as media, and is
+bind mounted when leased. Directories that are created or deleted
+are picked up within a second.
+
+    providers:
+      exec:
+        plugins:
+          - name: dirs
+            path: /usr/bin/python3
+            args: [/path/to/directory-plugin.py, /srv/media]
+"""
+
+import json
+import os
+import subprocess
+import sys
+import threading
+import time
+
+NOT_FOUND = -32000
+
+root = sys.argv[1]
+write_lock = threading.Lock()
+watching = False
+
+
+def send(message):
+    message["jsonrpc"] = "2.0"
+    with write_lock:
+        sys.stdout.write(json.dumps(message) + "\n")
+        sys.stdout.flush()
+
+
+def media(name):
+    return {
+        "id": name,
+        "displayName": name,
+        "properties": {"path": os.path.join(root, name)},
+    }
+
+
+def scan():
+    return sorted(
+        name for name in os.listdir(root)
+        if os.path.isdir(os.path.join(root, name)))
+
+
+def watch():
+    known = set(scan())
+    while True:
+        time.sleep(1)
+        current = set(scan())
+        for name in sorted(current - known):
+            send({"method": "mediaAdded", "params": media(name)})
+        for name in sorted(known - current):
+            send({"method": "mediaRemoved", "params": {"id": name}})
+        known = current
+
+
+def handle(method, params):
+    global watching
+    if method == "watch":
+        if not watching:
+            watching = True
+            threading.Thread(target=watch, daemon=True).start()
+        return None
+    if method == "list":
+        return [media(name) for name in scan()]
+    if method in ("mount", "unmount"):
+        if params["id"] not in scan():
+            raise LookupError(params["id"])
+        if method == "mount":
+            args = ["mount", "--bind", os.path.join(root, params["id"]), params["mountPath"]]
+        else:
+            args = ["umount", params["mountPath"]]
+        subprocess.run(args, check=True, capture_output=True, text=True)
+        return None
+    raise NotImplementedError(method)
+
+
+for line in sys.stdin:
+    request = json.loads(line)
+    try:
+        send({"id": request["id"], "result": handle(request["method"], request.get("params"))})
+    except LookupError as e:
+        send({"id": request["id"], "error": {"code": NOT_FOUND, "message": "no directory named %s" % e}})
+    except subprocess.CalledProcessError as e:
+        send({"id": request["id"], "error": {"code": -32603, "message": e.stderr.strip()}})
+    except Exception as e:
+        send({"id": request["id"], "error": {"code": -32603, "message": repr(e)}})
@@ -0,0 +1,13 @@
+#!/usr/bin/env bash
+
+DISPLAY_NAME="$1"
+LABEL="$2"
+
+if [ "$DISPLAY_NAME" == "" ]; then
+    DISPLAY_NAME="Fake stick"
+fi
+
+curl --silent \
+    --request POST \
+    --data '{"displayName":"'"$DISPLAY_NAME"'", "properties":{"fsType":"vfat", "label":"'"$LABEL"'"}, "files":{"README.txt":"Hello from '"$DISPLAY_NAME"'\n"}}' \
+     http://localhost:3000/fake/add | jq
@@ -0,0 +1,11 @@
+#!/usr/bin/env bash
+
+# Omit the messages to make mounting and unmounting work again.
+MEDIA_ID="$1"
+MOUNT_ERROR="$2"
+UNMOUNT_ERROR="$3"
+
+curl --silent \
+    --request POST \
+    --data '{"mediaId":"'$MEDIA_ID'", "mount":"'"$MOUNT_ERROR"'", "unmount":"'"$UNMOUNT_ERROR"'"}' \
+     http://localhost:3000/fake/failures | jq
@@ -0,0 +1,15 @@
+#!/usr/bin/env bash
+
+# Needs the admin token in $ADMIN_TOKEN.
+IMAGE_PATH="$1"
+READ_ONLY="$2"
+
+if [ "$READ_ONLY" == "" ]; then
+    READ_ONLY="true"
+fi
+
+curl --silent \
+    --request POST \
+    --header "Authorization: Bearer $ADMIN_TOKEN" \
+    --data '{"path":"'$IMAGE_PATH'", "readOnly":'$READ_ONLY'}' \
+     http://localhost:3000/image/add | jq
@@ -0,0 +1,10 @@
+#!/usr/bin/env bash
+
+# Needs the admin token in $ADMIN_TOKEN.
+IMAGE_ID="$1"
+
+curl --silent \
+    --request POST \
+    --header "Authorization: Bearer $ADMIN_TOKEN" \
+    --data '{"imageId":"'$IMAGE_ID'"}' \
+     http://localhost:3000/image/remove | jq
@@ -0,0 +1,17 @@
+#!/usr/bin/env bash
+
+SERVER="$1"
+EXPORT="$2"
+VERSION="$3"
+
+if [ "$SERVER" == "" ]; then
+    SERVER="localhost"
+fi
+
+if [ "$EXPORT" == "" ]; then
+    EXPORT="/var/lib/nfs-custom"
+fi
+
+echo "server: $SERVER"
+echo "export: $EXPORT"
+echo "version: $VERSION"
@@ -0,0 +1,8 @@
+#!/usr/bin/env bash
+
+. ./.nfs-params.sh
+
+curl --silent \
+    --request POST \
+    --data '{"server":"'$SERVER'", "export":"'$EXPORT'", "version":"'$VERSION'"}' \
+     http://localhost:3000/nfs/add | jq
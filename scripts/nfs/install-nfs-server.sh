@@ -0,0 +1,8 @@
+#!/usr/bin/env bash
+set -e
+sudo apt-get install -y nfs-kernel-server nfs-common
+sudo mkdir -p /var/lib/nfs-custom
+sudo chmod 777 /var/lib/nfs-custom
+echo "/var/lib/nfs-custom localhost(rw,sync,no_subtree_check,insecure)" | sudo tee -a /etc/exports
+sudo exportfs -ra
+sudo systemctl restart nfs-kernel-server
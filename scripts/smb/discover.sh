@@ -0,0 +1,5 @@
+#!/usr/bin/env bash
+
+curl --silent \
+    --request GET \
+    http://localhost:3000/smb/discover | jq
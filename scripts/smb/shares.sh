@@ -0,0 +1,8 @@
+#!/usr/bin/env bash
+
+. ./.smb-params.sh
+
+curl --silent \
+    --request POST \
+    --data '{"server":"'$SERVER'", "secure":'$SECURE', "username":"'$USERNAME'", "password":"'$PASSWORD'"}' \
+     http://localhost:3000/smb/shares | jq
@@ -0,0 +1,26 @@
+#!/usr/bin/env bash
+
+SERVER="$1"
+USERNAME="$2"
+REMOTE_PATH="$3"
+PASSWORD="$4"
+
+if [ "$SERVER" == "" ]; then
+    SERVER="localhost"
+fi
+
+if [ "$USERNAME" == "" ]; then
+    USERNAME="pknopf"
+fi
+
+if [ "$PASSWORD" == "" ]; then
+    PASSWORD="password"
+fi
+
+# The host key of the server must be known.
+KNOWN_HOSTS=$(ssh-keyscan -t ed25519 "$SERVER" 2>/dev/null)
+
+echo "server: $SERVER"
+echo "username: $USERNAME"
+echo "path: $REMOTE_PATH"
+echo "password: $PASSWORD"
@@ -0,0 +1,15 @@
+#!/usr/bin/env bash
+
+. ./.sshfs-params.sh
+
+jq --null-input \
+    --arg server "$SERVER" \
+    --arg username "$USERNAME" \
+    --arg path "$REMOTE_PATH" \
+    --arg password "$PASSWORD" \
+    --arg knownHosts "$KNOWN_HOSTS" \
+    '{server: $server, username: $username, path: $path, password: $password, knownHosts: $knownHosts}' | \
+curl --silent \
+    --request POST \
+    --data @- \
+     http://localhost:3000/sshfs/test | jq
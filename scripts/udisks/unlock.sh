@@ -0,0 +1,18 @@
+#!/usr/bin/env bash
+
+# Pass a keyfile with -k, instead of the passphrase.
+MEDIA_ID="$1"
+
+if [ "$2" == "-k" ]; then
+    KEYFILE=$(base64 -w 0 "$3")
+    DATA='{"mediaId":"'$MEDIA_ID'", "keyfile":"'$KEYFILE'"}'
+else
+    read -r -s -p "Passphrase: " PASSPHRASE
+    echo >&2
+    DATA=$(jq -n --arg id "$MEDIA_ID" --arg passphrase "$PASSPHRASE" '{mediaId: $id, passphrase: $passphrase}')
+fi
+
+curl --silent \
+    --request POST \
+    --data "$DATA" \
+     http://localhost:3000/udisks/unlock | jq
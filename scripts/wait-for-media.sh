@@ -0,0 +1,11 @@
+#!/usr/bin/env bash
+
+# Blocks until media with the given filesystem label shows up, and leases it.
+# The timeout is optional, in seconds.
+LABEL="$1"
+TIMEOUT="${2:-0}"
+
+curl --silent \
+    --request POST \
+    --data "$(jq -n --arg label "$LABEL" --argjson timeout "$TIMEOUT" '{selector: {label: $label}, timeout: $timeout, block: true}')" \
+     http://localhost:3000/leases/wait | jq
@@ -0,0 +1,13 @@
+#!/usr/bin/env bash
+
+URL="$1"
+USERNAME="$2"
+PASSWORD="$3"
+
+if [ "$URL" == "" ]; then
+    URL="http://localhost:8080/"
+fi
+
+echo "url: $URL"
+echo "username: $USERNAME"
+echo "password: $PASSWORD"
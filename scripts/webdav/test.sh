@@ -0,0 +1,13 @@
+#!/usr/bin/env bash
+
+. ./.webdav-params.sh
+
+jq --null-input \
+    --arg url "$URL" \
+    --arg username "$USERNAME" \
+    --arg password "$PASSWORD" \
+    '{url: $url, username: $username, password: $password}' | \
+curl --silent \
+    --request POST \
+    --data @- \
+     http://localhost:3000/webdav/test | jq
@@ -9,3 +9,5 @@ import (
 )
 
 var terminationSignals = []os.Signal{unix.SIGTERM, unix.SIGINT}
+
+var reloadSignals = []os.Signal{unix.SIGHUP}
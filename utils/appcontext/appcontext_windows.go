@@ -5,3 +5,5 @@ import (
 )
 
 var terminationSignals = []os.Signal{os.Interrupt}
+
+var reloadSignals = []os.Signal{}
@@ -0,0 +1,37 @@
+package appcontext
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+)
+
+var reloadsCache chan struct{}
+var reloadsOnce sync.Once
+
+// Reloads returns a static channel that receives a value every time
+// the running process is asked to reload its configuration (SIGHUP).
+// The signal is only caught from the first call on, so call it early.
+func Reloads() <-chan struct{} {
+	reloadsOnce.Do(func() {
+		reloadsCache = make(chan struct{}, 1)
+
+		if len(reloadSignals) == 0 {
+			return
+		}
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, reloadSignals...)
+
+		go func() {
+			for range signals {
+				select {
+				case reloadsCache <- struct{}{}:
+				default:
+					// A reload is already pending.
+				}
+			}
+		}()
+	})
+	return reloadsCache
+}
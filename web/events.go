@@ -39,9 +39,10 @@ func (server *Server) events(w http.ResponseWriter, r *http.Request) {
 	removedChannel, removedChannelCancel := server.mediaProvider.MediaRemoved()
 	mediaMountedChannel, mediaMountedChannelCancel := server.mediaProvider.MediaMounted()
 	mediaUnmounteChannel, mediaUnmountedChannelCancel := server.mediaProvider.MediaUnmounted()
+	leaseRemovedChannel, leaseRemovedChannelCancel := server.leaser.LeaseRemoved()
 
 	var wg sync.WaitGroup
-	wg.Add(4)
+	wg.Add(5)
 	go func() {
 		defer wg.Done()
 		for media := range addedChannel {
@@ -74,6 +75,40 @@ func (server *Server) events(w http.ResponseWriter, r *http.Request) {
 			doUnlock()
 		}
 	}()
+	go func() {
+		defer wg.Done()
+		for event := range leaseRemovedChannel {
+			doLock()
+			c.WriteJSON(eventStruct{"leaseRemoved", convertLeaseEventToJSON(event)})
+			doUnlock()
+		}
+	}()
+
+	// The events that only some providers have.
+	providerCancels := make([]func(), 0)
+
+	if server.smbProvider != nil {
+		mediaDegradedChannel, mediaDegradedChannelCancel := server.smbProvider.MediaDegraded()
+		mediaRecoveredChannel, mediaRecoveredChannelCancel := server.smbProvider.MediaRecovered()
+		providerCancels = append(providerCancels, mediaDegradedChannelCancel, mediaRecoveredChannelCancel)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for media := range mediaDegradedChannel {
+				doLock()
+				c.WriteJSON(eventStruct{"mediaDegraded", media})
+				doUnlock()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for media := range mediaRecoveredChannel {
+				doLock()
+				c.WriteJSON(eventStruct{"mediaRecovered", media})
+				doUnlock()
+			}
+		}()
+	}
 
 	c.ReadMessage()
 
@@ -81,6 +116,10 @@ func (server *Server) events(w http.ResponseWriter, r *http.Request) {
 	removedChannelCancel()
 	mediaMountedChannelCancel()
 	mediaUnmountedChannelCancel()
+	leaseRemovedChannelCancel()
+	for _, providerCancel := range providerCancels {
+		providerCancel()
+	}
 
 	wg.Wait()
 }
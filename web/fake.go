@@ -0,0 +1,127 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/pauldotknopf/automounter/providers/fake"
+)
+
+type fakeResponse struct {
+	genericResponse
+	Entries []map[string]interface{} `json:"entries"`
+}
+
+type fakeAddRequest struct {
+	ID          string            `json:"id"`
+	DisplayName string            `json:"displayName"`
+	Properties  map[string]string `json:"properties"`
+	Files       map[string]string `json:"files"`
+}
+
+type fakeAddResponse struct {
+	genericResponse
+	MediaID string `json:"mediaId"`
+}
+
+type fakeRemoveRequest struct {
+	MediaID string `json:"mediaId"`
+}
+
+type fakeRemoveResponse struct {
+	genericResponse
+}
+
+type fakeFailuresRequest struct {
+	MediaID string `json:"mediaId"`
+	// The error messages returned by the next mounts and
+	// unmounts, empty for them to succeed.
+	Mount   string `json:"mount"`
+	Unmount string `json:"unmount"`
+}
+
+type fakeFailuresResponse struct {
+	genericResponse
+}
+
+func (server *Server) fake(w http.ResponseWriter, r *http.Request) {
+	var response fakeResponse
+	response.Success = true
+	response.Entries = convertMediaArrayToJSON(server.fakeProvider.GetMedia())
+	sendResponse(w, http.StatusOK, response)
+}
+
+func (server *Server) fakeAdd(w http.ResponseWriter, r *http.Request) {
+
+	var request fakeAddRequest
+	var response fakeAddResponse
+
+	err := getRequestBody(r, &request)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	media, err := server.fakeProvider.AddMedia(fake.Options(request))
+	if err != nil {
+		response.Message = err.Error()
+		response.Success = false
+	} else {
+		response.MediaID = media.ID()
+		response.Success = true
+	}
+
+	sendResponse(w, http.StatusOK, response)
+}
+
+func (server *Server) fakeRemove(w http.ResponseWriter, r *http.Request) {
+
+	var request fakeRemoveRequest
+	var response fakeRemoveResponse
+
+	err := getRequestBody(r, &request)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	err = server.fakeProvider.RemoveMedia(request.MediaID)
+	if err != nil {
+		response.Success = false
+		response.Message = err.Error()
+	} else {
+		response.Success = true
+	}
+
+	sendResponse(w, http.StatusOK, response)
+}
+
+func (server *Server) fakeFailures(w http.ResponseWriter, r *http.Request) {
+
+	var request fakeFailuresRequest
+	var response fakeFailuresResponse
+
+	err := getRequestBody(r, &request)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	var failures fake.Failures
+	if len(request.Mount) > 0 {
+		failures.Mount = errors.New(request.Mount)
+	}
+	if len(request.Unmount) > 0 {
+		failures.Unmount = errors.New(request.Unmount)
+	}
+
+	err = server.fakeProvider.SetFailures(request.MediaID, failures)
+	if err != nil {
+		response.Success = false
+		response.Message = err.Error()
+	} else {
+		response.Success = true
+	}
+
+	sendResponse(w, http.StatusOK, response)
+}
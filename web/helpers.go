@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net/http"
 
+	"github.com/pauldotknopf/automounter/leaser"
 	"github.com/pauldotknopf/automounter/providers"
 )
 
@@ -18,10 +19,14 @@ func getRequestBody(r *http.Request, request interface{}) error {
 }
 
 func sendError(w http.ResponseWriter, err error) {
+	sendErrorStatus(w, http.StatusBadRequest, err)
+}
+
+func sendErrorStatus(w http.ResponseWriter, statusCode int, err error) {
 	var response genericResponse
 	response.Success = false
 	response.Message = err.Error()
-	sendResponse(w, http.StatusBadRequest, response)
+	sendResponse(w, statusCode, response)
 }
 
 func sendResponse(w http.ResponseWriter, statusCode int, response interface{}) {
@@ -37,10 +42,35 @@ func convertMediaToJSON(media providers.Media) map[string]interface{} {
 	m["id"] = media.ID()
 	m["displayName"] = media.DisplayName()
 	m["provider"] = media.Provider()
-	m["properties"] = media.Properties()
+	m["properties"] = redactProperties(media)
 	return m
 }
 
+// redactProperties Removes the secret properties, which
+// are only available through the privileged endpoint.
+func redactProperties(media providers.Media) map[string]string {
+	properties := media.Properties()
+	if secretMedia, ok := media.(providers.SecretMedia); ok {
+		for _, key := range secretMedia.SecretProperties() {
+			delete(properties, key)
+		}
+	}
+	return properties
+}
+
+func getSecretProperties(media providers.Media) map[string]string {
+	result := make(map[string]string)
+	if secretMedia, ok := media.(providers.SecretMedia); ok {
+		properties := media.Properties()
+		for _, key := range secretMedia.SecretProperties() {
+			if value, ok := properties[key]; ok {
+				result[key] = value
+			}
+		}
+	}
+	return result
+}
+
 func convertMediaArrayToJSON(media []providers.Media) []map[string]interface{} {
 	result := make([]map[string]interface{}, 0)
 	for _, media := range media {
@@ -48,3 +78,11 @@ func convertMediaArrayToJSON(media []providers.Media) []map[string]interface{} {
 	}
 	return result
 }
+
+func convertLeaseEventToJSON(event leaser.LeaseEvent) map[string]interface{} {
+	m := make(map[string]interface{})
+	m["leaseId"] = event.LeaseID
+	m["mediaId"] = event.MediaID
+	m["reason"] = event.Reason
+	return m
+}
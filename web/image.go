@@ -0,0 +1,101 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/pauldotknopf/automounter/providers/image"
+)
+
+type imageResponse struct {
+	genericResponse
+	Entries []map[string]interface{} `json:"entries"`
+}
+
+type imageAddRequest struct {
+	Path     string `json:"path"`
+	ReadOnly bool   `json:"readOnly"`
+}
+
+type imageAddResponse struct {
+	genericResponse
+	ImageID string `json:"imageId"`
+	// The filesystems found in the image
+	Media []map[string]interface{} `json:"media"`
+}
+
+type imageRemoveRequest struct {
+	ImageID string `json:"imageId"`
+}
+
+type imageRemoveResponse struct {
+	genericResponse
+}
+
+func (server *Server) image(w http.ResponseWriter, r *http.Request) {
+	var response imageResponse
+	response.Success = true
+	response.Entries = convertMediaArrayToJSON(server.imageProvider.GetMedia())
+	sendResponse(w, http.StatusOK, response)
+}
+
+// imageAdd Requires the admin token, images are
+// opened as root and can be attached read-write.
+func (server *Server) imageAdd(w http.ResponseWriter, r *http.Request) {
+	if !server.isAdmin(r) {
+		sendUnauthorized(w)
+		return
+	}
+
+	var request imageAddRequest
+	var response imageAddResponse
+
+	err := getRequestBody(r, &request)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	options, err := image.CreateOptions(request.Path, request.ReadOnly)
+	if err != nil {
+		response.Message = err.Error()
+		response.Success = false
+	} else {
+		imageID, media, err := server.imageProvider.AddImage(options, true)
+		if err != nil {
+			response.Message = err.Error()
+			response.Success = false
+		} else {
+			response.ImageID = imageID
+			response.Media = convertMediaArrayToJSON(media)
+			response.Success = true
+		}
+	}
+
+	sendResponse(w, http.StatusOK, response)
+}
+
+func (server *Server) imageRemove(w http.ResponseWriter, r *http.Request) {
+	if !server.isAdmin(r) {
+		sendUnauthorized(w)
+		return
+	}
+
+	var request imageRemoveRequest
+	var response imageRemoveResponse
+
+	err := getRequestBody(r, &request)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	err = server.imageProvider.RemoveImage(request.ImageID)
+	if err != nil {
+		response.Success = false
+		response.Message = err.Error()
+	} else {
+		response.Success = true
+	}
+
+	sendResponse(w, http.StatusOK, response)
+}
@@ -3,6 +3,9 @@ package web
 import (
 	"fmt"
 	"net/http"
+	"time"
+
+	"github.com/pauldotknopf/automounter/leaser"
 )
 
 type leasesResponse struct {
@@ -12,6 +15,17 @@ type leasesResponse struct {
 
 type leaseCreateRequest struct {
 	MediaID string `json:"mediaId"`
+	// In seconds, zero for a lease that never expires.
+	TTL int `json:"ttl"`
+	// Like "noexec" or "uid=1000", for providers that support them.
+	MountOptions []string `json:"mountOptions"`
+	// "ro" or "rw", empty to use the media however it is mounted
+	Access string `json:"access"`
+	// "exclusive" to be the only lease on the media, empty to share it
+	Mode string `json:"mode"`
+	// In seconds, how long to wait for conflicting leases
+	// to be released, at most five minutes.
+	Wait int `json:"wait"`
 }
 
 type leaseCreateResponse struct {
@@ -19,6 +33,11 @@ type leaseCreateResponse struct {
 	Media     map[string]interface{} `json:"media"`
 	MountPath string                 `json:"mountPath"`
 	LeaseID   string                 `json:"leaseId"`
+	ExpiresAt *time.Time             `json:"expiresAt"`
+	// The options the media was mounted with, if known
+	MountOptions []string `json:"mountOptions"`
+	ReadOnly     bool     `json:"readOnly"`
+	Exclusive    bool     `json:"exclusive"`
 }
 
 type leaseReleaseRequest struct {
@@ -29,6 +48,15 @@ type leaseReleaseResponse struct {
 	genericResponse
 }
 
+type leaseRenewRequest struct {
+	LeaseID string `json:"leaseId"`
+}
+
+type leaseRenewResponse struct {
+	genericResponse
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
 func (server *Server) leases(w http.ResponseWriter, r *http.Request) {
 	var response leasesResponse
 
@@ -40,6 +68,10 @@ func (server *Server) leases(w http.ResponseWriter, r *http.Request) {
 		l["mediaId"] = lease.MediaID()
 		l["mountPath"] = lease.MountPath()
 		l["isValid"] = lease.IsValid()
+		l["expiresAt"] = convertExpiresAtToJSON(lease)
+		l["mountOptions"] = lease.MountOptions()
+		l["readOnly"] = lease.ReadOnly()
+		l["exclusive"] = lease.Exclusive()
 		response.Leases = append(response.Leases, l)
 	}
 
@@ -65,17 +97,27 @@ func (server *Server) leaseCreate(w http.ResponseWriter, r *http.Request) {
 	var response leaseCreateResponse
 	response.Media = convertMediaToJSON(media)
 
-	lease, err := server.leaser.Lease(request.MediaID)
+	leaseOptions := buildLeaseOptions(request.TTL)
+	leaseOptions.MountOptions = request.MountOptions
+	leaseOptions.Access = leaser.Access(request.Access)
+	leaseOptions.Mode = leaser.Mode(request.Mode)
+	leaseOptions.Wait = time.Duration(request.Wait) * time.Second
+	leaseOptions.Cancel = r.Context().Done()
+	lease, err := server.leaser.Lease(request.MediaID, leaseOptions)
 	if err != nil {
 		response.Success = false
 		response.Message = err.Error()
-		sendResponse(w, http.StatusBadRequest, response)
+		sendResponse(w, leaseErrorStatus(err), response)
 		return
 	}
 
-	response.Success = true
-	response.LeaseID = lease.ID()
-	response.MountPath = lease.MountPath()
+	// The client may have given up while we were waiting.
+	if r.Context().Err() != nil {
+		server.leaser.Release(lease.ID())
+		return
+	}
+
+	setLeaseResponse(&response, lease)
 	sendResponse(w, http.StatusOK, response)
 }
 
@@ -101,3 +143,68 @@ func (server *Server) leaseRelease(w http.ResponseWriter, r *http.Request) {
 	response.Success = true
 	sendResponse(w, http.StatusOK, response)
 }
+
+func (server *Server) leaseRenew(w http.ResponseWriter, r *http.Request) {
+	var request leaseRenewRequest
+	getRequestBody(r, &request)
+
+	if len(request.LeaseID) == 0 {
+		sendError(w, fmt.Errorf("no lease id provided"))
+		return
+	}
+
+	var response leaseRenewResponse
+
+	err := server.leaser.Renew(request.LeaseID)
+	if err != nil {
+		response.Success = false
+		response.Message = err.Error()
+		sendResponse(w, http.StatusBadRequest, response)
+		return
+	}
+
+	for _, lease := range server.leaser.Leases() {
+		if lease.ID() == request.LeaseID {
+			response.ExpiresAt = convertExpiresAtToJSON(lease)
+		}
+	}
+
+	response.Success = true
+	sendResponse(w, http.StatusOK, response)
+}
+
+func setLeaseResponse(response *leaseCreateResponse, lease leaser.Lease) {
+	response.Success = true
+	response.LeaseID = lease.ID()
+	response.MountPath = lease.MountPath()
+	response.ExpiresAt = convertExpiresAtToJSON(lease)
+	response.MountOptions = lease.MountOptions()
+	response.ReadOnly = lease.ReadOnly()
+	response.Exclusive = lease.Exclusive()
+}
+
+func leaseErrorStatus(err error) int {
+	switch err {
+	case leaser.ErrLeasedExclusively, leaser.ErrAlreadyLeased:
+		return http.StatusConflict
+	case leaser.ErrMediaTimeout:
+		return http.StatusRequestTimeout
+	case leaser.ErrTooManyPending:
+		return http.StatusTooManyRequests
+	}
+	return http.StatusBadRequest
+}
+
+func buildLeaseOptions(ttl int) leaser.LeaseOptions {
+	var options leaser.LeaseOptions
+	options.TTL = time.Duration(ttl) * time.Second
+	return options
+}
+
+func convertExpiresAtToJSON(lease leaser.Lease) *time.Time {
+	expiresAt := lease.ExpiresAt()
+	if expiresAt.IsZero() {
+		return nil
+	}
+	return &expiresAt
+}
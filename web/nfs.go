@@ -0,0 +1,202 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/pauldotknopf/automounter/providers/nfs"
+)
+
+type nfsResponse struct {
+	genericResponse
+	Entries []map[string]interface{} `json:"entries"`
+}
+
+type nfsTestRequest struct {
+	Server   string `json:"server"`
+	Export   string `json:"export"`
+	Version  string `json:"version"`
+	Security string `json:"security"`
+	ReadOnly bool   `json:"readOnly"`
+	Soft     bool   `json:"soft"`
+	Timeout  int    `json:"timeout"`
+	Retrans  int    `json:"retrans"`
+	Protocol string `json:"protocol"`
+	Port     int    `json:"port"`
+	NoLock   bool   `json:"noLock"`
+}
+
+type nfsTestResponse struct {
+	genericResponse
+	IsValid bool `json:"isValid"`
+}
+
+type nfsAddRequest struct {
+	nfsTestRequest
+}
+
+type nfsAddResponse struct {
+	genericResponse
+	MediaID string `json:"mediaId"`
+}
+
+type nfsRemoveRequest struct {
+	MediaID string `json:"mediaId"`
+}
+
+type nfsRemoveResponse struct {
+	genericResponse
+}
+
+type nfsDynamicLeaseRequest struct {
+	nfsTestRequest
+	// In seconds, zero for a lease that never expires.
+	TTL int `json:"ttl"`
+}
+
+type nfsDynamicLeaseResponse struct {
+	leaseCreateResponse
+}
+
+func (server *Server) nfs(w http.ResponseWriter, r *http.Request) {
+	var response nfsResponse
+	response.Success = true
+	response.Entries = convertMediaArrayToJSON(server.nfsProvider.GetMedia())
+	sendResponse(w, http.StatusOK, response)
+}
+
+func (server *Server) nfsTest(w http.ResponseWriter, r *http.Request) {
+
+	var request nfsTestRequest
+	var response nfsTestResponse
+
+	err := getRequestBody(r, &request)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	// The request was a success (but maybe not the nfs test)
+	response.Success = true
+
+	options, err := buildNFSOptions(request)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	err = server.nfsProvider.TestConnection(options)
+	if err != nil {
+		response.Message = err.Error()
+		response.IsValid = false
+	} else {
+		response.IsValid = true
+	}
+
+	sendResponse(w, http.StatusOK, response)
+}
+
+func (server *Server) nfsAdd(w http.ResponseWriter, r *http.Request) {
+
+	var request nfsAddRequest
+	var response nfsAddResponse
+
+	err := getRequestBody(r, &request)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	options, err := buildNFSOptions(request.nfsTestRequest)
+	if err != nil {
+		response.Message = err.Error()
+		response.Success = false
+	} else {
+		media, err := server.nfsProvider.AddMedia(options, true)
+		if err != nil {
+			response.Message = err.Error()
+			response.Success = false
+		} else {
+			response.MediaID = media.ID()
+			response.Success = true
+		}
+	}
+
+	sendResponse(w, http.StatusOK, response)
+}
+
+func (server *Server) nfsRemove(w http.ResponseWriter, r *http.Request) {
+
+	var request nfsRemoveRequest
+	var response nfsRemoveResponse
+
+	err := getRequestBody(r, &request)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	err = server.nfsProvider.RemoveMedia(request.MediaID)
+	if err != nil {
+		response.Success = false
+		response.Message = err.Error()
+	} else {
+		response.Success = true
+	}
+
+	sendResponse(w, http.StatusOK, response)
+}
+
+func (server *Server) nfsDynamicLease(w http.ResponseWriter, r *http.Request) {
+
+	var request nfsDynamicLeaseRequest
+	var response nfsDynamicLeaseResponse
+
+	err := getRequestBody(r, &request)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	options, err := buildNFSOptions(request.nfsTestRequest)
+	if err != nil {
+		response.Message = err.Error()
+		response.Success = false
+		sendResponse(w, http.StatusOK, response)
+		return
+	}
+
+	lease, media, err := server.nfsProvider.DynamicLease(options,
+		buildLeaseOptions(request.TTL),
+		server.leaser)
+
+	if err != nil {
+		response.Success = false
+		response.Message = err.Error()
+		sendResponse(w, http.StatusOK, response)
+		return
+	}
+
+	response.Media = convertMediaToJSON(media)
+	response.Success = true
+	response.LeaseID = lease.ID()
+	response.MountPath = lease.MountPath()
+	response.ExpiresAt = convertExpiresAtToJSON(lease)
+	response.MountOptions = lease.MountOptions()
+	response.ReadOnly = lease.ReadOnly()
+
+	sendResponse(w, http.StatusOK, response)
+}
+
+func buildNFSOptions(request nfsTestRequest) (nfs.Options, error) {
+	var mount nfs.MountOptions
+	mount.Version = request.Version
+	mount.Security = request.Security
+	mount.ReadOnly = request.ReadOnly
+	mount.Soft = request.Soft
+	mount.Timeout = request.Timeout
+	mount.Retrans = request.Retrans
+	mount.Protocol = request.Protocol
+	mount.Port = request.Port
+	mount.NoLock = request.NoLock
+	return nfs.CreateOptions(request.Server, request.Export, mount)
+}
@@ -0,0 +1,184 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pauldotknopf/automounter/leaser"
+)
+
+type leaseSelectorRequest struct {
+	Provider string `json:"provider"`
+	UUID     string `json:"uuid"`
+	Label    string `json:"label"`
+	Vendor   string `json:"vendor"`
+	Serial   string `json:"serial"`
+	// In bytes, zero for no limit
+	MinSize uint64 `json:"minSize"`
+	MaxSize uint64 `json:"maxSize"`
+}
+
+type leaseWaitRequest struct {
+	Selector leaseSelectorRequest `json:"selector"`
+	// In seconds, zero to wait until it is canceled. Non-blocking
+	// waits need a timeout or a ttl, so they can't be forgotten.
+	Timeout int `json:"timeout"`
+	// Respond once the media is leased, instead of
+	// right away with the id of the pending lease.
+	Block bool `json:"block"`
+	// In seconds, zero for a lease that never expires.
+	TTL          int      `json:"ttl"`
+	MountOptions []string `json:"mountOptions"`
+	Access       string   `json:"access"`
+	Mode         string   `json:"mode"`
+}
+
+type leaseWaitResponse struct {
+	leaseCreateResponse
+	PendingID string `json:"pendingId"`
+}
+
+type leasesPendingResponse struct {
+	genericResponse
+	Pending []map[string]interface{} `json:"pending"`
+}
+
+type leasePendingCancelRequest struct {
+	PendingID string `json:"pendingId"`
+}
+
+type leasePendingCancelResponse struct {
+	genericResponse
+}
+
+func (server *Server) leaseWait(w http.ResponseWriter, r *http.Request) {
+	var request leaseWaitRequest
+	err := getRequestBody(r, &request)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	if !request.Block && request.Timeout == 0 && request.TTL == 0 {
+		sendError(w, fmt.Errorf("a non-blocking wait needs a timeout or a ttl"))
+		return
+	}
+
+	selector := leaser.Selector(request.Selector)
+
+	leaseOptions := buildLeaseOptions(request.TTL)
+	leaseOptions.MountOptions = request.MountOptions
+	leaseOptions.Access = leaser.Access(request.Access)
+	leaseOptions.Mode = leaser.Mode(request.Mode)
+
+	pending, err := server.leaser.LeaseWhenAvailable(selector, leaseOptions, time.Duration(request.Timeout)*time.Second)
+	if err != nil {
+		sendErrorStatus(w, leaseErrorStatus(err), err)
+		return
+	}
+
+	var response leaseWaitResponse
+	response.PendingID = pending.ID()
+
+	if !request.Block {
+		response.Success = true
+		sendResponse(w, http.StatusOK, response)
+		return
+	}
+
+	select {
+	case <-pending.Done():
+	case <-r.Context().Done():
+		// Nobody is left to hand the lease to.
+		server.leaser.CancelPending(pending.ID())
+		return
+	}
+
+	if pending.Err() != nil {
+		response.Success = false
+		response.Message = pending.Err().Error()
+		sendResponse(w, leaseErrorStatus(pending.Err()), response)
+		return
+	}
+
+	lease := pending.Snapshot()
+	if !lease.IsValid() {
+		// Gone before we could hand it out, like when the ttl is very short.
+		response.Success = false
+		response.Message = "the lease was invalidated before it could be handed out"
+		sendResponse(w, http.StatusGone, response)
+		return
+	}
+	if media := server.leaser.MediaProvider().GetMediaByID(lease.MediaID()); media != nil {
+		response.Media = convertMediaToJSON(media)
+	}
+	setLeaseResponse(&response.leaseCreateResponse, lease)
+	sendResponse(w, http.StatusOK, response)
+}
+
+func (server *Server) leasesPending(w http.ResponseWriter, r *http.Request) {
+	var response leasesPendingResponse
+
+	response.Pending = make([]map[string]interface{}, 0)
+	for _, pending := range server.leaser.PendingLeases() {
+		p := make(map[string]interface{})
+		p["pendingId"] = pending.ID()
+		p["selector"] = convertSelectorToJSON(pending.Selector())
+		select {
+		case <-pending.Done():
+			if pending.Err() != nil {
+				p["state"] = "failed"
+				p["message"] = pending.Err().Error()
+			} else {
+				lease := pending.Snapshot()
+				p["leaseId"] = lease.ID()
+				p["mediaId"] = lease.MediaID()
+				if lease.IsValid() {
+					p["state"] = "leased"
+					p["mountPath"] = lease.MountPath()
+				} else {
+					// It expired, or the media went away since.
+					p["state"] = "invalidated"
+				}
+			}
+		default:
+			p["state"] = "waiting"
+		}
+		response.Pending = append(response.Pending, p)
+	}
+
+	response.Success = true
+	sendResponse(w, http.StatusOK, response)
+}
+
+func (server *Server) leasePendingCancel(w http.ResponseWriter, r *http.Request) {
+	var request leasePendingCancelRequest
+	err := getRequestBody(r, &request)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	if len(request.PendingID) == 0 {
+		sendError(w, fmt.Errorf("no pending id provided"))
+		return
+	}
+
+	var response leasePendingCancelResponse
+
+	err = server.leaser.CancelPending(request.PendingID)
+	if err != nil {
+		response.Success = false
+		response.Message = err.Error()
+		sendResponse(w, http.StatusBadRequest, response)
+		return
+	}
+
+	response.Success = true
+	sendResponse(w, http.StatusOK, response)
+}
+
+func convertSelectorToJSON(selector leaser.Selector) leaseSelectorRequest {
+	return leaseSelectorRequest(selector)
+}
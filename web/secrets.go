@@ -0,0 +1,66 @@
+package web
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type mediaSecretsRequest struct {
+	MediaID string `json:"mediaId"`
+}
+
+type mediaSecretsResponse struct {
+	genericResponse
+	Properties map[string]string `json:"properties"`
+}
+
+// mediaSecrets Returns the secret properties of a media item (passwords)
+// that are redacted everywhere else. Requires the admin token.
+func (server *Server) mediaSecrets(w http.ResponseWriter, r *http.Request) {
+	if !server.isAdmin(r) {
+		sendUnauthorized(w)
+		return
+	}
+
+	var request mediaSecretsRequest
+	getRequestBody(r, &request)
+
+	if len(request.MediaID) == 0 {
+		sendError(w, fmt.Errorf("no media id provided"))
+		return
+	}
+
+	media := server.mediaProvider.GetMediaByID(request.MediaID)
+	if media == nil {
+		sendError(w, fmt.Errorf("no media found with the given id"))
+		return
+	}
+
+	var response mediaSecretsResponse
+	response.Success = true
+	response.Properties = getSecretProperties(media)
+	sendResponse(w, http.StatusOK, response)
+}
+
+func sendUnauthorized(w http.ResponseWriter) {
+	var response genericResponse
+	response.Success = false
+	response.Message = "a valid admin token is required"
+	sendResponse(w, http.StatusUnauthorized, response)
+}
+
+// isAdmin Checks for "Authorization: Bearer <token>". If no
+// admin token was configured, nobody is an admin.
+func (server *Server) isAdmin(r *http.Request) bool {
+	if len(server.adminToken) == 0 {
+		return false
+	}
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(header, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(server.adminToken)) == 1
+}
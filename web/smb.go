@@ -1,8 +1,10 @@
 package web
 
 import (
+	"fmt"
 	"net/http"
 
+	"github.com/pauldotknopf/automounter/leaser"
 	"github.com/pauldotknopf/automounter/providers/smb"
 )
 
@@ -12,13 +14,25 @@ type smbResponse struct {
 }
 
 type smbTestRequest struct {
-	Server   string `json:"server"`
-	Share    string `json:"share"`
-	Security string `json:"security"`
-	Secure   bool   `json:"secure"`
-	Domain   string `json:"domain"`
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Server    string `json:"server"`
+	Share     string `json:"share"`
+	Security  string `json:"security"`
+	Secure    bool   `json:"secure"`
+	Domain    string `json:"domain"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	Version   string `json:"version"`
+	UID       string `json:"uid"`
+	GID       string `json:"gid"`
+	FileMode  string `json:"fileMode"`
+	DirMode   string `json:"dirMode"`
+	ReadOnly  bool   `json:"readOnly"`
+	Cache     string `json:"cache"`
+	Seal      bool   `json:"seal"`
+	Port      int    `json:"port"`
+	IOCharset string `json:"iocharset"`
+	Principal string `json:"principal"`
+	Keytab    string `json:"keytab"`
 }
 
 type smbTestResponse struct {
@@ -45,12 +59,35 @@ type smbRemoveResponse struct {
 
 type smbDynamicLeaseRequest struct {
 	smbTestRequest
+	// In seconds, zero for a lease that never expires.
+	TTL int `json:"ttl"`
+	// "ro" to mount the share read-only for this lease
+	Access string `json:"access"`
 }
 
 type smbDynamicLeaseResponse struct {
 	leaseCreateResponse
 }
 
+type smbDiscoverResponse struct {
+	genericResponse
+	Servers []smb.Server `json:"servers"`
+}
+
+type smbSharesRequest struct {
+	Server   string `json:"server"`
+	Port     int    `json:"port"`
+	Secure   bool   `json:"secure"`
+	Domain   string `json:"domain"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type smbSharesResponse struct {
+	genericResponse
+	Shares []smb.Share `json:"shares"`
+}
+
 func (server *Server) smb(w http.ResponseWriter, r *http.Request) {
 	var response smbResponse
 	response.Success = true
@@ -72,11 +109,15 @@ func (server *Server) smbTest(w http.ResponseWriter, r *http.Request) {
 	// The request was a success (but maybe not the smb test)
 	response.Success = true
 
-	options, err := smb.CreateOptions(request.Server, request.Share, request.Security, request.Secure, request.Domain, request.Username, request.Password)
+	options, err := buildSMBOptions(request)
 	if err != nil {
 		sendError(w, err)
 		return
 	}
+	if status, err := server.checkSMBKerberos(r, options); err != nil {
+		sendErrorStatus(w, status, err)
+		return
+	}
 
 	err = server.smbProvider.TestConnection(options)
 	if err != nil {
@@ -100,12 +141,15 @@ func (server *Server) smbAdd(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	options, err := smb.CreateOptions(request.Server, request.Share, request.Security, request.Secure, request.Domain, request.Username, request.Password)
+	options, err := buildSMBOptions(request.smbTestRequest)
 	if err != nil {
 		response.Message = err.Error()
 		response.Success = false
+	} else if status, err := server.checkSMBKerberos(r, options); err != nil {
+		sendErrorStatus(w, status, err)
+		return
 	} else {
-		media, err := server.smbProvider.AddMedia(options)
+		media, err := server.smbProvider.AddMedia(options, true)
 		if err != nil {
 			response.Message = err.Error()
 			response.Success = false
@@ -151,16 +195,21 @@ func (server *Server) smbDynamicLease(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	options, err := smb.CreateOptions(request.Server, request.Share, request.Security, request.Secure, request.Domain, request.Username, request.Password)
+	options, err := buildSMBOptions(request.smbTestRequest)
 	if err != nil {
 		response.Message = err.Error()
 		response.Success = false
 		sendResponse(w, http.StatusOK, response)
 		return
 	}
+	if status, err := server.checkSMBKerberos(r, options); err != nil {
+		sendErrorStatus(w, status, err)
+		return
+	}
 
 	// Build the media so that we can get the "id" to build the dynamic lease.
 	lease, media, err := server.smbProvider.DynamicLease(options,
+		buildSMBLeaseOptions(request),
 		server.leaser)
 
 	if err != nil {
@@ -174,6 +223,100 @@ func (server *Server) smbDynamicLease(w http.ResponseWriter, r *http.Request) {
 	response.Success = true
 	response.LeaseID = lease.ID()
 	response.MountPath = lease.MountPath()
+	response.ExpiresAt = convertExpiresAtToJSON(lease)
+	response.MountOptions = lease.MountOptions()
+	response.ReadOnly = lease.ReadOnly()
+
+	sendResponse(w, http.StatusOK, response)
+}
+
+// checkSMBKerberos Kerberos mounts use the credentials of this machine,
+// so only admins can ask for them, and only with keytabs from the
+// keytab directory. Otherwise anyone could mount as the host principal.
+func (server *Server) checkSMBKerberos(r *http.Request, options smb.Options) (int, error) {
+	if !options.UsesKerberos() {
+		return http.StatusOK, nil
+	}
+	if !server.isAdmin(r) {
+		return http.StatusUnauthorized, fmt.Errorf("a valid admin token is required for kerberos")
+	}
+	if len(options.Kerberos.Principal) > 0 {
+		err := server.smbProvider.CheckKeytab(options.Kerberos.Keytab)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+	return http.StatusOK, nil
+}
 
+func buildSMBOptions(request smbTestRequest) (smb.Options, error) {
+	var mount smb.MountOptions
+	mount.Version = request.Version
+	mount.UID = request.UID
+	mount.GID = request.GID
+	mount.FileMode = request.FileMode
+	mount.DirMode = request.DirMode
+	mount.ReadOnly = request.ReadOnly
+	mount.Cache = request.Cache
+	mount.Seal = request.Seal
+	mount.Port = request.Port
+	mount.IOCharset = request.IOCharset
+	var kerberos smb.KerberosOptions
+	kerberos.Principal = request.Principal
+	kerberos.Keytab = request.Keytab
+	return smb.CreateOptions(request.Server, request.Share, request.Security, request.Secure, request.Domain, request.Username, request.Password, mount, kerberos)
+}
+
+func (server *Server) smbDiscover(w http.ResponseWriter, r *http.Request) {
+	var response smbDiscoverResponse
+
+	servers, err := server.smbProvider.DiscoverServers()
+	if err != nil {
+		response.Success = false
+		response.Message = err.Error()
+		sendResponse(w, http.StatusOK, response)
+		return
+	}
+
+	response.Success = true
+	response.Servers = servers
 	sendResponse(w, http.StatusOK, response)
 }
+
+func (server *Server) smbShares(w http.ResponseWriter, r *http.Request) {
+
+	var request smbSharesRequest
+	var response smbSharesResponse
+
+	err := getRequestBody(r, &request)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	var options smb.ShareListOptions
+	options.Server = request.Server
+	options.Port = request.Port
+	options.Secure = request.Secure
+	options.Domain = request.Domain
+	options.Username = request.Username
+	options.Password = request.Password
+
+	shares, err := server.smbProvider.ListShares(options)
+	if err != nil {
+		response.Success = false
+		response.Message = err.Error()
+		sendResponse(w, http.StatusOK, response)
+		return
+	}
+
+	response.Success = true
+	response.Shares = shares
+	sendResponse(w, http.StatusOK, response)
+}
+
+func buildSMBLeaseOptions(request smbDynamicLeaseRequest) leaser.LeaseOptions {
+	leaseOptions := buildLeaseOptions(request.TTL)
+	leaseOptions.Access = leaser.Access(request.Access)
+	return leaseOptions
+}
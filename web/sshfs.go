@@ -0,0 +1,199 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/pauldotknopf/automounter/providers/sshfs"
+)
+
+type sshfsResponse struct {
+	genericResponse
+	Entries []map[string]interface{} `json:"entries"`
+}
+
+type sshfsTestRequest struct {
+	Server      string `json:"server"`
+	Port        int    `json:"port"`
+	Username    string `json:"username"`
+	Path        string `json:"path"`
+	Password    string `json:"password"`
+	PrivateKey  string `json:"privateKey"`
+	KnownHosts  string `json:"knownHosts"`
+	ReadOnly    bool   `json:"readOnly"`
+	AllowOther  bool   `json:"allowOther"`
+	UID         string `json:"uid"`
+	GID         string `json:"gid"`
+	Compression bool   `json:"compression"`
+}
+
+type sshfsTestResponse struct {
+	genericResponse
+	IsValid bool `json:"isValid"`
+}
+
+type sshfsAddRequest struct {
+	sshfsTestRequest
+}
+
+type sshfsAddResponse struct {
+	genericResponse
+	MediaID string `json:"mediaId"`
+}
+
+type sshfsRemoveRequest struct {
+	MediaID string `json:"mediaId"`
+}
+
+type sshfsRemoveResponse struct {
+	genericResponse
+}
+
+type sshfsDynamicLeaseRequest struct {
+	sshfsTestRequest
+	// In seconds, zero for a lease that never expires.
+	TTL int `json:"ttl"`
+}
+
+type sshfsDynamicLeaseResponse struct {
+	leaseCreateResponse
+}
+
+func (server *Server) sshfs(w http.ResponseWriter, r *http.Request) {
+	var response sshfsResponse
+	response.Success = true
+	response.Entries = convertMediaArrayToJSON(server.sshfsProvider.GetMedia())
+	sendResponse(w, http.StatusOK, response)
+}
+
+func (server *Server) sshfsTest(w http.ResponseWriter, r *http.Request) {
+
+	var request sshfsTestRequest
+	var response sshfsTestResponse
+
+	err := getRequestBody(r, &request)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	// The request was a success (but maybe not the sshfs test)
+	response.Success = true
+
+	options, err := buildSSHFSOptions(request)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	err = server.sshfsProvider.TestConnection(options)
+	if err != nil {
+		response.Message = err.Error()
+		response.IsValid = false
+	} else {
+		response.IsValid = true
+	}
+
+	sendResponse(w, http.StatusOK, response)
+}
+
+func (server *Server) sshfsAdd(w http.ResponseWriter, r *http.Request) {
+
+	var request sshfsAddRequest
+	var response sshfsAddResponse
+
+	err := getRequestBody(r, &request)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	options, err := buildSSHFSOptions(request.sshfsTestRequest)
+	if err != nil {
+		response.Message = err.Error()
+		response.Success = false
+	} else {
+		media, err := server.sshfsProvider.AddMedia(options, true)
+		if err != nil {
+			response.Message = err.Error()
+			response.Success = false
+		} else {
+			response.MediaID = media.ID()
+			response.Success = true
+		}
+	}
+
+	sendResponse(w, http.StatusOK, response)
+}
+
+func (server *Server) sshfsRemove(w http.ResponseWriter, r *http.Request) {
+
+	var request sshfsRemoveRequest
+	var response sshfsRemoveResponse
+
+	err := getRequestBody(r, &request)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	err = server.sshfsProvider.RemoveMedia(request.MediaID)
+	if err != nil {
+		response.Success = false
+		response.Message = err.Error()
+	} else {
+		response.Success = true
+	}
+
+	sendResponse(w, http.StatusOK, response)
+}
+
+func (server *Server) sshfsDynamicLease(w http.ResponseWriter, r *http.Request) {
+
+	var request sshfsDynamicLeaseRequest
+	var response sshfsDynamicLeaseResponse
+
+	err := getRequestBody(r, &request)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	options, err := buildSSHFSOptions(request.sshfsTestRequest)
+	if err != nil {
+		response.Message = err.Error()
+		response.Success = false
+		sendResponse(w, http.StatusOK, response)
+		return
+	}
+
+	lease, media, err := server.sshfsProvider.DynamicLease(options,
+		buildLeaseOptions(request.TTL),
+		server.leaser)
+
+	if err != nil {
+		response.Success = false
+		response.Message = err.Error()
+		sendResponse(w, http.StatusOK, response)
+		return
+	}
+
+	response.Media = convertMediaToJSON(media)
+	response.Success = true
+	response.LeaseID = lease.ID()
+	response.MountPath = lease.MountPath()
+	response.ExpiresAt = convertExpiresAtToJSON(lease)
+	response.MountOptions = lease.MountOptions()
+	response.ReadOnly = lease.ReadOnly()
+
+	sendResponse(w, http.StatusOK, response)
+}
+
+func buildSSHFSOptions(request sshfsTestRequest) (sshfs.Options, error) {
+	var mount sshfs.MountOptions
+	mount.ReadOnly = request.ReadOnly
+	mount.AllowOther = request.AllowOther
+	mount.UID = request.UID
+	mount.GID = request.GID
+	mount.Compression = request.Compression
+	return sshfs.CreateOptions(request.Server, request.Port, request.Username, request.Path, request.Password, request.PrivateKey, request.KnownHosts, mount)
+}
@@ -0,0 +1,41 @@
+package web
+
+import (
+	"net/http"
+)
+
+type udisksUnlockRequest struct {
+	MediaID    string `json:"mediaId"`
+	Passphrase string `json:"passphrase"`
+	// The contents of the keyfile, base64 encoded
+	Keyfile []byte `json:"keyfile"`
+}
+
+type udisksUnlockResponse struct {
+	genericResponse
+	// The unlocked media, which is what gets leased
+	Media map[string]interface{} `json:"media"`
+}
+
+func (server *Server) udisksUnlock(w http.ResponseWriter, r *http.Request) {
+
+	var request udisksUnlockRequest
+	var response udisksUnlockResponse
+
+	err := getRequestBody(r, &request)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	media, err := server.udisksProvider.Unlock(request.MediaID, request.Passphrase, request.Keyfile)
+	if err != nil {
+		response.Success = false
+		response.Message = err.Error()
+	} else {
+		response.Success = true
+		response.Media = convertMediaToJSON(media)
+	}
+
+	sendResponse(w, http.StatusOK, response)
+}
@@ -9,29 +9,63 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/pauldotknopf/automounter/leaser"
 	"github.com/pauldotknopf/automounter/providers"
+	"github.com/pauldotknopf/automounter/providers/fake"
+	"github.com/pauldotknopf/automounter/providers/image"
+	"github.com/pauldotknopf/automounter/providers/nfs"
 	"github.com/pauldotknopf/automounter/providers/smb"
+	"github.com/pauldotknopf/automounter/providers/sshfs"
+	"github.com/pauldotknopf/automounter/providers/udisks"
+	"github.com/pauldotknopf/automounter/providers/webdav"
 )
 
 // Server The web server instance
 type Server struct {
-	mediaProvider providers.MediaProvider
-	leaser        leaser.Leaser
-	smbProvider   smb.Provider
+	mediaProvider  providers.MediaProvider
+	leaser         leaser.Leaser
+	udisksProvider udisks.Provider
+	smbProvider    smb.Provider
+	nfsProvider    nfs.Provider
+	sshfsProvider  sshfs.Provider
+	webdavProvider webdav.Provider
+	imageProvider  image.Provider
+	fakeProvider   fake.Provider
+	adminToken     string
 }
 
-// Create Create the web server
-func Create(leaser leaser.Leaser, smbProvider smb.Provider) *Server {
+// Providers The providers that have their own routes,
+// nil for the ones that aren't enabled.
+type Providers struct {
+	Udisks udisks.Provider
+	SMB    smb.Provider
+	NFS    nfs.Provider
+	SSHFS  sshfs.Provider
+	WebDAV webdav.Provider
+	Image  image.Provider
+	Fake   fake.Provider
+}
+
+// Create Create the web server. Requests carrying the admin
+// token can retrieve secrets, like smb passwords.
+func Create(leaser leaser.Leaser, enabledProviders Providers, adminToken string) *Server {
 	return &Server{
 		leaser.MediaProvider(),
 		leaser,
-		smbProvider,
+		enabledProviders.Udisks,
+		enabledProviders.SMB,
+		enabledProviders.NFS,
+		enabledProviders.SSHFS,
+		enabledProviders.WebDAV,
+		enabledProviders.Image,
+		enabledProviders.Fake,
+		adminToken,
 	}
 }
 
-// Listen Start listening
-func (server *Server) Listen(ctx context.Context, port int, started func()) error {
+// Handler Returns the routes of the server
+func (server *Server) Handler() http.Handler {
 	var router = mux.NewRouter()
 	router.HandleFunc("/media", server.media).Methods("GET")
+	router.HandleFunc("/media/secrets", server.mediaSecrets).Methods("POST")
 	router.HandleFunc("/mount", server.mount).Methods("POST")
 	router.HandleFunc("/unmount", server.unmount).Methods("POST")
 
@@ -40,6 +74,14 @@ func (server *Server) Listen(ctx context.Context, port int, started func()) erro
 	router.HandleFunc("/leases", server.leases).Methods("GET")
 	router.HandleFunc("/leases/create", server.leaseCreate).Methods("POST")
 	router.HandleFunc("/leases/release", server.leaseRelease).Methods("POST")
+	router.HandleFunc("/leases/renew", server.leaseRenew).Methods("POST")
+	router.HandleFunc("/leases/wait", server.leaseWait).Methods("POST")
+	router.HandleFunc("/leases/pending", server.leasesPending).Methods("GET")
+	router.HandleFunc("/leases/pending/cancel", server.leasePendingCancel).Methods("POST")
+
+	if server.udisksProvider != nil {
+		router.HandleFunc("/udisks/unlock", server.udisksUnlock).Methods("POST")
+	}
 
 	if server.smbProvider != nil {
 		router.HandleFunc("/smb", server.smb).Methods("GET")
@@ -47,14 +89,58 @@ func (server *Server) Listen(ctx context.Context, port int, started func()) erro
 		router.HandleFunc("/smb/add", server.smbAdd).Methods("POST")
 		router.HandleFunc("/smb/remove", server.smbRemove).Methods("POST")
 		router.HandleFunc("/smb/dynamicLease", server.smbDynamicLease).Methods("POST")
+		router.HandleFunc("/smb/discover", server.smbDiscover).Methods("GET")
+		router.HandleFunc("/smb/shares", server.smbShares).Methods("POST")
+	}
+
+	if server.nfsProvider != nil {
+		router.HandleFunc("/nfs", server.nfs).Methods("GET")
+		router.HandleFunc("/nfs/test", server.nfsTest).Methods("POST")
+		router.HandleFunc("/nfs/add", server.nfsAdd).Methods("POST")
+		router.HandleFunc("/nfs/remove", server.nfsRemove).Methods("POST")
+		router.HandleFunc("/nfs/dynamicLease", server.nfsDynamicLease).Methods("POST")
+	}
+
+	if server.sshfsProvider != nil {
+		router.HandleFunc("/sshfs", server.sshfs).Methods("GET")
+		router.HandleFunc("/sshfs/test", server.sshfsTest).Methods("POST")
+		router.HandleFunc("/sshfs/add", server.sshfsAdd).Methods("POST")
+		router.HandleFunc("/sshfs/remove", server.sshfsRemove).Methods("POST")
+		router.HandleFunc("/sshfs/dynamicLease", server.sshfsDynamicLease).Methods("POST")
 	}
 
-	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if server.webdavProvider != nil {
+		router.HandleFunc("/webdav", server.webdav).Methods("GET")
+		router.HandleFunc("/webdav/test", server.webdavTest).Methods("POST")
+		router.HandleFunc("/webdav/add", server.webdavAdd).Methods("POST")
+		router.HandleFunc("/webdav/remove", server.webdavRemove).Methods("POST")
+		router.HandleFunc("/webdav/dynamicLease", server.webdavDynamicLease).Methods("POST")
+	}
+
+	if server.imageProvider != nil {
+		router.HandleFunc("/image", server.image).Methods("GET")
+		router.HandleFunc("/image/add", server.imageAdd).Methods("POST")
+		router.HandleFunc("/image/remove", server.imageRemove).Methods("POST")
+	}
+
+	if server.fakeProvider != nil {
+		router.HandleFunc("/fake", server.fake).Methods("GET")
+		router.HandleFunc("/fake/add", server.fakeAdd).Methods("POST")
+		router.HandleFunc("/fake/remove", server.fakeRemove).Methods("POST")
+		router.HandleFunc("/fake/failures", server.fakeFailures).Methods("POST")
+	}
+
+	return router
+}
+
+// Listen Start listening
+func (server *Server) Listen(ctx context.Context, address string, started func()) error {
+	l, err := net.Listen("tcp", address)
 	if err != nil {
 		return err
 	}
 
-	h := &http.Server{Handler: router}
+	h := &http.Server{Handler: server.Handler()}
 
 	go func() {
 		<-ctx.Done()
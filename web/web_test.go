@@ -0,0 +1,323 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pauldotknopf/automounter/helpers"
+	"github.com/pauldotknopf/automounter/leaser"
+	"github.com/pauldotknopf/automounter/providers/fake"
+)
+
+const testAdminToken = "secret-token"
+
+type testServer struct {
+	*httptest.Server
+	fake   fake.Provider
+	leaser leaser.Leaser
+}
+
+func createTestServer(t *testing.T) (*testServer, func()) {
+	dir, err := ioutil.TempDir("", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := helpers.MountRoot()
+	helpers.SetMountRoot(filepath.Join(dir, "mounts"))
+
+	fakeProvider, err := fake.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := leaser.Create(fakeProvider, nil, leaser.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		l.Process(ctx)
+		close(done)
+	}()
+	// Give it a moment to start listening to the provider.
+	time.Sleep(time.Millisecond * 50)
+
+	server := Create(l, Providers{Fake: fakeProvider}, testAdminToken)
+	s := &testServer{httptest.NewServer(server.Handler()), fakeProvider, l}
+	return s, func() {
+		s.Close()
+		cancel()
+		<-done
+		helpers.SetMountRoot(previous)
+		os.RemoveAll(dir)
+	}
+}
+
+// request Sends the body as JSON, and returns the status and the decoded response.
+func (s *testServer) request(t *testing.T, method string, path string, token string, body interface{}) (int, map[string]interface{}) {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := http.NewRequest(method, s.URL+path, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(token) > 0 {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	response, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var result map[string]interface{}
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		t.Fatalf("%s %s returned invalid json: %v", method, path, err)
+	}
+	return response.StatusCode, result
+}
+
+func (s *testServer) post(t *testing.T, path string, body interface{}) (int, map[string]interface{}) {
+	return s.request(t, "POST", path, "", body)
+}
+
+func (s *testServer) addMedia(t *testing.T, options fake.Options) {
+	_, err := s.fake.AddMedia(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFakeRoutes(t *testing.T) {
+	s, cleanup := createTestServer(t)
+	defer cleanup()
+
+	status, response := s.post(t, "/fake/add", map[string]interface{}{"id": "stick", "properties": map[string]string{"label": "BACKUP"}})
+	if status != http.StatusOK || response["mediaId"] != "stick" {
+		t.Fatalf("unexpected response %d %v", status, response)
+	}
+	_, response = s.post(t, "/fake/add", map[string]interface{}{"id": "stick"})
+	if response["success"] != false {
+		t.Fatal("expected adding the same id twice to fail")
+	}
+
+	r, err := http.Get(s.URL + "/media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var media []map[string]interface{}
+	err = json.NewDecoder(r.Body).Decode(&media)
+	r.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(media) != 1 || media[0]["id"] != "stick" || media[0]["provider"] != "fake" {
+		t.Fatalf("unexpected media %v", media)
+	}
+
+	status, _ = s.post(t, "/fake/remove", map[string]string{"mediaId": "stick"})
+	if status != http.StatusOK || len(s.fake.GetMedia()) != 0 {
+		t.Fatal("expected the media to be removed")
+	}
+}
+
+func TestLeaseRoutes(t *testing.T) {
+	s, cleanup := createTestServer(t)
+	defer cleanup()
+
+	s.addMedia(t, fake.Options{ID: "stick"})
+
+	tests := []struct {
+		name   string
+		body   map[string]interface{}
+		status int
+	}{
+		{"no media id", map[string]interface{}{}, http.StatusBadRequest},
+		{"unknown media", map[string]interface{}{"mediaId": "missing"}, http.StatusBadRequest},
+		{"bad access", map[string]interface{}{"mediaId": "stick", "access": "rx"}, http.StatusBadRequest},
+		{"wait too long", map[string]interface{}{"mediaId": "stick", "wait": 3600}, http.StatusBadRequest},
+		{"exclusive", map[string]interface{}{"mediaId": "stick", "mode": "exclusive", "ttl": 60}, http.StatusOK},
+		{"conflict", map[string]interface{}{"mediaId": "stick"}, http.StatusConflict},
+		{"conflict after waiting", map[string]interface{}{"mediaId": "stick", "wait": 1}, http.StatusConflict},
+	}
+
+	var leaseID string
+	for _, test := range tests {
+		status, response := s.post(t, "/leases/create", test.body)
+		if status != test.status {
+			t.Fatalf("%s: expected %d, got %d %v", test.name, test.status, status, response)
+		}
+		if status == http.StatusOK {
+			leaseID = response["leaseId"].(string)
+			if response["exclusive"] != true || response["expiresAt"] == nil || len(response["mountPath"].(string)) == 0 {
+				t.Fatalf("%s: unexpected response %v", test.name, response)
+			}
+		}
+	}
+
+	status, response := s.request(t, "GET", "/leases", "", nil)
+	leases := response["leases"].([]interface{})
+	if status != http.StatusOK || len(leases) != 1 || leases[0].(map[string]interface{})["leaseId"] != leaseID {
+		t.Fatalf("unexpected leases %v", response)
+	}
+
+	status, response = s.post(t, "/leases/renew", map[string]string{"leaseId": leaseID})
+	if status != http.StatusOK || response["expiresAt"] == nil {
+		t.Fatalf("unexpected renewal %d %v", status, response)
+	}
+	status, _ = s.post(t, "/leases/release", map[string]string{"leaseId": leaseID})
+	if status != http.StatusOK {
+		t.Fatalf("expected the lease to be released, got %d", status)
+	}
+	status, _ = s.post(t, "/leases/release", map[string]string{"leaseId": leaseID})
+	if status != http.StatusBadRequest {
+		t.Fatalf("expected releasing twice to fail, got %d", status)
+	}
+	status, _ = s.post(t, "/leases/renew", map[string]string{"leaseId": leaseID})
+	if status != http.StatusBadRequest {
+		t.Fatalf("expected renewing a released lease to fail, got %d", status)
+	}
+}
+
+func TestLeaseWaitRoutes(t *testing.T) {
+	s, cleanup := createTestServer(t)
+	defer cleanup()
+
+	tests := []struct {
+		name   string
+		body   map[string]interface{}
+		status int
+	}{
+		{"forgotten", map[string]interface{}{"selector": map[string]string{"label": "BACKUP"}}, http.StatusBadRequest},
+		{"bad selector", map[string]interface{}{"selector": map[string]string{"label": "["}, "timeout": 60}, http.StatusBadRequest},
+		{"timeout", map[string]interface{}{"selector": map[string]string{"label": "BACKUP"}, "timeout": 60}, http.StatusOK},
+		{"ttl", map[string]interface{}{"selector": map[string]string{"label": "BACKUP"}, "ttl": 60}, http.StatusOK},
+		{"timed out", map[string]interface{}{"selector": map[string]string{"label": "DATA"}, "timeout": 1, "block": true}, http.StatusRequestTimeout},
+	}
+
+	pendingIDs := make([]string, 0)
+	for _, test := range tests {
+		status, response := s.post(t, "/leases/wait", test.body)
+		if status != test.status {
+			t.Fatalf("%s: expected %d, got %d %v", test.name, test.status, status, response)
+		}
+		if status == http.StatusOK {
+			pendingIDs = append(pendingIDs, response["pendingId"].(string))
+		}
+	}
+
+	status, response := s.request(t, "GET", "/leases/pending", "", nil)
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status %d", status)
+	}
+	states := make(map[string]string)
+	for _, pending := range response["pending"].([]interface{}) {
+		p := pending.(map[string]interface{})
+		states[p["pendingId"].(string)] = p["state"].(string)
+	}
+	for _, pendingID := range pendingIDs {
+		if states[pendingID] != "waiting" {
+			t.Fatalf("expected %s to be waiting, got %v", pendingID, states)
+		}
+	}
+
+	status, _ = s.post(t, "/leases/pending/cancel", map[string]string{"pendingId": pendingIDs[0]})
+	if status != http.StatusOK {
+		t.Fatalf("expected the pending lease to be canceled, got %d", status)
+	}
+
+	// A blocking wait gets the lease once the media shows up.
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		s.fake.AddMedia(fake.Options{ID: "stick", Properties: map[string]string{"label": "BACKUP"}})
+	}()
+	status, response = s.post(t, "/leases/wait", map[string]interface{}{"selector": map[string]string{"label": "BACK*"}, "block": true, "timeout": 5})
+	if status != http.StatusOK || response["leaseId"] == nil || response["media"].(map[string]interface{})["id"] != "stick" {
+		t.Fatalf("unexpected response %d %v", status, response)
+	}
+
+	// The remaining non-blocking one got a lease on it too.
+	time.Sleep(time.Millisecond * 50)
+	_, response = s.request(t, "GET", "/leases/pending", "", nil)
+	for _, pending := range response["pending"].([]interface{}) {
+		p := pending.(map[string]interface{})
+		if p["pendingId"] == pendingIDs[1] && p["state"] != "leased" {
+			t.Fatalf("expected the pending lease to be leased, got %v", p)
+		}
+	}
+}
+
+func TestLeasePendingExpired(t *testing.T) {
+	s, cleanup := createTestServer(t)
+	defer cleanup()
+
+	s.addMedia(t, fake.Options{ID: "stick"})
+	status, response := s.post(t, "/leases/wait", map[string]interface{}{"ttl": 1})
+	if status != http.StatusOK {
+		t.Fatalf("unexpected response %d %v", status, response)
+	}
+	pendingID := response["pendingId"].(string)
+
+	// Expiry is checked every second or so.
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		_, response = s.request(t, "GET", "/leases/pending", "", nil)
+		p := response["pending"].([]interface{})[0].(map[string]interface{})
+		if p["pendingId"] != pendingID {
+			t.Fatalf("unexpected pending lease %v", p)
+		}
+		if p["state"] == "invalidated" {
+			if p["mediaId"] != "stick" || p["leaseId"] == nil || p["mountPath"] != nil {
+				t.Fatalf("unexpected invalidated lease %v", p)
+			}
+			return
+		}
+		if p["state"] != "leased" && p["state"] != "waiting" {
+			t.Fatalf("unexpected state %v", p)
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the lease to expire")
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+}
+
+func TestAdminRoutes(t *testing.T) {
+	s, cleanup := createTestServer(t)
+	defer cleanup()
+
+	s.addMedia(t, fake.Options{ID: "stick"})
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"wrong token", "guess", http.StatusUnauthorized},
+		{"admin", testAdminToken, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, _ := s.request(t, "POST", "/media/secrets", test.token, map[string]string{"mediaId": "stick"})
+			if status != test.status {
+				t.Fatalf("expected %d, got %d", test.status, status)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/pauldotknopf/automounter/providers/webdav"
+)
+
+type webdavResponse struct {
+	genericResponse
+	Entries []map[string]interface{} `json:"entries"`
+}
+
+type webdavTestRequest struct {
+	URL               string `json:"url"`
+	Username          string `json:"username"`
+	Password          string `json:"password"`
+	CACertificate     string `json:"caCertificate"`
+	ServerCertificate string `json:"serverCertificate"`
+	ReadOnly          bool   `json:"readOnly"`
+	UID               string `json:"uid"`
+	GID               string `json:"gid"`
+	FileMode          string `json:"fileMode"`
+	DirMode           string `json:"dirMode"`
+	UseLocks          bool   `json:"useLocks"`
+}
+
+type webdavTestResponse struct {
+	genericResponse
+	IsValid bool `json:"isValid"`
+}
+
+type webdavAddRequest struct {
+	webdavTestRequest
+}
+
+type webdavAddResponse struct {
+	genericResponse
+	MediaID string `json:"mediaId"`
+}
+
+type webdavRemoveRequest struct {
+	MediaID string `json:"mediaId"`
+}
+
+type webdavRemoveResponse struct {
+	genericResponse
+}
+
+type webdavDynamicLeaseRequest struct {
+	webdavTestRequest
+	// In seconds, zero for a lease that never expires.
+	TTL int `json:"ttl"`
+}
+
+type webdavDynamicLeaseResponse struct {
+	leaseCreateResponse
+}
+
+func (server *Server) webdav(w http.ResponseWriter, r *http.Request) {
+	var response webdavResponse
+	response.Success = true
+	response.Entries = convertMediaArrayToJSON(server.webdavProvider.GetMedia())
+	sendResponse(w, http.StatusOK, response)
+}
+
+func (server *Server) webdavTest(w http.ResponseWriter, r *http.Request) {
+
+	var request webdavTestRequest
+	var response webdavTestResponse
+
+	err := getRequestBody(r, &request)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	// The request was a success (but maybe not the webdav test)
+	response.Success = true
+
+	options, err := buildWebDAVOptions(request)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	err = server.webdavProvider.TestConnection(options)
+	if err != nil {
+		response.Message = err.Error()
+		response.IsValid = false
+	} else {
+		response.IsValid = true
+	}
+
+	sendResponse(w, http.StatusOK, response)
+}
+
+func (server *Server) webdavAdd(w http.ResponseWriter, r *http.Request) {
+
+	var request webdavAddRequest
+	var response webdavAddResponse
+
+	err := getRequestBody(r, &request)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	options, err := buildWebDAVOptions(request.webdavTestRequest)
+	if err != nil {
+		response.Message = err.Error()
+		response.Success = false
+	} else {
+		media, err := server.webdavProvider.AddMedia(options, true)
+		if err != nil {
+			response.Message = err.Error()
+			response.Success = false
+		} else {
+			response.MediaID = media.ID()
+			response.Success = true
+		}
+	}
+
+	sendResponse(w, http.StatusOK, response)
+}
+
+func (server *Server) webdavRemove(w http.ResponseWriter, r *http.Request) {
+
+	var request webdavRemoveRequest
+	var response webdavRemoveResponse
+
+	err := getRequestBody(r, &request)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	err = server.webdavProvider.RemoveMedia(request.MediaID)
+	if err != nil {
+		response.Success = false
+		response.Message = err.Error()
+	} else {
+		response.Success = true
+	}
+
+	sendResponse(w, http.StatusOK, response)
+}
+
+func (server *Server) webdavDynamicLease(w http.ResponseWriter, r *http.Request) {
+
+	var request webdavDynamicLeaseRequest
+	var response webdavDynamicLeaseResponse
+
+	err := getRequestBody(r, &request)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	options, err := buildWebDAVOptions(request.webdavTestRequest)
+	if err != nil {
+		response.Message = err.Error()
+		response.Success = false
+		sendResponse(w, http.StatusOK, response)
+		return
+	}
+
+	lease, media, err := server.webdavProvider.DynamicLease(options,
+		buildLeaseOptions(request.TTL),
+		server.leaser)
+
+	if err != nil {
+		response.Success = false
+		response.Message = err.Error()
+		sendResponse(w, http.StatusOK, response)
+		return
+	}
+
+	response.Media = convertMediaToJSON(media)
+	response.Success = true
+	response.LeaseID = lease.ID()
+	response.MountPath = lease.MountPath()
+	response.ExpiresAt = convertExpiresAtToJSON(lease)
+	response.MountOptions = lease.MountOptions()
+	response.ReadOnly = lease.ReadOnly()
+
+	sendResponse(w, http.StatusOK, response)
+}
+
+func buildWebDAVOptions(request webdavTestRequest) (webdav.Options, error) {
+	var mount webdav.MountOptions
+	mount.ReadOnly = request.ReadOnly
+	mount.UID = request.UID
+	mount.GID = request.GID
+	mount.FileMode = request.FileMode
+	mount.DirMode = request.DirMode
+	mount.UseLocks = request.UseLocks
+	return webdav.CreateOptions(request.URL, request.Username, request.Password, request.CACertificate, request.ServerCertificate, mount)
+}